@@ -23,11 +23,13 @@ import (
 	"os/signal"
 	"runtime"
 	"syscall"
+	"time"
 
 	auth "github.com/abbot/go-http-auth"
 	"github.com/golang/glog"
 	"github.com/google/cadvisor/api"
 	"github.com/google/cadvisor/container/docker"
+	"github.com/google/cadvisor/container/libcontainer"
 	"github.com/google/cadvisor/container/raw"
 	"github.com/google/cadvisor/healthz"
 	"github.com/google/cadvisor/info"
@@ -44,12 +46,46 @@ var maxProcs = flag.Int("max_procs", 0, "max number of CPUs that can be used sim
 
 var argDbDriver = flag.String("storage_driver", "", "storage driver to use. Data is always cached shortly in memory, this controls where data is pushed besides the local cache. Empty means none. Options are: <empty> (default), bigquery, and influxdb")
 var versionFlag = flag.Bool("version", false, "print cAdvisor version and exit")
+var validateCgroups = flag.Bool("validate_cgroups", false, "print whether the cgroup files of the root container can be read and exit, with a non-zero status if they cannot")
+var shutdownTimeout = flag.Duration("shutdown_timeout", 10*time.Second, "maximum time to wait for the container watches to stop on shutdown")
 
 var httpAuthFile = flag.String("http_auth_file", "", "HTTP auth file for the web UI")
 var httpAuthRealm = flag.String("http_auth_realm", "localhost", "HTTP auth realm for the web UI")
 var httpDigestFile = flag.String("http_digest_file", "", "HTTP digest file for the web UI")
 var httpDigestRealm = flag.String("http_digest_realm", "localhost", "HTTP digest file for the web UI")
 
+// Options of the raw containers.
+var allowCgroupFileReads = flag.Bool("allow_cgroup_file_reads", false, "Whether to allow reading the raw cgroup files of raw containers for debugging")
+var reportStatsDeltas = flag.Bool("raw_stats_deltas", false, "Whether raw containers report the change of cumulative counters since the last read instead of their cumulative value")
+var reportStatsSinceCreation = flag.Bool("raw_stats_since_creation", false, "Whether raw containers report the change of cumulative counters since cAdvisor started watching them instead of their cumulative value. Counters restart from zero when the container is recreated")
+var cgroupReadTimeout = flag.Duration("cgroup_read_timeout", 5*time.Second, "Maximum time to wait for a cgroup file to be read before giving up, 0 waits forever")
+var cgroupReadAttempts = flag.Int("cgroup_read_attempts", 3, "Number of times a cgroup file read that failed with a transient error is attempted")
+var cgroupReadBackoff = flag.Duration("cgroup_read_backoff", 10*time.Millisecond, "Delay before retrying a failed cgroup file read, doubled after every attempt")
+var fsStatsInterval = flag.Duration("filesystem_stats_interval", 0, "Minimum time between collections of the filesystem stats of containers, the latest stats are reported in between. 0 collects them every time")
+var subpathUsageTtl = flag.Duration("subpath_usage_ttl", time.Minute, "Minimum time between computations of the usage of the directories listed in the subpaths of the container hints, which walk the directories with du")
+var strictSubsystems = flag.Bool("strict_cgroup_subsystems", false, "Whether collecting the stats of a container fails when one of its cgroups disappeared. By default the stats of the missing cgroups are left empty")
+var watchSpecChanges = flag.Bool("watch_spec_changes", false, "Whether to watch the limits of containers and report changes as they happen instead of on the next spec read")
+var dedupeFsStats = flag.Bool("dedupe_fs_stats", false, "Whether to report the filesystem stats of a device mounted at several mountpoints only once, for its first mountpoint")
+var allowMemoryReclaim = flag.Bool("allow_memory_reclaim", false, "Whether containers may be asked to reclaim memory through memory.reclaim. This modifies the containers")
+var cgroupStartupRetries = flag.Int("cgroup_startup_retries", 0, "Number of times a cgroup file that is empty or invalid, as happens right after a container is created, is read again")
+var cgroupStartupBackoff = flag.Duration("cgroup_startup_backoff", 5*time.Millisecond, "Delay before reading again a cgroup file that is empty or invalid")
+var bindMountFsUsage = flag.Bool("bind_mount_fs_usage", false, "Whether the usage of a filesystem shared with the host through a bind mount is the usage of the mounted directories (computed with du) instead of the usage of the whole filesystem")
+var recordCollectionCost = flag.Bool("record_collection_cost", false, "Whether to record the number of files read to collect the stats of raw containers and the time spent reading them. The stats collections of a container are serialized while enabled")
+var rootStatsFromProc = flag.Bool("root_stats_from_proc", false, "Whether the cpu and memory usage of the root container are read from /proc/stat and /proc/meminfo when the cpu or memory cgroup mounted is not the root of its hierarchy, as in a cgroup namespace")
+var cgroupMountCheckInterval = flag.Duration("cgroup_mount_check_interval", 0, "Interval between checks that the cgroup hierarchies of raw containers are still mounted where they were, their cgroup paths are refreshed when they moved. 0 never checks")
+var cgroupMountsDir = flag.String("cgroup_mounts_dir", "", "Directory under which the cgroup hierarchies are mounted (e.g. /sys/fs/cgroup), watched for hierarchies mounted after cAdvisor started, as when it starts early in the boot. Raw containers then refresh their cgroup paths. Empty does not watch")
+var skipUnchangedConfigFiles = flag.Bool("skip_unchanged_config_files", false, "Whether collecting the stats of raw containers skips reading again the cgroup configuration files it uses (e.g. memory.high) when their modification time did not change. Only writes from userspace update the modification time of cgroup files, so counters and usage files are always read")
+var schedWaitTime = flag.Bool("sched_wait_time", false, "Whether to report the time the threads of raw containers waited for a cpu, from the schedstat file of every thread. This reads one file per thread on every collection")
+var applicationIoStats = flag.Bool("application_io_stats", false, "Whether to report the IO of the processes of raw containers at the syscall level, from the io file of every process. This reads one file per process on every collection")
+var threadCountStats = flag.Bool("thread_count_stats", false, "Whether to report the number of threads of raw containers, from the tasks or cgroup.threads file of their cgroups. This reads a file per cgroup on every collection, which for the root container lists all the threads of the root cgroups")
+var oomScoreStats = flag.Bool("oom_score_stats", false, "Whether to report the highest OOM killer score of the processes of raw containers, from the oom_score and oom_score_adj files of every process. This reads two files per process on every collection")
+var includeLoopbackStats = flag.Bool("loopback_network_stats", false, "Whether to include the loopback device in the per-interface network stats of the root container")
+
+// Optional stats and processes of all containers.
+var qdiscStats = flag.Bool("qdisc_stats", false, "Whether to report the stats of the queueing disciplines of the network interfaces of the network namespace of containers, read through netlink. They count the packets dropped or delayed by traffic shaping")
+var tcpAdvancedStats = flag.Bool("tcp_advanced_stats", false, "Whether to report TCP retransmits, resets and listen drops of the network namespace of containers")
+var excludeKernelThreads = flag.Bool("exclude_kernel_threads", false, "Whether to leave kernel threads out of the processes listed for containers")
+
 func main() {
 	defer glog.Flush()
 	flag.Parse()
@@ -76,13 +112,25 @@ func main() {
 		glog.Fatalf("Failed to create a Container Manager: %s", err)
 	}
 
+	if *validateCgroups {
+		report, err := raw.Validate(containerManager, rawOptions())
+		if err != nil {
+			glog.Fatalf("Failed to validate cgroups: %v", err)
+		}
+		fmt.Print(report)
+		if !report.Ok() {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// Register Docker.
-	if err := docker.Register(containerManager); err != nil {
+	if err := docker.Register(containerManager, statsOptions()); err != nil {
 		glog.Errorf("Docker registration failed: %v.", err)
 	}
 
 	// Register the raw driver.
-	if err := raw.Register(containerManager); err != nil {
+	if err := raw.Register(containerManager, rawOptions()); err != nil {
 		glog.Fatalf("Raw registration failed: %v.", err)
 	}
 
@@ -153,6 +201,48 @@ func main() {
 	glog.Fatal(http.ListenAndServe(addr, nil))
 }
 
+// Returns the options of the raw containers set on the command line.
+func rawOptions() raw.Options {
+	return raw.Options{
+		AllowCgroupFileReads:     *allowCgroupFileReads,
+		StatsDeltas:              *reportStatsDeltas,
+		StatsSinceCreation:       *reportStatsSinceCreation,
+		CgroupReadTimeout:        *cgroupReadTimeout,
+		CgroupReadAttempts:       *cgroupReadAttempts,
+		CgroupReadBackoff:        *cgroupReadBackoff,
+		CgroupStartupRetries:     *cgroupStartupRetries,
+		CgroupStartupBackoff:     *cgroupStartupBackoff,
+		FsStatsInterval:          *fsStatsInterval,
+		SubpathUsageTtl:          *subpathUsageTtl,
+		StrictSubsystems:         *strictSubsystems,
+		WatchSpecChanges:         *watchSpecChanges,
+		DedupeFsStats:            *dedupeFsStats,
+		BindMountFsUsage:         *bindMountFsUsage,
+		AllowMemoryReclaim:       *allowMemoryReclaim,
+		RecordCollectionCost:     *recordCollectionCost,
+		RootStatsFromProc:        *rootStatsFromProc,
+		CgroupMountCheckInterval: *cgroupMountCheckInterval,
+		CgroupMountsDir:          *cgroupMountsDir,
+		SkipUnchangedConfigFiles: *skipUnchangedConfigFiles,
+		SchedWaitTime:            *schedWaitTime,
+		ApplicationIoStats:       *applicationIoStats,
+		ThreadCountStats:         *threadCountStats,
+		OomScoreStats:            *oomScoreStats,
+		LoopbackNetworkStats:     *includeLoopbackStats,
+		Stats:                    statsOptions(),
+	}
+}
+
+// Returns the optional stats and processes of all containers set on the
+// command line.
+func statsOptions() libcontainer.StatsOptions {
+	return libcontainer.StatsOptions{
+		QdiscStats:           *qdiscStats,
+		TcpAdvancedStats:     *tcpAdvancedStats,
+		ExcludeKernelThreads: *excludeKernelThreads,
+	}
+}
+
 func setMaxProcs() {
 	// TODO(vmarmol): Consider limiting if we have a CPU mask in effect.
 	// Allow as many threads as we have cores unless the user specified a value.
@@ -181,6 +271,9 @@ func installSignalHandler(containerManager manager.Manager) {
 		if err := containerManager.Stop(); err != nil {
 			glog.Errorf("Failed to stop container manager: %v", err)
 		}
+		if err := raw.Shutdown(*shutdownTimeout); err != nil {
+			glog.Errorf("Failed to stop watching containers: %v", err)
+		}
 		glog.Infof("Exiting given signal: %v", sig)
 		os.Exit(0)
 	}()
@@ -0,0 +1,92 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/cadvisor/info"
+)
+
+// Sums the CPU and memory usage of all the leaf containers under parent into a
+// single snapshot. A parent cgroup with no tasks of its own may report almost
+// no usage while all of it is in its children. Only leaves are summed since
+// intermediate containers may already include the usage of their children.
+// A parent with no subcontainers reports its own usage.
+func AggregateStats(parent ContainerHandler) (*info.ContainerStats, error) {
+	subcontainers, err := parent.ListContainers(ListRecursive)
+	if err != nil {
+		return nil, err
+	}
+	if len(subcontainers) == 0 {
+		return parent.GetStats()
+	}
+
+	ret := &info.ContainerStats{}
+	for _, leaf := range leafContainers(subcontainers) {
+		handler, err := NewContainerHandler(leaf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create handler for %q: %v", leaf, err)
+		}
+		stats, err := handler.GetStats()
+		if cleaner, ok := handler.(Cleaner); ok {
+			cleaner.Cleanup()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get stats of %q: %v", leaf, err)
+		}
+		addStats(ret, stats)
+	}
+	return ret, nil
+}
+
+// Returns the names of the containers that have no subcontainers among refs.
+func leafContainers(refs []info.ContainerReference) []string {
+	leaves := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		isLeaf := true
+		for _, other := range refs {
+			if strings.HasPrefix(other.Name, ref.Name+"/") {
+				isLeaf = false
+				break
+			}
+		}
+		if isLeaf {
+			leaves = append(leaves, ref.Name)
+		}
+	}
+	return leaves
+}
+
+// Adds the CPU and memory usage of stats to total.
+func addStats(total, stats *info.ContainerStats) {
+	if stats.Timestamp.After(total.Timestamp) {
+		total.Timestamp = stats.Timestamp
+	}
+	total.Cpu.Usage.Total += stats.Cpu.Usage.Total
+	total.Cpu.Usage.User += stats.Cpu.Usage.User
+	total.Cpu.Usage.System += stats.Cpu.Usage.System
+	for i, usage := range stats.Cpu.Usage.PerCpu {
+		if i >= len(total.Cpu.Usage.PerCpu) {
+			total.Cpu.Usage.PerCpu = append(total.Cpu.Usage.PerCpu, 0)
+		}
+		total.Cpu.Usage.PerCpu[i] += usage
+	}
+	total.Memory.Usage += stats.Memory.Usage
+	total.Memory.WorkingSet += stats.Memory.WorkingSet
+	total.Memory.ReclaimableMemory += stats.Memory.ReclaimableMemory
+	total.Memory.UnreclaimableMemory += stats.Memory.UnreclaimableMemory
+}
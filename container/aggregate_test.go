@@ -0,0 +1,69 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/info"
+)
+
+func newStatsMockContainerHandler(name string, cpuUsage, memUsage uint64) *MockContainerHandler {
+	handler := NewMockContainerHandler(name)
+	stats := &info.ContainerStats{
+		Timestamp: time.Now(),
+	}
+	stats.Cpu.Usage.Total = cpuUsage
+	stats.Cpu.Usage.PerCpu = []uint64{cpuUsage}
+	stats.Memory.Usage = memUsage
+	handler.On("GetStats").Return(stats, nil)
+	return handler
+}
+
+func TestAggregateStats(t *testing.T) {
+	ClearContainerHandlerFactories()
+	factory := &mockContainerHandlerFactory{
+		Name:           "mock",
+		CanHandleValue: true,
+	}
+	RegisterContainerHandlerFactory(factory)
+
+	// The intermediate /kubepods/pod1 must not be counted on top of its child.
+	parent := NewMockContainerHandler("/kubepods")
+	parent.On("ListContainers", ListRecursive).Return([]info.ContainerReference{
+		{Name: "/kubepods/pod1"},
+		{Name: "/kubepods/pod1/container1"},
+		{Name: "/kubepods/pod2"},
+	}, nil)
+	child1 := newStatsMockContainerHandler("/kubepods/pod1/container1", 1000, 4096)
+	child2 := newStatsMockContainerHandler("/kubepods/pod2", 500, 1024)
+	factory.On("NewContainerHandler", "/kubepods/pod1/container1").Return(child1, nil)
+	factory.On("NewContainerHandler", "/kubepods/pod2").Return(child2, nil)
+
+	stats, err := AggregateStats(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Cpu.Usage.Total != 1500 || stats.Cpu.Usage.PerCpu[0] != 1500 {
+		t.Errorf("aggregated cpu usage is %+v, expected 1500", stats.Cpu.Usage)
+	}
+	if stats.Memory.Usage != 5120 {
+		t.Errorf("aggregated memory usage is %d, expected %d", stats.Memory.Usage, 5120)
+	}
+	parent.AssertExpectations(t)
+	child1.AssertExpectations(t)
+	child2.AssertExpectations(t)
+}
@@ -0,0 +1,108 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Collector gathers custom metrics for a container, e.g. from an endpoint
+// exposed by the application running inside it.
+type Collector interface {
+	// Returns the current value of the collected metrics, keyed by metric name.
+	Collect() (map[string]float64, error)
+}
+
+// Parses metrics with one "<metric> <value>" pair per line. Empty lines and
+// lines starting with "#" are ignored.
+func parseMetrics(r io.Reader) (map[string]float64, error) {
+	metrics := make(map[string]float64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("malformed metric line %q", line)
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse value of metric %q: %v", fields[0], err)
+		}
+		metrics[fields[0]] = value
+	}
+	return metrics, scanner.Err()
+}
+
+// Collects the metrics written to a file by the application.
+type fileCollector struct {
+	path string
+}
+
+// Returns a collector reading the metrics in the specified file. The file has
+// one "<metric> <value>" pair per line.
+func NewFileCollector(path string) Collector {
+	return &fileCollector{path}
+}
+
+func (self *fileCollector) Collect() (map[string]float64, error) {
+	f, err := os.Open(self.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseMetrics(f)
+}
+
+// Timeout of the requests of HTTP collectors.
+const httpCollectorTimeout = 5 * time.Second
+
+// Collects the metrics served by the application over HTTP.
+type httpCollector struct {
+	url    string
+	client *http.Client
+}
+
+// Returns a collector fetching the metrics served at the specified URL. The
+// response has one "<metric> <value>" pair per line.
+func NewHttpCollector(url string) Collector {
+	return &httpCollector{
+		url: url,
+		client: &http.Client{
+			Timeout: httpCollectorTimeout,
+		},
+	}
+}
+
+func (self *httpCollector) Collect() (map[string]float64, error) {
+	resp, err := self.client.Get(self.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request to %q failed with status %q", self.url, resp.Status)
+	}
+	return parseMetrics(resp.Body)
+}
@@ -0,0 +1,83 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+)
+
+const testMetrics = `# Metrics of the application.
+requests 42
+latency_seconds 0.25
+`
+
+var expectedTestMetrics = map[string]float64{
+	"requests":        42,
+	"latency_seconds": 0.25,
+}
+
+func TestFileCollector(t *testing.T) {
+	f, err := ioutil.TempFile("", "metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(testMetrics)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, err := NewFileCollector(f.Name()).Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(metrics, expectedTestMetrics) {
+		t.Errorf("collected %v, expected %v", metrics, expectedTestMetrics)
+	}
+}
+
+func TestHttpCollector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testMetrics)
+	}))
+	defer server.Close()
+
+	metrics, err := NewHttpCollector(server.URL).Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(metrics, expectedTestMetrics) {
+		t.Errorf("collected %v, expected %v", metrics, expectedTestMetrics)
+	}
+}
+
+func TestHttpCollectorError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := NewHttpCollector(server.URL).Collect()
+	if err == nil {
+		t.Errorf("collecting from a failing endpoint should fail")
+	}
+}
@@ -27,12 +27,14 @@ const (
 	ListRecursive
 )
 
-// SubcontainerEventType indicates an addition or deletion event.
+// SubcontainerEventType indicates an addition or deletion event, or a change
+// of the spec of the container.
 type SubcontainerEventType int
 
 const (
 	SubcontainerAdd SubcontainerEventType = iota
 	SubcontainerDelete
+	SubcontainerSpecChanged
 )
 
 // SubcontainerEvent represents a
@@ -76,3 +78,24 @@ type ContainerHandler interface {
 	// Returns whether the container still exists.
 	Exists() bool
 }
+
+// Optionally implemented by a ContainerHandler that holds resources which must
+// be released once the container is no longer monitored.
+type Cleaner interface {
+	// Cleans up any resources held by the handler.
+	Cleanup()
+}
+
+// Returns the number of subcontainers of the container of handler, or of all
+// its descendants if recursive. The container itself is not counted.
+func CountContainers(handler ContainerHandler, recursive bool) (int, error) {
+	listType := ListSelf
+	if recursive {
+		listType = ListRecursive
+	}
+	containers, err := handler.ListContainers(listType)
+	if err != nil {
+		return 0, err
+	}
+	return len(containers), nil
+}
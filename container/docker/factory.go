@@ -72,6 +72,9 @@ type dockerFactory struct {
 
 	// Information about the mounted cgroup subsystems.
 	cgroupSubsystems libcontainer.CgroupSubsystems
+
+	// Optional stats and processes reported for containers.
+	statsOptions libcontainer.StatsOptions
 }
 
 func (self *dockerFactory) String() string {
@@ -90,6 +93,7 @@ func (self *dockerFactory) NewContainerHandler(name string) (handler container.C
 		*dockerRootDir,
 		self.usesAufsDriver,
 		&self.cgroupSubsystems,
+		self.statsOptions,
 	)
 	return
 }
@@ -172,7 +176,7 @@ func parseDockerVersion(full_version_string string) ([]int, error) {
 }
 
 // Register root container before running this function!
-func Register(factory info.MachineInfoFactory) error {
+func Register(factory info.MachineInfoFactory, statsOptions libcontainer.StatsOptions) error {
 	client, err := docker.NewClient(*ArgDockerEndpoint)
 	if err != nil {
 		return fmt.Errorf("unable to communicate with docker daemon: %v", err)
@@ -234,6 +238,7 @@ func Register(factory info.MachineInfoFactory) error {
 		client:             client,
 		usesAufsDriver:     usesAufsDriver,
 		cgroupSubsystems:   cgroupSubsystems,
+		statsOptions:       statsOptions,
 	}
 	container.RegisterContainerHandlerFactory(f)
 	return nil
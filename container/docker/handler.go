@@ -23,11 +23,13 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/docker/libcontainer"
 	"github.com/docker/libcontainer/cgroups"
 	cgroup_fs "github.com/docker/libcontainer/cgroups/fs"
 	"github.com/fsouza/go-dockerclient"
+	"github.com/golang/glog"
 	"github.com/google/cadvisor/container"
 	containerLibcontainer "github.com/google/cadvisor/container/libcontainer"
 	"github.com/google/cadvisor/fs"
@@ -68,6 +70,9 @@ type dockerContainerHandler struct {
 	usesAufsDriver bool
 	fsInfo         fs.FsInfo
 	storageDirs    []string
+
+	// Optional stats and processes reported.
+	statsOptions containerLibcontainer.StatsOptions
 }
 
 func DockerStateDir() string {
@@ -81,6 +86,7 @@ func newDockerContainerHandler(
 	dockerRootDir string,
 	usesAufsDriver bool,
 	cgroupSubsystems *containerLibcontainer.CgroupSubsystems,
+	statsOptions containerLibcontainer.StatsOptions,
 ) (container.ContainerHandler, error) {
 	// TODO(vmarmol): Get from factory.
 	fsInfo, err := fs.NewFsInfo()
@@ -111,6 +117,7 @@ func newDockerContainerHandler(
 		},
 		usesAufsDriver: usesAufsDriver,
 		fsInfo:         fsInfo,
+		statsOptions:   statsOptions,
 	}
 	handler.storageDirs = append(handler.storageDirs, path.Join(dockerRootDir, pathToAufsDir, id))
 
@@ -254,6 +261,16 @@ func (self *dockerContainerHandler) GetSpec() (spec info.ContainerSpec, err erro
 	return
 }
 
+// Filesystem stats are skipped for this round if the error is temporary so
+// the rest of the stats are still reported. Permanent errors are returned.
+func (self *dockerContainerHandler) handleFsError(err error) error {
+	if fs.IsTemporary(err) {
+		glog.Warningf("docker driver: Skipping filesystem stats of %q: %v", self.name, err)
+		return nil
+	}
+	return err
+}
+
 func (self *dockerContainerHandler) getFsStats(stats *info.ContainerStats) error {
 	// No support for non-aufs storage drivers.
 	if !self.usesAufsDriver {
@@ -264,7 +281,7 @@ func (self *dockerContainerHandler) getFsStats(stats *info.ContainerStats) error
 	// The first storage dir will be that of the image layers.
 	deviceInfo, err := self.fsInfo.GetDirFsDevice(self.storageDirs[0])
 	if err != nil {
-		return err
+		return self.handleFsError(err)
 	}
 
 	mi, err := self.machineInfoFactory.GetMachineInfo()
@@ -287,7 +304,7 @@ func (self *dockerContainerHandler) getFsStats(stats *info.ContainerStats) error
 		// TODO(Vishh): Add support for external mounts.
 		dirUsage, err := self.fsInfo.GetDirUsage(dir)
 		if err != nil {
-			return err
+			return self.handleFsError(err)
 		}
 		usage += dirUsage
 	}
@@ -297,13 +314,23 @@ func (self *dockerContainerHandler) getFsStats(stats *info.ContainerStats) error
 	return nil
 }
 
-func (self *dockerContainerHandler) GetStats() (stats *info.ContainerStats, err error) {
+func (self *dockerContainerHandler) GetStats() (*info.ContainerStats, error) {
+	start := time.Now()
+	stats, err := self.getStats()
+	if stats != nil {
+		stats.Timestamp = start
+		stats.CollectionDuration = time.Since(start)
+	}
+	return stats, err
+}
+
+func (self *dockerContainerHandler) getStats() (stats *info.ContainerStats, err error) {
 	state, err := self.readLibcontainerState()
 	if err != nil {
 		return nil, err
 	}
 
-	stats, err = containerLibcontainer.GetStats(self.cgroupPaths, state)
+	stats, err = containerLibcontainer.GetStats(self.cgroupPaths, state, ioutil.ReadFile, self.statsOptions)
 	if err != nil {
 		return stats, err
 	}
@@ -357,7 +384,11 @@ func (self *dockerContainerHandler) ListThreads(listType container.ListType) ([]
 }
 
 func (self *dockerContainerHandler) ListProcesses(listType container.ListType) ([]int, error) {
-	return cgroup_fs.GetPids(&self.cgroup)
+	pids, err := cgroup_fs.GetPids(&self.cgroup)
+	if err != nil {
+		return nil, err
+	}
+	return containerLibcontainer.FilterProcesses(pids, self.statsOptions), nil
 }
 
 func (self *dockerContainerHandler) WatchSubcontainers(events chan container.SubcontainerEvent) error {
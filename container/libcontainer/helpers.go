@@ -16,15 +16,41 @@ package libcontainer
 
 import (
 	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/docker/libcontainer"
 	"github.com/docker/libcontainer/cgroups"
 	cgroupfs "github.com/docker/libcontainer/cgroups/fs"
 	"github.com/docker/libcontainer/network"
+	"github.com/golang/glog"
 	"github.com/google/cadvisor/info"
+	"github.com/google/cadvisor/utils"
+	"github.com/google/cadvisor/utils/procfs"
+	"github.com/google/cadvisor/utils/qdisc"
+	"github.com/google/cadvisor/utils/sysinfo"
 )
 
+// Optional stats and processes reported for containers.
+type StatsOptions struct {
+	// Whether to report the stats of the queueing disciplines of the network
+	// interfaces of the network namespace of containers, read through netlink.
+	QdiscStats bool
+
+	// Whether to report the TCP retransmits, resets and listen drops of the
+	// network namespace of containers.
+	TcpAdvancedStats bool
+
+	// Whether to leave kernel threads out of the processes listed for
+	// containers.
+	ExcludeKernelThreads bool
+}
+
 type CgroupSubsystems struct {
 	// Cgroup subsystem mounts.
 	// e.g.: "/sys/fs/cgroup/cpu" -> ["cpu", "cpuacct"]
@@ -35,10 +61,13 @@ type CgroupSubsystems struct {
 	MountPoints map[string]string
 }
 
+// Mount table of cAdvisor, replaced in tests.
+var mountinfoFile = "/proc/self/mountinfo"
+
 // Get information about the cgroup subsystems.
 func GetCgroupSubsystems() (CgroupSubsystems, error) {
 	// Get all cgroup mounts.
-	allCgroups, err := cgroups.GetCgroupMounts()
+	allCgroups, err := getCgroupMounts()
 	if err != nil {
 		return CgroupSubsystems{}, err
 	}
@@ -64,22 +93,138 @@ func GetCgroupSubsystems() (CgroupSubsystems, error) {
 	}, nil
 }
 
-// Cgroup subsystems we support listing (should be the minimal set we need stats from).
+// Gets the cgroup hierarchies from the mount table: the v1 hierarchies with the
+// subsystems attached to them, and the unified (v2) hierarchy with the
+// controllers available at its root. Controllers of the unified hierarchy are
+// named after their v1 subsystem (the io controller is blkio). A controller
+// attached to a v1 hierarchy is not available on the unified one, so both can
+// be used together on hybrid hosts.
+func getCgroupMounts() ([]cgroups.Mount, error) {
+	out, err := ioutil.ReadFile(mountinfoFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var mounts []cgroups.Mount
+	for _, line := range strings.Split(string(out), "\n") {
+		// "$ID $PARENT_ID $MAJOR:$MINOR $ROOT $MOUNTPOINT $OPTIONS [$OPTIONAL...] - $FSTYPE $SOURCE $SUPER_OPTIONS"
+		fields := strings.Fields(line)
+		separator := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				separator = i
+				break
+			}
+		}
+		if separator == -1 || len(fields) < separator+4 {
+			continue
+		}
+		mountpoint := fields[4]
+		switch fields[separator+1] {
+		case "cgroup":
+			mounts = append(mounts, cgroups.Mount{
+				Mountpoint: mountpoint,
+				Subsystems: strings.Split(fields[separator+3], ","),
+			})
+		case "cgroup2":
+			controllers, err := ioutil.ReadFile(path.Join(mountpoint, "cgroup.controllers"))
+			if err != nil {
+				glog.Warningf("Failed to read the controllers of the unified cgroup hierarchy mounted at %q: %v", mountpoint, err)
+				continue
+			}
+			var subsystems []string
+			for _, controller := range strings.Fields(string(controllers)) {
+				if controller == "io" {
+					controller = "blkio"
+				}
+				subsystems = append(subsystems, controller)
+			}
+			mounts = append(mounts, cgroups.Mount{
+				Mountpoint: mountpoint,
+				Subsystems: subsystems,
+			})
+		}
+	}
+	return mounts, nil
+}
+
+// Cgroup membership of cAdvisor, replaced in tests.
+var selfCgroupFile = "/proc/self/cgroup"
+
+// Gets the cgroup of the current process in the hierarchy of the specified
+// subsystem. Falls back to its cgroup in the unified hierarchy (the "0::" line)
+// when no v1 hierarchy has the subsystem.
+func GetThisCgroupDir(subsystem string) (string, error) {
+	out, err := ioutil.ReadFile(selfCgroupFile)
+	if err != nil {
+		return "", err
+	}
+	unified := ""
+	found := false
+	// Each line is "$ID:$SUBSYSTEMS:$CGROUP".
+	for _, line := range strings.Split(string(out), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			unified = parts[2]
+			found = true
+			continue
+		}
+		for _, s := range strings.Split(parts[1], ",") {
+			if s == subsystem {
+				return parts[2], nil
+			}
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("failed to find the cgroup of subsystem %q in %q", subsystem, selfCgroupFile)
+	}
+	return unified, nil
+}
+
+// Cgroup subsystems we support listing (should be the minimal set we need stats
+// or the spec from).
 var supportedSubsystems map[string]struct{} = map[string]struct{}{
 	"cpu":     {},
 	"cpuacct": {},
 	"memory":  {},
 	"cpuset":  {},
 	"blkio":   {},
+	"devices": {},
+	"rdma":    {},
+	"misc":    {},
+}
+
+// Reads a cgroup file, e.g. with a timeout. Errors satisfy os.IsNotExist when
+// the file is missing.
+type ReadFileFunc func(file string) ([]byte, error)
+
+// Reads a cgroup file with readFile, nil when the file is missing.
+func readOptionalFile(readFile ReadFileFunc, file string) ([]byte, error) {
+	out, err := readFile(file)
+	if err != nil && os.IsNotExist(err) {
+		return nil, nil
+	}
+	return out, err
 }
 
-// Get stats of the specified container
-func GetStats(cgroupPaths map[string]string, state *libcontainer.State) (*info.ContainerStats, error) {
+// Get stats of the specified container. The files of the v1 hierarchies are
+// read by libcontainer, the others with readFile.
+func GetStats(cgroupPaths map[string]string, state *libcontainer.State, readFile ReadFileFunc, options StatsOptions) (*info.ContainerStats, error) {
 	// TODO(vmarmol): Use libcontainer's Stats() in the new API when that is ready.
+	start := time.Now()
 	stats := &libcontainer.ContainerStats{}
 
+	// Libcontainer only reads the cgroups of the v1 hierarchies.
+	v1Paths, unifiedPaths := splitUnifiedCgroupPaths(cgroupPaths)
 	var err error
-	stats.CgroupStats, err = cgroupfs.GetStats(cgroupPaths)
+	stats.CgroupStats, err = cgroupfs.GetStats(v1Paths)
+	if err != nil {
+		return &info.ContainerStats{}, err
+	}
+	err = addUnifiedCgroupStats(readFile, stats.CgroupStats, unifiedPaths)
 	if err != nil {
 		return &info.ContainerStats{}, err
 	}
@@ -89,7 +234,418 @@ func GetStats(cgroupPaths map[string]string, state *libcontainer.State) (*info.C
 		return &info.ContainerStats{}, err
 	}
 
-	return toContainerStats(stats), nil
+	ret := toContainerStats(stats)
+	ret.Timestamp = start
+	if cpuPath, ok := unifiedPaths["cpu"]; ok {
+		err = setUnifiedCpuUsage(readFile, ret, cpuPath)
+		if err != nil {
+			return ret, err
+		}
+	}
+
+	if state.InitPid != 0 {
+		err = AddNamespaceNetworkStats(&ret.Network, state.InitPid, options)
+		if err != nil {
+			return ret, err
+		}
+	}
+
+	// Libcontainer does not know about the rdma controller.
+	if rdmaPath, ok := cgroupPaths["rdma"]; ok {
+		ret.Rdma, err = getRdmaStats(readFile, rdmaPath)
+		if err != nil {
+			return ret, err
+		}
+	}
+
+	// Nor about the misc controller.
+	if miscPath, ok := cgroupPaths["misc"]; ok {
+		ret.Misc, err = getMiscStats(readFile, miscPath)
+		if err != nil {
+			return ret, err
+		}
+	}
+
+	// Nor about memory.events, only found on the unified hierarchy.
+	if memoryPath, ok := unifiedPaths["memory"]; ok {
+		ret.Memory.Events, err = getMemoryEvents(readFile, memoryPath)
+		if err != nil {
+			return ret, err
+		}
+	}
+
+	return ret, nil
+}
+
+// Splits cgroup paths into those of the v1 hierarchies and those of the unified
+// (v2) hierarchy, whose cgroups all have a cgroup.controllers file.
+func splitUnifiedCgroupPaths(cgroupPaths map[string]string) (v1Paths, unifiedPaths map[string]string) {
+	v1Paths = make(map[string]string, len(cgroupPaths))
+	unifiedPaths = make(map[string]string)
+	for subsystem, cgroupPath := range cgroupPaths {
+		if utils.FileExists(path.Join(cgroupPath, "cgroup.controllers")) {
+			unifiedPaths[subsystem] = cgroupPath
+		} else {
+			v1Paths[subsystem] = cgroupPath
+		}
+	}
+	return v1Paths, unifiedPaths
+}
+
+// Adds the memory and io stats of the cgroups of the unified hierarchy to
+// stats, as libcontainer reports those of the v1 hierarchies. Missing files,
+// such as memory.current in the root cgroup, leave the stats empty.
+func addUnifiedCgroupStats(readFile ReadFileFunc, stats *cgroups.Stats, unifiedPaths map[string]string) error {
+	if memoryPath, ok := unifiedPaths["memory"]; ok {
+		var err error
+		stats.MemoryStats.Usage, err = readUnifiedUint(readFile, path.Join(memoryPath, "memory.current"))
+		if err != nil {
+			return err
+		}
+		stats.MemoryStats.MaxUsage, err = readUnifiedUint(readFile, path.Join(memoryPath, "memory.peak"))
+		if err != nil {
+			return err
+		}
+		stats.MemoryStats.Stats, err = readUnifiedKeyValues(readFile, path.Join(memoryPath, "memory.stat"))
+		if err != nil {
+			return err
+		}
+		// The working set of v1 hierarchies is computed from the
+		// hierarchical totals.
+		if v, ok := stats.MemoryStats.Stats["inactive_anon"]; ok {
+			stats.MemoryStats.Stats["total_inactive_anon"] = v
+		}
+		if v, ok := stats.MemoryStats.Stats["active_file"]; ok {
+			stats.MemoryStats.Stats["total_active_file"] = v
+		}
+	}
+	if ioPath, ok := unifiedPaths["blkio"]; ok {
+		ioStatFile := path.Join(ioPath, "io.stat")
+		out, err := readOptionalFile(readFile, ioStatFile)
+		if err != nil {
+			return err
+		}
+		// Each line is a device: "8:0 rbytes=4096 wbytes=0 rios=1 wios=0 dbytes=0 dios=0".
+		for _, line := range strings.Split(string(out), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			var major, minor uint64
+			if _, err := fmt.Sscanf(fields[0], "%d:%d", &major, &minor); err != nil {
+				return fmt.Errorf("failed to parse device %q in %q: %v", fields[0], ioStatFile, err)
+			}
+			for _, field := range fields[1:] {
+				kv := strings.SplitN(field, "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				value, err := strconv.ParseUint(kv[1], 10, 64)
+				if err != nil {
+					return fmt.Errorf("failed to parse %q in %q: %v", field, ioStatFile, err)
+				}
+				entry := cgroups.BlkioStatEntry{Major: major, Minor: minor, Value: value}
+				switch kv[0] {
+				case "rbytes":
+					entry.Op = "Read"
+					stats.BlkioStats.IoServiceBytesRecursive = append(stats.BlkioStats.IoServiceBytesRecursive, entry)
+				case "wbytes":
+					entry.Op = "Write"
+					stats.BlkioStats.IoServiceBytesRecursive = append(stats.BlkioStats.IoServiceBytesRecursive, entry)
+				case "rios":
+					entry.Op = "Read"
+					stats.BlkioStats.IoServicedRecursive = append(stats.BlkioStats.IoServicedRecursive, entry)
+				case "wios":
+					entry.Op = "Write"
+					stats.BlkioStats.IoServicedRecursive = append(stats.BlkioStats.IoServicedRecursive, entry)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Sets the cpu usage and throttled time from the cpu.stat file of the cpu
+// cgroup of the unified hierarchy at the specified path, reported in
+// microseconds. There is no usage per cpu.
+func setUnifiedCpuUsage(readFile ReadFileFunc, ret *info.ContainerStats, cpuPath string) error {
+	stat, err := readUnifiedKeyValues(readFile, path.Join(cpuPath, "cpu.stat"))
+	if err != nil {
+		return err
+	}
+	ret.Cpu.Usage.Total = stat["usage_usec"] * uint64(time.Microsecond)
+	ret.Cpu.Usage.User = stat["user_usec"] * uint64(time.Microsecond)
+	ret.Cpu.Usage.System = stat["system_usec"] * uint64(time.Microsecond)
+	ret.Cpu.ThrottledTime = stat["throttled_usec"] * uint64(time.Microsecond)
+	return nil
+}
+
+// Reads a cgroup file of a single integer, zero when the file is missing.
+func readUnifiedUint(readFile ReadFileFunc, file string) (uint64, error) {
+	out, err := readOptionalFile(readFile, file)
+	if err != nil || out == nil {
+		return 0, err
+	}
+	value, err := strconv.ParseUint(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %q: %v", file, err)
+	}
+	return value, nil
+}
+
+// Reads a cgroup file of "key value" lines (e.g. memory.stat), nil when the
+// file is missing.
+func readUnifiedKeyValues(readFile ReadFileFunc, file string) (map[string]uint64, error) {
+	out, err := readOptionalFile(readFile, file)
+	if err != nil || out == nil {
+		return nil, err
+	}
+	values := make(map[string]uint64)
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("malformed line %q in %q", line, file)
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q in %q: %v", line, file, err)
+		}
+		values[fields[0]] = value
+	}
+	return values, nil
+}
+
+// Files read by GetStats in the cgroup of each subsystem, through libcontainer
+// or directly. Libcontainer reads the blkio files of the CFQ scheduler when
+// blkio.io_serviced_recursive exists and the throttling files otherwise.
+var statsFiles = map[string][]string{
+	"cpu":     {"cpu.stat"},
+	"cpuacct": {"cpuacct.stat", "cpuacct.usage", "cpuacct.usage_percpu"},
+	"memory":  {"memory.stat", "memory.usage_in_bytes", "memory.max_usage_in_bytes", "memory.failcnt"},
+	"blkio":   {"blkio.io_serviced_recursive", "blkio.sectors_recursive", "blkio.io_service_bytes_recursive", "blkio.io_queued_recursive", "blkio.io_service_time_recursive", "blkio.io_wait_time_recursive", "blkio.io_merged_recursive", "blkio.time_recursive"},
+}
+
+var blkioThrottleStatsFiles = []string{"blkio.throttle.io_service_bytes", "blkio.throttle.io_serviced"}
+
+// Number of files of the veth of the container read by libcontainer.
+const vethStatsFiles = 8
+
+// Counts the files libcontainer reads in GetStats to get the stats of the
+// specified cgroups and network state, those that exist. A file read twice is
+// counted once. The files read with the ReadFileFunc of GetStats, those of the
+// unified hierarchy and of the controllers libcontainer does not know about,
+// and the namespace network stats, read from /proc, are not counted.
+func CountStatsFiles(cgroupPaths map[string]string, state *libcontainer.State) uint64 {
+	var count uint64
+	v1Paths, _ := splitUnifiedCgroupPaths(cgroupPaths)
+	for subsystem, cgroupPath := range v1Paths {
+		files, ok := statsFiles[subsystem]
+		if !ok {
+			continue
+		}
+		if subsystem == "blkio" && !utils.FileExists(path.Join(cgroupPath, files[0])) {
+			files = blkioThrottleStatsFiles
+		}
+		for _, file := range files {
+			if utils.FileExists(path.Join(cgroupPath, file)) {
+				count++
+			}
+		}
+	}
+	if state.NetworkState.VethHost != "" {
+		count += vethStatsFiles
+	}
+	return count
+}
+
+// Get the usage and limits of the resources (e.g. SEV ASIDs) of the misc
+// cgroup at the specified path.
+func getMiscStats(readFile ReadFileFunc, miscPath string) (info.MiscStats, error) {
+	var stats info.MiscStats
+	var err error
+	stats.Usage, err = parseMiscFile(readFile, path.Join(miscPath, "misc.current"))
+	if err != nil {
+		return stats, err
+	}
+	stats.Limit, err = parseMiscFile(readFile, path.Join(miscPath, "misc.max"))
+	if err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// Parse a misc.current or misc.max file. Each line describes a resource (e.g.
+// "sev 10"), "max" being unlimited. A missing file (no misc controller) yields
+// no resources.
+func parseMiscFile(readFile ReadFileFunc, miscFile string) ([]info.MiscResourceStats, error) {
+	out, err := readOptionalFile(readFile, miscFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []info.MiscResourceStats
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("malformed line %q in %q", line, miscFile)
+		}
+		value := uint64(math.MaxUint64)
+		if fields[1] != "max" {
+			value, err = strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %q in %q: %v", line, miscFile, err)
+			}
+		}
+		resources = append(resources, info.MiscResourceStats{
+			Resource: fields[0],
+			Value:    value,
+		})
+	}
+	return resources, nil
+}
+
+// Get the memory event counters from the memory.events file of the memory
+// cgroup at the specified path. The file has a "key value" line per counter,
+// counters missing from it (e.g. oom_kill on older kernels) are zero, as are
+// all of them when the file is missing (v1 hierarchy).
+func getMemoryEvents(readFile ReadFileFunc, memoryPath string) (info.MemoryEventsStats, error) {
+	var events info.MemoryEventsStats
+	eventsFile := path.Join(memoryPath, "memory.events")
+	out, err := readOptionalFile(readFile, eventsFile)
+	if err != nil {
+		return events, err
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return events, fmt.Errorf("malformed line %q in %q", line, eventsFile)
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return events, fmt.Errorf("failed to parse %q in %q: %v", line, eventsFile, err)
+		}
+		switch fields[0] {
+		case "low":
+			events.Low = value
+		case "high":
+			events.High = value
+		case "max":
+			events.Max = value
+		case "oom":
+			events.Oom = value
+		case "oom_kill":
+			events.OomKill = value
+		}
+	}
+	return events, nil
+}
+
+// Filter the processes listed for a container, leaving out kernel threads if
+// options exclude them.
+func FilterProcesses(pids []int, options StatsOptions) []int {
+	if !options.ExcludeKernelThreads {
+		return pids
+	}
+	return procfs.FilterKernelThreads("/proc", pids)
+}
+
+// Add the stats of the network namespace of the specified process to stats:
+// the IPv6 traffic when IPv6 is enabled, and the TCP health counters and the
+// qdisc stats if options enable them. A pid of 0 uses the namespace of
+// cAdvisor.
+func AddNamespaceNetworkStats(stats *info.NetworkStats, pid int, options StatsOptions) error {
+	netDir := "/proc/net"
+	if pid != 0 {
+		netDir = fmt.Sprintf("/proc/%d/net", pid)
+	}
+	var err error
+	// Without IPv6 there is no snmp6 file and no stats.
+	stats.Ipv6, err = sysinfo.GetIpv6Stats(path.Join(netDir, "snmp6"))
+	if err != nil {
+		return err
+	}
+	if options.TcpAdvancedStats {
+		stats.TcpAdvanced, err = sysinfo.GetTcpAdvancedStats(path.Join(netDir, "snmp"), path.Join(netDir, "netstat"))
+		if err != nil {
+			return err
+		}
+	}
+	if options.QdiscStats {
+		// The interface stats are still reported when netlink is not
+		// available, e.g. without CAP_SYS_ADMIN to enter the namespace.
+		stats.Qdiscs, err = qdisc.GetQdiscStats(pid)
+		if err != nil {
+			glog.V(4).Infof("Failed to get the qdisc stats of the network namespace of process %d: %v", pid, err)
+		}
+	}
+	return nil
+}
+
+// Get the RDMA usage and limits from the rdma cgroup at the specified path.
+func getRdmaStats(readFile ReadFileFunc, rdmaPath string) (info.RdmaStats, error) {
+	var stats info.RdmaStats
+	var err error
+	stats.Usage, err = parseRdmaFile(readFile, path.Join(rdmaPath, "rdma.current"))
+	if err != nil {
+		return stats, err
+	}
+	stats.Limit, err = parseRdmaFile(readFile, path.Join(rdmaPath, "rdma.max"))
+	if err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// Parse an rdma.current or rdma.max file. Each line describes a device (e.g.
+// "mlx5_0 hca_handle=2 hca_object=10"). A missing file (no rdma controller)
+// yields no devices.
+func parseRdmaFile(readFile ReadFileFunc, rdmaFile string) ([]info.RdmaDeviceStats, error) {
+	out, err := readOptionalFile(readFile, rdmaFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []info.RdmaDeviceStats
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		device := info.RdmaDeviceStats{
+			Device: fields[0],
+		}
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("malformed field %q in %q", field, rdmaFile)
+			}
+			value := uint64(math.MaxUint64)
+			if kv[1] != "max" {
+				value, err = strconv.ParseUint(kv[1], 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse %q in %q: %v", field, rdmaFile, err)
+				}
+			}
+			switch kv[0] {
+			case "hca_handle":
+				device.HcaHandles = value
+			case "hca_object":
+				device.HcaObjects = value
+			}
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
 }
 
 func DiskStatsCopy(blkio_stats []cgroups.BlkioStatEntry) (stat []info.PerDiskStats) {
@@ -133,11 +689,118 @@ func DiskStatsCopy(blkio_stats []cgroups.BlkioStatEntry) (stat []info.PerDiskSta
 	return
 }
 
+// Same as DiskStatsCopy but drops the per-device "Total" entries. The kernel
+// reports latencies once per read/write and once per sync/async, so the total
+// is not a meaningful latency.
+func DiskLatencyStatsCopy(blkio_stats []cgroups.BlkioStatEntry) []info.PerDiskStats {
+	filtered := make([]cgroups.BlkioStatEntry, 0, len(blkio_stats))
+	for _, entry := range blkio_stats {
+		if entry.Op == "Total" {
+			continue
+		}
+		filtered = append(filtered, entry)
+	}
+	return DiskStatsCopy(filtered)
+}
+
+// Gets the reclaim counters from the parsed memory.stat of a container. The
+// totals are summed from the kswapd and direct counters when the kernel does
+// not report them.
+func memoryReclaimStats(stats map[string]uint64) info.MemoryReclaimStats {
+	ret := info.MemoryReclaimStats{
+		PgscanKswapd:  stats["pgscan_kswapd"],
+		PgscanDirect:  stats["pgscan_direct"],
+		PgstealKswapd: stats["pgsteal_kswapd"],
+		PgstealDirect: stats["pgsteal_direct"],
+	}
+	if v, ok := stats["pgscan"]; ok {
+		ret.Pgscan = v
+	} else {
+		ret.Pgscan = ret.PgscanKswapd + ret.PgscanDirect
+	}
+	if v, ok := stats["pgsteal"]; ok {
+		ret.Pgsteal = v
+	} else {
+		ret.Pgsteal = ret.PgstealKswapd + ret.PgstealDirect
+	}
+	return ret
+}
+
+// Gets the slab memory from the parsed memory.stat of a container. Only the
+// unified (v2) hierarchy reports it, zero otherwise.
+func memorySlabStats(stats map[string]uint64) info.MemorySlabStats {
+	return info.MemorySlabStats{
+		Reclaimable:   stats["slab_reclaimable"],
+		Unreclaimable: stats["slab_unreclaimable"],
+	}
+}
+
+// Gets the refaults from the parsed memory.stat of a container. Kernels since
+// 5.9 split them between anonymous and page cache pages, earlier kernels only
+// report the page cache refaults and older ones none at all.
+func memoryRefaultStats(stats map[string]uint64) info.MemoryRefaultStats {
+	ret := info.MemoryRefaultStats{
+		Anon:         stats["workingset_refault_anon"],
+		ActivateAnon: stats["workingset_activate_anon"],
+	}
+	if v, ok := stats["workingset_refault_file"]; ok {
+		ret.File = v
+	} else {
+		ret.File = stats["workingset_refault"]
+	}
+	if v, ok := stats["workingset_activate_file"]; ok {
+		ret.ActivateFile = v
+	} else {
+		ret.ActivateFile = stats["workingset_activate"]
+	}
+	return ret
+}
+
+// Gets the shared memory and the anonymous memory plus page cache without it
+// from the parsed memory.stat of a container. The hierarchical counters of v1
+// hierarchies are used when present, the unified hierarchy only has
+// hierarchical counters. The shared memory is zero on kernels that do not
+// report it.
+func memoryShmemStats(stats map[string]uint64) (shmem uint64, withoutShmem uint64) {
+	get := func(keys ...string) uint64 {
+		for _, key := range keys {
+			if v, ok := stats[key]; ok {
+				return v
+			}
+		}
+		return 0
+	}
+	shmem = get("total_shmem", "shmem")
+	usage := get("total_rss", "rss", "anon") + get("total_cache", "cache", "file")
+	if usage < shmem {
+		return shmem, 0
+	}
+	return shmem, usage - shmem
+}
+
+// Splits the usage of a container between the memory that can be reclaimed
+// under pressure, the inactive page cache and the reclaimable slab, and the
+// rest, from its parsed memory.stat. The hierarchical counters of v1
+// hierarchies are used when present, v1 hierarchies do not report the slab.
+// Both are zero when the inactive page cache is not reported.
+func memoryReclaimableStats(usage uint64, stats map[string]uint64) (reclaimable uint64, unreclaimable uint64) {
+	inactiveFile, ok := stats["total_inactive_file"]
+	if !ok {
+		if inactiveFile, ok = stats["inactive_file"]; !ok {
+			return 0, 0
+		}
+	}
+	reclaimable = inactiveFile + stats["slab_reclaimable"]
+	if reclaimable > usage {
+		return usage, 0
+	}
+	return reclaimable, usage - reclaimable
+}
+
 // Convert libcontainer stats to info.ContainerStats.
 func toContainerStats(libcontainerStats *libcontainer.ContainerStats) *info.ContainerStats {
 	s := libcontainerStats.CgroupStats
 	ret := new(info.ContainerStats)
-	ret.Timestamp = time.Now()
 
 	if s != nil {
 		ret.Cpu.Usage.User = s.CpuStats.CpuUsage.UsageInUsermode
@@ -145,6 +808,8 @@ func toContainerStats(libcontainerStats *libcontainer.ContainerStats) *info.Cont
 		n := len(s.CpuStats.CpuUsage.PercpuUsage)
 		ret.Cpu.Usage.PerCpu = make([]uint64, n)
 
+		ret.Cpu.ThrottledTime = s.CpuStats.ThrottlingData.ThrottledTime
+
 		ret.Cpu.Usage.Total = 0
 		for i := 0; i < n; i++ {
 			ret.Cpu.Usage.PerCpu[i] = s.CpuStats.CpuUsage.PercpuUsage[i]
@@ -155,8 +820,8 @@ func toContainerStats(libcontainerStats *libcontainer.ContainerStats) *info.Cont
 		ret.DiskIo.IoServiced = DiskStatsCopy(s.BlkioStats.IoServicedRecursive)
 		ret.DiskIo.IoQueued = DiskStatsCopy(s.BlkioStats.IoQueuedRecursive)
 		ret.DiskIo.Sectors = DiskStatsCopy(s.BlkioStats.SectorsRecursive)
-		ret.DiskIo.IoServiceTime = DiskStatsCopy(s.BlkioStats.IoServiceTimeRecursive)
-		ret.DiskIo.IoWaitTime = DiskStatsCopy(s.BlkioStats.IoWaitTimeRecursive)
+		ret.DiskIo.IoServiceTime = DiskLatencyStatsCopy(s.BlkioStats.IoServiceTimeRecursive)
+		ret.DiskIo.IoWaitTime = DiskLatencyStatsCopy(s.BlkioStats.IoWaitTimeRecursive)
 		ret.DiskIo.IoMerged = DiskStatsCopy(s.BlkioStats.IoMergedRecursive)
 		ret.DiskIo.IoTime = DiskStatsCopy(s.BlkioStats.IoTimeRecursive)
 
@@ -169,6 +834,11 @@ func toContainerStats(libcontainerStats *libcontainer.ContainerStats) *info.Cont
 			ret.Memory.ContainerData.Pgmajfault = v
 			ret.Memory.HierarchicalData.Pgmajfault = v
 		}
+		ret.Memory.Reclaim = memoryReclaimStats(s.MemoryStats.Stats)
+		ret.Memory.Slab = memorySlabStats(s.MemoryStats.Stats)
+		ret.Memory.Refault = memoryRefaultStats(s.MemoryStats.Stats)
+		ret.Memory.Shmem, ret.Memory.UsageWithoutShmem = memoryShmemStats(s.MemoryStats.Stats)
+		ret.Memory.ReclaimableMemory, ret.Memory.UnreclaimableMemory = memoryReclaimableStats(ret.Memory.Usage, s.MemoryStats.Stats)
 		if v, ok := s.MemoryStats.Stats["total_inactive_anon"]; ok {
 			ret.Memory.WorkingSet = ret.Memory.Usage - v
 			if v, ok := s.MemoryStats.Stats["total_active_file"]; ok {
@@ -176,9 +846,15 @@ func toContainerStats(libcontainerStats *libcontainer.ContainerStats) *info.Cont
 			}
 		}
 	}
-	// TODO(vishh): Perform a deep copy or alias libcontainer network stats.
-	if libcontainerStats.NetworkStats != nil {
-		ret.Network = *(*info.NetworkStats)(libcontainerStats.NetworkStats)
+	if n := libcontainerStats.NetworkStats; n != nil {
+		ret.Network.RxBytes = n.RxBytes
+		ret.Network.RxPackets = n.RxPackets
+		ret.Network.RxErrors = n.RxErrors
+		ret.Network.RxDropped = n.RxDropped
+		ret.Network.TxBytes = n.TxBytes
+		ret.Network.TxPackets = n.TxPackets
+		ret.Network.TxErrors = n.TxErrors
+		ret.Network.TxDropped = n.TxDropped
 	}
 
 	return ret
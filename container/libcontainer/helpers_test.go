@@ -0,0 +1,450 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcontainer
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/docker/libcontainer"
+	"github.com/docker/libcontainer/cgroups"
+	cgroupfs "github.com/docker/libcontainer/cgroups/fs"
+	"github.com/google/cadvisor/info"
+)
+
+func TestDiskLatencyStatsCopy(t *testing.T) {
+	// Mirrors blkio.io_wait_time_recursive with one device.
+	entries := []cgroups.BlkioStatEntry{
+		{Major: 8, Minor: 0, Op: "Read", Value: 1200},
+		{Major: 8, Minor: 0, Op: "Write", Value: 3400},
+		{Major: 8, Minor: 0, Op: "Sync", Value: 4000},
+		{Major: 8, Minor: 0, Op: "Async", Value: 600},
+		{Major: 8, Minor: 0, Op: "Total", Value: 4600},
+	}
+	stats := DiskLatencyStatsCopy(entries)
+	if len(stats) != 1 {
+		t.Fatalf("expected stats for 1 device, got %+v", stats)
+	}
+	if stats[0].Major != 8 || stats[0].Minor != 0 {
+		t.Errorf("expected stats for device 8:0, got %d:%d", stats[0].Major, stats[0].Minor)
+	}
+	expected := map[string]uint64{
+		"Read":  1200,
+		"Write": 3400,
+		"Sync":  4000,
+		"Async": 600,
+	}
+	if !reflect.DeepEqual(stats[0].Stats, expected) {
+		t.Errorf("expected latencies %v, got %v", expected, stats[0].Stats)
+	}
+}
+
+// Writes a mount table to a temporary file used as mountinfoFile. Returns a
+// function restoring it.
+func setMountinfo(t *testing.T, mountinfo string) func() {
+	f, err := ioutil.TempFile("", "mountinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(mountinfo); err != nil {
+		t.Fatal(err)
+	}
+	orig := mountinfoFile
+	mountinfoFile = f.Name()
+	return func() {
+		mountinfoFile = orig
+		os.Remove(f.Name())
+	}
+}
+
+func TestGetCgroupSubsystems(t *testing.T) {
+	defer setMountinfo(t, `23 1 0:21 / /sys/fs/cgroup rw,nosuid,nodev,noexec shared:2 - tmpfs tmpfs ro,mode=755
+25 23 0:23 / /sys/fs/cgroup/cpu,cpuacct rw,nosuid,nodev,noexec,relatime shared:6 - cgroup cgroup rw,cpu,cpuacct
+26 23 0:24 / /sys/fs/cgroup/devices rw,nosuid,nodev,noexec,relatime shared:7 - cgroup cgroup rw,devices
+27 23 0:25 / /sys/fs/cgroup/freezer rw,nosuid,nodev,noexec,relatime - cgroup cgroup rw,freezer
+`)()
+
+	subsystems, err := GetCgroupSubsystems()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"cpu":     "/sys/fs/cgroup/cpu,cpuacct",
+		"cpuacct": "/sys/fs/cgroup/cpu,cpuacct",
+		"devices": "/sys/fs/cgroup/devices",
+	}
+	if !reflect.DeepEqual(subsystems.MountPoints, expected) {
+		t.Errorf("expected mount points %v, got %v", expected, subsystems.MountPoints)
+	}
+}
+
+// Writes the files of a cgroup of the unified hierarchy.
+func writeCgroupFiles(t *testing.T, dir string, files map[string]string) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(path.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetStatsUnified(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	writeCgroupFiles(t, root, map[string]string{
+		"cgroup.controllers": "cpuset cpu io memory pids\n",
+	})
+	writeCgroupFiles(t, path.Join(root, "test"), map[string]string{
+		"cgroup.controllers": "cpu io memory\n",
+		"cpu.stat":           "usage_usec 3000\nuser_usec 2000\nsystem_usec 1000\nnr_periods 4\nnr_throttled 1\nthrottled_usec 50\n",
+		"memory.current":     "8192\n",
+		"memory.stat":        "anon 4096\nfile 4096\ninactive_anon 1024\nactive_file 2048\n",
+		"io.stat":            "8:0 rbytes=4096 wbytes=512 rios=2 wios=1 dbytes=0 dios=0\n",
+	})
+	defer setMountinfo(t, "30 23 0:26 / "+root+" rw,nosuid,nodev,noexec,relatime shared:4 - cgroup2 cgroup2 rw,nsdelegate\n")()
+
+	subsystems, err := GetCgroupSubsystems()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedMountPoints := map[string]string{
+		"cpuset": root,
+		"cpu":    root,
+		"blkio":  root,
+		"memory": root,
+	}
+	if !reflect.DeepEqual(subsystems.MountPoints, expectedMountPoints) {
+		t.Fatalf("expected mount points %v, got %v", expectedMountPoints, subsystems.MountPoints)
+	}
+
+	cgroupPaths := make(map[string]string)
+	for subsystem, mountpoint := range subsystems.MountPoints {
+		cgroupPaths[subsystem] = path.Join(mountpoint, "test")
+	}
+	stats, err := GetStats(cgroupPaths, &libcontainer.State{}, ioutil.ReadFile, StatsOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Cpu.Usage.Total != 3000000 || stats.Cpu.Usage.User != 2000000 || stats.Cpu.Usage.System != 1000000 {
+		t.Errorf("expected a cpu usage of 3ms (2ms user, 1ms system), got %+v", stats.Cpu.Usage)
+	}
+	if stats.Cpu.ThrottledTime != 50000 {
+		t.Errorf("expected a throttled time of 50us, got %d", stats.Cpu.ThrottledTime)
+	}
+	if stats.Memory.Usage != 8192 || stats.Memory.WorkingSet != 8192-1024-2048 {
+		t.Errorf("expected a memory usage of 8192 and a working set of %d, got %+v", 8192-1024-2048, stats.Memory)
+	}
+	expectedIo := []info.PerDiskStats{
+		{Major: 8, Minor: 0, Stats: map[string]uint64{"Read": 4096, "Write": 512}},
+	}
+	if !reflect.DeepEqual(stats.DiskIo.IoServiceBytes, expectedIo) {
+		t.Errorf("expected io service bytes %+v, got %+v", expectedIo, stats.DiskIo.IoServiceBytes)
+	}
+}
+
+func TestGetThisCgroupDir(t *testing.T) {
+	f, err := ioutil.TempFile("", "cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("0::/system.slice/cadvisor.service\n")
+	f.Close()
+	defer func(orig string) { selfCgroupFile = orig }(selfCgroupFile)
+	selfCgroupFile = f.Name()
+
+	dir, err := GetThisCgroupDir("cpu")
+	if err != nil || dir != "/system.slice/cadvisor.service" {
+		t.Errorf("expected the cgroup of the unified hierarchy, got %q (%v)", dir, err)
+	}
+}
+
+func TestGetRdmaStats(t *testing.T) {
+	stats, err := getRdmaStats(ioutil.ReadFile, "test_resources")
+	if err != nil {
+		t.Fatalf("failed to get rdma stats: %v", err)
+	}
+	expected := info.RdmaStats{
+		Usage: []info.RdmaDeviceStats{
+			{Device: "mlx5_0", HcaHandles: 2, HcaObjects: 10},
+			{Device: "mlx5_1", HcaHandles: 1, HcaObjects: 4},
+		},
+		Limit: []info.RdmaDeviceStats{
+			{Device: "mlx5_0", HcaHandles: 8, HcaObjects: math.MaxUint64},
+			{Device: "mlx5_1", HcaHandles: math.MaxUint64, HcaObjects: math.MaxUint64},
+		},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("expected rdma stats %+v, got %+v", expected, stats)
+	}
+}
+
+func TestGetRdmaStatsNoController(t *testing.T) {
+	stats, err := getRdmaStats(ioutil.ReadFile, "/dir_does_not_exist")
+	if err != nil {
+		t.Fatalf("getRdmaStats must not error for absent controller: %v", err)
+	}
+	if len(stats.Usage) != 0 || len(stats.Limit) != 0 {
+		t.Errorf("expected no rdma stats, got %+v", stats)
+	}
+}
+
+func TestSetUnifiedCpuUsage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stats := &info.ContainerStats{}
+	if err := setUnifiedCpuUsage(ioutil.ReadFile, stats, dir); err != nil || stats.Cpu.ThrottledTime != 0 {
+		t.Errorf("expected no throttled time without cpu.stat, got %d (%v)", stats.Cpu.ThrottledTime, err)
+	}
+	stat := "usage_usec 50000\nuser_usec 30000\nsystem_usec 20000\nnr_periods 10\nnr_throttled 2\nthrottled_usec 1500\n"
+	if err := ioutil.WriteFile(path.Join(dir, "cpu.stat"), []byte(stat), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := setUnifiedCpuUsage(ioutil.ReadFile, stats, dir); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Cpu.ThrottledTime != 1500000 {
+		t.Errorf("expected a throttled time of 1500000ns, got %d", stats.Cpu.ThrottledTime)
+	}
+	if stats.Cpu.Usage.Total != 50000000 {
+		t.Errorf("expected a cpu usage of 50000000ns, got %d", stats.Cpu.Usage.Total)
+	}
+}
+
+func TestGetMiscStats(t *testing.T) {
+	stats, err := getMiscStats(ioutil.ReadFile, "test_resources")
+	if err != nil {
+		t.Fatalf("failed to get misc stats: %v", err)
+	}
+	expected := info.MiscStats{
+		Usage: []info.MiscResourceStats{
+			{Resource: "sev", Value: 10},
+			{Resource: "sev_es", Value: 0},
+		},
+		Limit: []info.MiscResourceStats{
+			{Resource: "sev", Value: 16},
+			{Resource: "sev_es", Value: math.MaxUint64},
+		},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("expected misc stats %+v, got %+v", expected, stats)
+	}
+}
+
+func TestGetMiscStatsNoController(t *testing.T) {
+	stats, err := getMiscStats(ioutil.ReadFile, "/dir_does_not_exist")
+	if err != nil {
+		t.Fatalf("getMiscStats must not error for absent controller: %v", err)
+	}
+	if len(stats.Usage) != 0 || len(stats.Limit) != 0 {
+		t.Errorf("expected no misc stats, got %+v", stats)
+	}
+}
+
+func TestGetMemoryEvents(t *testing.T) {
+	events, err := getMemoryEvents(ioutil.ReadFile, "test_resources/memory")
+	if err != nil {
+		t.Fatalf("failed to get memory events: %v", err)
+	}
+	expected := info.MemoryEventsStats{
+		High:    1784,
+		Max:     312,
+		Oom:     3,
+		OomKill: 2,
+	}
+	if events != expected {
+		t.Errorf("expected memory events %+v, got %+v", expected, events)
+	}
+
+	// Not reported on v1 hierarchies.
+	events, err = getMemoryEvents(ioutil.ReadFile, "/dir_does_not_exist")
+	if err != nil {
+		t.Fatalf("getMemoryEvents must not error for a missing memory.events: %v", err)
+	}
+	if events != (info.MemoryEventsStats{}) {
+		t.Errorf("expected no memory events, got %+v", events)
+	}
+}
+
+func TestCountStatsFiles(t *testing.T) {
+	// The memory files read by libcontainer and the files of the veth.
+	state := &libcontainer.State{}
+	state.NetworkState.VethHost = "veth24031eth1"
+	count := CountStatsFiles(map[string]string{
+		"memory": "test_resources/memory",
+		"cpu":    "test_resources/missing",
+	}, state)
+	if count != 4+8 {
+		t.Errorf("counted %d files, expected %d", count, 4+8)
+	}
+}
+
+func TestMemoryReclaimStats(t *testing.T) {
+	stats := cgroups.NewStats()
+	if err := (&cgroupfs.MemoryGroup{}).GetStats("test_resources/memory", stats); err != nil {
+		t.Fatalf("failed to parse memory stats: %v", err)
+	}
+	expected := info.MemoryReclaimStats{
+		Pgscan:        5250,
+		PgscanKswapd:  4096,
+		PgscanDirect:  1154,
+		Pgsteal:       4960,
+		PgstealKswapd: 3987,
+		PgstealDirect: 973,
+	}
+	if reclaim := memoryReclaimStats(stats.MemoryStats.Stats); reclaim != expected {
+		t.Errorf("expected reclaim stats %+v, got %+v", expected, reclaim)
+	}
+}
+
+func TestMemoryReclaimStatsWithoutTotals(t *testing.T) {
+	reclaim := memoryReclaimStats(map[string]uint64{
+		"pgscan_kswapd":  10,
+		"pgscan_direct":  5,
+		"pgsteal_kswapd": 8,
+	})
+	if reclaim.Pgscan != 15 || reclaim.Pgsteal != 8 {
+		t.Errorf("expected totals to be summed from kswapd and direct counters, got %+v", reclaim)
+	}
+}
+
+func TestMemoryRefaultStats(t *testing.T) {
+	stats := cgroups.NewStats()
+	if err := (&cgroupfs.MemoryGroup{}).GetStats("test_resources/memory", stats); err != nil {
+		t.Fatalf("failed to parse memory stats: %v", err)
+	}
+	expected := info.MemoryRefaultStats{
+		Anon:         310,
+		File:         4520,
+		ActivateAnon: 42,
+		ActivateFile: 1280,
+	}
+	if refault := memoryRefaultStats(stats.MemoryStats.Stats); refault != expected {
+		t.Errorf("expected refault stats %+v, got %+v", expected, refault)
+	}
+
+	// Kernels before 5.9 only report the page cache refaults.
+	refault := memoryRefaultStats(map[string]uint64{
+		"workingset_refault":  100,
+		"workingset_activate": 20,
+	})
+	if expected := (info.MemoryRefaultStats{File: 100, ActivateFile: 20}); refault != expected {
+		t.Errorf("expected refault stats %+v, got %+v", expected, refault)
+	}
+
+	// Older kernels report none.
+	if refault := memoryRefaultStats(map[string]uint64{"pgfault": 10}); refault != (info.MemoryRefaultStats{}) {
+		t.Errorf("expected no refault stats, got %+v", refault)
+	}
+}
+
+func TestMemoryShmemStats(t *testing.T) {
+	stats := cgroups.NewStats()
+	if err := (&cgroupfs.MemoryGroup{}).GetStats("test_resources/memory", stats); err != nil {
+		t.Fatalf("failed to parse memory stats: %v", err)
+	}
+	shmem, withoutShmem := memoryShmemStats(stats.MemoryStats.Stats)
+	if shmem != 8388608 || withoutShmem != 148897792 {
+		t.Errorf("expected 8388608 bytes of shmem and 148897792 bytes without it, got %d and %d", shmem, withoutShmem)
+	}
+
+	// The hierarchical counters of v1 hierarchies.
+	shmem, withoutShmem = memoryShmemStats(map[string]uint64{
+		"rss":         4096,
+		"cache":       4096,
+		"shmem":       1024,
+		"total_rss":   40960,
+		"total_cache": 20480,
+		"total_shmem": 10240,
+	})
+	if shmem != 10240 || withoutShmem != 51200 {
+		t.Errorf("expected the hierarchical counters to be used, got %d bytes of shmem and %d without it", shmem, withoutShmem)
+	}
+
+	// Older kernels do not report shmem.
+	shmem, withoutShmem = memoryShmemStats(map[string]uint64{"rss": 4096, "cache": 2048})
+	if shmem != 0 || withoutShmem != 6144 {
+		t.Errorf("expected no shmem and 6144 bytes without it, got %d and %d", shmem, withoutShmem)
+	}
+}
+
+func TestMemoryReclaimableStats(t *testing.T) {
+	stats := cgroups.NewStats()
+	if err := (&cgroupfs.MemoryGroup{}).GetStats("test_resources/memory", stats); err != nil {
+		t.Fatalf("failed to parse memory stats: %v", err)
+	}
+	// 31457280 bytes of inactive page cache and 3145728 of reclaimable slab
+	// out of 157286400.
+	reclaimable, unreclaimable := memoryReclaimableStats(stats.MemoryStats.Usage, stats.MemoryStats.Stats)
+	if reclaimable != 34603008 || unreclaimable != 122683392 {
+		t.Errorf("expected 34603008 reclaimable and 122683392 unreclaimable bytes, got %d and %d", reclaimable, unreclaimable)
+	}
+
+	// The hierarchical counters of v1 hierarchies.
+	reclaimable, unreclaimable = memoryReclaimableStats(10000, map[string]uint64{
+		"inactive_file":       1000,
+		"total_inactive_file": 4000,
+	})
+	if reclaimable != 4000 || unreclaimable != 6000 {
+		t.Errorf("expected the hierarchical counters to be used, got %d reclaimable and %d unreclaimable bytes", reclaimable, unreclaimable)
+	}
+
+	// The reclaimable memory is clamped to the usage.
+	reclaimable, unreclaimable = memoryReclaimableStats(1000, map[string]uint64{
+		"inactive_file":    800,
+		"slab_reclaimable": 400,
+	})
+	if reclaimable != 1000 || unreclaimable != 0 {
+		t.Errorf("expected 1000 reclaimable and no unreclaimable bytes, got %d and %d", reclaimable, unreclaimable)
+	}
+
+	// Nothing is estimated without the inactive page cache.
+	reclaimable, unreclaimable = memoryReclaimableStats(1000, map[string]uint64{"slab_reclaimable": 400})
+	if reclaimable != 0 || unreclaimable != 0 {
+		t.Errorf("expected no estimate, got %d reclaimable and %d unreclaimable bytes", reclaimable, unreclaimable)
+	}
+}
+
+func TestMemorySlabStats(t *testing.T) {
+	stats := cgroups.NewStats()
+	if err := (&cgroupfs.MemoryGroup{}).GetStats("test_resources/memory", stats); err != nil {
+		t.Fatalf("failed to parse memory stats: %v", err)
+	}
+	expected := info.MemorySlabStats{
+		Reclaimable:   3145728,
+		Unreclaimable: 1048576,
+	}
+	if slab := memorySlabStats(stats.MemoryStats.Stats); slab != expected {
+		t.Errorf("expected slab stats %+v, got %+v", expected, slab)
+	}
+
+	// Not reported on v1 hierarchies.
+	if slab := memorySlabStats(map[string]uint64{"cache": 4096}); slab != (info.MemorySlabStats{}) {
+		t.Errorf("expected no slab stats, got %+v", slab)
+	}
+}
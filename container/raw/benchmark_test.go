@@ -0,0 +1,119 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raw
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/google/cadvisor/container"
+)
+
+var benchmarkContainers = flag.Int("benchmark_containers", 100, "Number of containers in the cgroup tree of the benchmarks")
+
+// Stats files of a container in the fixture cgroup tree, by hierarchy.
+var benchmarkCgroupFiles = map[string]map[string]string{
+	"cpu": {
+		"cpu.shares": "1024\n",
+		"cpu.stat":   "nr_periods 120\nnr_throttled 4\nthrottled_time 5000000\n",
+	},
+	"cpuacct": {
+		"cpuacct.stat":         "user 4200\nsystem 1300\n",
+		"cpuacct.usage":        "55000000000\n",
+		"cpuacct.usage_percpu": "14000000000 13000000000 15000000000 13000000000\n",
+	},
+	"memory": {
+		"memory.stat":               "cache 1048576\nrss 4194304\npgfault 9000\npgmajfault 12\ntotal_inactive_anon 524288\ntotal_active_file 262144\n",
+		"memory.usage_in_bytes":     "5242880\n",
+		"memory.max_usage_in_bytes": "8388608\n",
+		"memory.failcnt":            "0\n",
+		"memory.limit_in_bytes":     "1073741824\n",
+	},
+}
+
+// Creates a fixture cgroup tree with the specified number of containers under
+// /bench in every hierarchy. Returns the root of the tree and the mount points
+// of the hierarchies.
+func newBenchmarkCgroupTree(b *testing.B, containers int) (string, map[string]string) {
+	root, err := ioutil.TempDir("", "cgroup_bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	mountPoints := make(map[string]string, len(benchmarkCgroupFiles))
+	for hierarchy, files := range benchmarkCgroupFiles {
+		mountPoints[hierarchy] = path.Join(root, hierarchy)
+		for i := 0; i < containers; i++ {
+			dir := path.Join(root, hierarchy, "bench", fmt.Sprintf("container%d", i))
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				b.Fatal(err)
+			}
+			for name, contents := range files {
+				if err := ioutil.WriteFile(path.Join(dir, name), []byte(contents), 0644); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+	return root, mountPoints
+}
+
+// Creates a test handler for the specified container of the fixture tree.
+func newBenchmarkHandler(name string, mountPoints map[string]string) *rawContainerHandler {
+	cgroupPaths := make(map[string]string, len(mountPoints))
+	for hierarchy, mountPoint := range mountPoints {
+		cgroupPaths[hierarchy] = path.Join(mountPoint, name)
+	}
+	return newTestRawContainerHandler(name, cgroupPaths)
+}
+
+func BenchmarkGetStats(b *testing.B) {
+	root, mountPoints := newBenchmarkCgroupTree(b, *benchmarkContainers)
+	defer os.RemoveAll(root)
+	handlers := make([]*rawContainerHandler, *benchmarkContainers)
+	for i := range handlers {
+		handlers[i] = newBenchmarkHandler(fmt.Sprintf("/bench/container%d", i), mountPoints)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, handler := range handlers {
+			if _, err := handler.GetStats(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkListContainers(b *testing.B) {
+	root, mountPoints := newBenchmarkCgroupTree(b, *benchmarkContainers)
+	defer os.RemoveAll(root)
+	handler := newBenchmarkHandler("/", mountPoints)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		containers, err := handler.ListContainers(container.ListRecursive)
+		if err != nil {
+			b.Fatal(err)
+		}
+		// The containers and their /bench parent.
+		if len(containers) != *benchmarkContainers+1 {
+			b.Fatalf("listed %d containers, expected %d", len(containers), *benchmarkContainers+1)
+		}
+	}
+}
@@ -21,8 +21,11 @@ package raw
 import (
 	"encoding/json"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"os"
+
+	"github.com/google/cadvisor/container"
 )
 
 var argContainerHints = flag.String("container_hints", "/etc/cadvisor/container_hints.json", "location of the container hints file")
@@ -35,6 +38,23 @@ type containerHint struct {
 	FullName         string            `json:"full_path,omitempty"`
 	NetworkInterface *networkInterface `json:"network_interface,omitempty"`
 	Mounts           []mount           `json:"mounts,omitempty"`
+	Collectors       []collectorHint   `json:"collectors,omitempty"`
+	// Runtime running the container (e.g. docker) and image it was created
+	// from, reported as is.
+	Runtime string `json:"runtime,omitempty"`
+	Image   string `json:"image,omitempty"`
+	// Directories of the host (e.g. a logs directory) whose recursive usage
+	// is reported along with the filesystems of the container.
+	Subpaths []string `json:"subpaths,omitempty"`
+}
+
+// Custom metrics collector of a container. Metrics are read either from a URL
+// or from a file on the host.
+type collectorHint struct {
+	// Name of the collector, defaults to its URL or file.
+	Name string `json:"name,omitempty"`
+	Url  string `json:"url,omitempty"`
+	File string `json:"file,omitempty"`
 }
 
 type mount struct {
@@ -59,3 +79,22 @@ func getContainerHintsFromFile(containerHintsFile string) (containerHints, error
 
 	return cHints, err
 }
+
+// Creates the collector described by the hint and returns it with its name.
+func newHintCollector(hint collectorHint) (string, container.Collector, error) {
+	switch {
+	case hint.Url != "" && hint.File != "":
+		return "", nil, fmt.Errorf("collector %q has both a url and a file", hint.Name)
+	case hint.Url != "":
+		if hint.Name == "" {
+			hint.Name = hint.Url
+		}
+		return hint.Name, container.NewHttpCollector(hint.Url), nil
+	case hint.File != "":
+		if hint.Name == "" {
+			hint.Name = hint.File
+		}
+		return hint.Name, container.NewFileCollector(hint.File), nil
+	}
+	return "", nil, fmt.Errorf("collector %q has neither a url nor a file", hint.Name)
+}
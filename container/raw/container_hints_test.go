@@ -49,6 +49,62 @@ func TestGetContainerHintsFromFile(t *testing.T) {
 	}
 }
 
+func TestGetRuntimeHints(t *testing.T) {
+	cHints, err := getContainerHintsFromFile("test_resources/container_hints.json")
+	if err != nil {
+		t.Fatalf("Error in unmarshalling: %s", err)
+	}
+
+	hint := cHints.AllHosts[0]
+	if hint.Runtime != "containerd" || hint.Image != "gcr.io/google_containers/pause:2.0" {
+		t.Errorf("Expected runtime \"containerd\" and image \"gcr.io/google_containers/pause:2.0\", got %q and %q", hint.Runtime, hint.Image)
+	}
+}
+
+func TestGetSubpathHints(t *testing.T) {
+	cHints, err := getContainerHintsFromFile("test_resources/container_hints.json")
+	if err != nil {
+		t.Fatalf("Error in unmarshalling: %s", err)
+	}
+
+	subpaths := cHints.AllHosts[0].Subpaths
+	if len(subpaths) != 1 || subpaths[0] != "/var/log/app" {
+		t.Errorf("Expected subpaths [/var/log/app], got %v", subpaths)
+	}
+}
+
+func TestGetCollectorHints(t *testing.T) {
+	cHints, err := getContainerHintsFromFile("test_resources/container_hints.json")
+	if err != nil {
+		t.Fatalf("Error in unmarshalling: %s", err)
+	}
+
+	collectors := cHints.AllHosts[0].Collectors
+	if len(collectors) != 2 {
+		t.Fatalf("Expected 2 collectors, found %+v", collectors)
+	}
+	name, _, err := newHintCollector(collectors[0])
+	if err != nil || name != "app" {
+		t.Errorf("Expected collector named \"app\", got %q (error: %v)", name, err)
+	}
+	name, _, err = newHintCollector(collectors[1])
+	if err != nil || name != "/var/run/app/stats" {
+		t.Errorf("Expected collector named after its file, got %q (error: %v)", name, err)
+	}
+}
+
+func TestInvalidCollectorHints(t *testing.T) {
+	invalidHints := []collectorHint{
+		{Name: "empty"},
+		{Name: "both", Url: "http://localhost:8000/metrics", File: "/var/run/app/stats"},
+	}
+	for _, hint := range invalidHints {
+		if _, _, err := newHintCollector(hint); err == nil {
+			t.Errorf("Expected collector hint %+v to be invalid", hint)
+		}
+	}
+}
+
 func TestFileNotExist(t *testing.T) {
 	_, err := getContainerHintsFromFile("/file_does_not_exist.json")
 	if err != nil {
@@ -16,6 +16,7 @@ package raw
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/google/cadvisor/container"
@@ -23,12 +24,100 @@ import (
 	"github.com/google/cadvisor/info"
 )
 
+// Options of the raw containers.
+type Options struct {
+	// Whether the raw cgroup files of containers may be read for debugging.
+	AllowCgroupFileReads bool
+
+	// Whether cumulative counters are reported as their change since the
+	// last read, or since the container was first watched, instead of their
+	// cumulative value.
+	StatsDeltas        bool
+	StatsSinceCreation bool
+
+	// Maximum time to wait for a cgroup file to be read, 0 waits forever.
+	CgroupReadTimeout time.Duration
+
+	// Number of times a read that failed with a transient error is attempted,
+	// and the delay before the first retry, doubled after every attempt.
+	CgroupReadAttempts int
+	CgroupReadBackoff  time.Duration
+
+	// Number of times a cgroup file that is empty or invalid, as happens right
+	// after a container is created, is read again, and the delay in between.
+	CgroupStartupRetries int
+	CgroupStartupBackoff time.Duration
+
+	// Minimum time between collections of the filesystem stats, 0 collects
+	// them every time.
+	FsStatsInterval time.Duration
+
+	// Minimum time between computations of the usage of the subpaths of the
+	// container hints.
+	SubpathUsageTtl time.Duration
+
+	// Whether collecting the stats fails when one of the cgroups of the
+	// container disappeared instead of leaving their stats empty.
+	StrictSubsystems bool
+
+	// Whether changes of the limits of containers are reported as they happen.
+	WatchSpecChanges bool
+
+	// Whether a device mounted at several mountpoints is only reported for
+	// the first one.
+	DedupeFsStats bool
+
+	// Whether the usage of a filesystem shared with the host through a bind
+	// mount is the usage of the mounted directories.
+	BindMountFsUsage bool
+
+	// Whether containers may be asked to reclaim memory.
+	AllowMemoryReclaim bool
+
+	// Whether the files read to collect the stats and the time spent reading
+	// them are recorded.
+	RecordCollectionCost bool
+
+	// Whether the cpu and memory usage of the root container are read from
+	// /proc when its cgroups are not the root of their hierarchy.
+	RootStatsFromProc bool
+
+	// Interval between checks that the cgroup hierarchies are still mounted
+	// where they were, 0 never checks.
+	CgroupMountCheckInterval time.Duration
+
+	// Directory watched for cgroup hierarchies mounted after cAdvisor
+	// started, empty does not watch.
+	CgroupMountsDir string
+
+	// Whether the cgroup configuration files are only read again when their
+	// modification time changed.
+	SkipUnchangedConfigFiles bool
+
+	// Optional stats read from the files of every process or thread, or from
+	// every cgroup of the container.
+	SchedWaitTime      bool
+	ApplicationIoStats bool
+	ThreadCountStats   bool
+	OomScoreStats      bool
+
+	// Whether the loopback device is in the per-interface network stats of
+	// the root container.
+	LoopbackNetworkStats bool
+
+	// Optional stats and processes of the libcontainer helpers.
+	Stats libcontainer.StatsOptions
+}
+
 type rawFactory struct {
 	// Factory for machine information.
 	machineInfoFactory info.MachineInfoFactory
 
 	// Information about the cgroup subsystems.
 	cgroupSubsystems *libcontainer.CgroupSubsystems
+
+	// Options of the containers.
+	options *Options
 }
 
 func (self *rawFactory) String() string {
@@ -36,7 +125,7 @@ func (self *rawFactory) String() string {
 }
 
 func (self *rawFactory) NewContainerHandler(name string) (container.ContainerHandler, error) {
-	return newRawContainerHandler(name, self.cgroupSubsystems, self.machineInfoFactory)
+	return newRawContainerHandler(name, self.cgroupSubsystems, self.machineInfoFactory, self.options)
 }
 
 // The raw factory can handle any container.
@@ -44,19 +133,41 @@ func (self *rawFactory) CanHandle(name string) (bool, error) {
 	return true, nil
 }
 
-func Register(machineInfoFactory info.MachineInfoFactory) error {
+func Register(machineInfoFactory info.MachineInfoFactory, options Options) error {
 	cgroupSubsystems, err := libcontainer.GetCgroupSubsystems()
-	if err != nil {
-		return fmt.Errorf("failed to get cgroup subsystems: %v", err)
+	if options.CgroupMountsDir == "" {
+		if err != nil {
+			return fmt.Errorf("failed to get cgroup subsystems: %v", err)
+		}
+		if len(cgroupSubsystems.Mounts) == 0 {
+			return fmt.Errorf("failed to find supported cgroup mounts for the raw factory")
+		}
+	} else if err != nil || len(cgroupSubsystems.Mounts) == 0 {
+		// The hierarchies may not be mounted yet, the containers pick them
+		// up once they are.
+		glog.Warningf("Found no supported cgroup mounts, waiting for them to be mounted under %q", options.CgroupMountsDir)
+		cgroupSubsystems = libcontainer.CgroupSubsystems{
+			MountPoints: make(map[string]string),
+		}
 	}
-	if len(cgroupSubsystems.Mounts) == 0 {
-		return fmt.Errorf("failed to find supported cgroup mounts for the raw factory")
+
+	if options.CgroupMountsDir != "" {
+		watcher, err := newInotifyWatcher()
+		if err != nil {
+			return err
+		}
+		err = watchCgroupMounts(watcher, options.CgroupMountsDir, cgroupSubsystems.MountPoints, nil)
+		if err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch %q for cgroup mounts: %v", options.CgroupMountsDir, err)
+		}
 	}
 
 	glog.Infof("Registering Raw factory")
 	factory := &rawFactory{
 		machineInfoFactory: machineInfoFactory,
 		cgroupSubsystems:   &cgroupSubsystems,
+		options:            &options,
 	}
 	container.RegisterContainerHandlerFactory(factory)
 	return nil
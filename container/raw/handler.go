@@ -18,14 +18,22 @@ package raw
 import (
 	"fmt"
 	"io/ioutil"
+	"math"
+	"os"
 	"path"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"code.google.com/p/go.exp/inotify"
+	dockermount "github.com/docker/docker/pkg/mount"
 	dockerlibcontainer "github.com/docker/libcontainer"
 	"github.com/docker/libcontainer/cgroups"
-	cgroup_fs "github.com/docker/libcontainer/cgroups/fs"
 	"github.com/docker/libcontainer/network"
 	"github.com/golang/glog"
 	"github.com/google/cadvisor/container"
@@ -33,6 +41,9 @@ import (
 	"github.com/google/cadvisor/fs"
 	"github.com/google/cadvisor/info"
 	"github.com/google/cadvisor/utils"
+	"github.com/google/cadvisor/utils/clock"
+	utilsfs "github.com/google/cadvisor/utils/fs"
+	"github.com/google/cadvisor/utils/procfs"
 	"github.com/google/cadvisor/utils/sysinfo"
 )
 
@@ -44,7 +55,7 @@ type rawContainerHandler struct {
 	machineInfoFactory info.MachineInfoFactory
 
 	// Inotify event watcher.
-	watcher *inotify.Watcher
+	watcher fsWatcher
 
 	// Signal for watcher thread to stop.
 	stopWatcher chan error
@@ -55,26 +66,128 @@ type rawContainerHandler struct {
 	// Cgroup paths being watchd for new subcontainers
 	cgroupWatches map[string]struct{}
 
+	// Protects watches and cgroupWatches.
+	watchesLock sync.Mutex
+
 	// Absolute path to the cgroup hierarchies of this container.
 	// (e.g.: "cpu" -> "/sys/fs/cgroup/cpu/test")
 	cgroupPaths map[string]string
 
+	// Absolute path to the perf_event cgroup of this container, empty when
+	// the perf_event hierarchy is not mounted. It is not in cgroupPaths since
+	// no stats are collected from it.
+	perfEventPath string
+
+	// Protects cgroupPaths, perfEventPath, cgroupSubsystems and
+	// libcontainerState, which are replaced when the cgroup hierarchies are
+	// mounted elsewhere.
+	cgroupPathsLock sync.RWMutex
+
+	// When the cgroup mounts were last checked, and the last generation of
+	// the cgroup mounts seen.
+	lastMountCheck   time.Time
+	mountsGeneration uint64
+
 	// Equivalent libcontainer state for this container.
 	libcontainerState dockerlibcontainer.State
 
 	// Whether this container has network isolation enabled.
 	hasNetwork bool
 
-	fsInfo         fs.FsInfo
-	externalMounts []mount
+	fsInfo fs.FsInfo
+
+	// Reader of the cgroup files of this container.
+	reader *cgroupReader
+
+	// Serializes the collections of this container whose cost is recorded, so
+	// that the reads counted in between are attributed to a single
+	// collection.
+	collectionCostLock sync.Mutex
+
+	// Directories of the host mounted in the container, from the container
+	// hints and registered with AddExternalMount.
+	externalMounts     []mount
+	externalMountsLock sync.RWMutex
+
+	// Runtime and image of this container from the container hints.
+	runtime string
+	image   string
+
+	// Directories whose usage is reported, from the container hints, and
+	// their latest usage keyed by directory.
+	subpaths         []string
+	subpathUsage     map[string]subpathUsage
+	subpathUsageLock sync.Mutex
+
+	// Subsystems whose cgroup existed when the handler was created.
+	subsystems []string
+
+	// Latest filesystem stats and when they were collected, reported until
+	// --filesystem_stats_interval elapses.
+	fsStats        []info.FsStats
+	fsSubpathStats []info.SubpathStats
+	fsStatsTime    time.Time
+	fsStatsLock    sync.Mutex
+
+	// Whether the cpu and memory usage are those of the machine, from /proc,
+	// instead of those of the cgroups.
+	statsFromProc bool
+
+	// Last cumulative stats read, used to report deltas and detect counter
+	// resets.
+	lastStats     *info.ContainerStats
+	lastStatsLock sync.Mutex
+	// Cumulative stats the stats since creation are computed from, the first
+	// stats read or those read after the last counter reset.
+	baselineStats *info.ContainerStats
+
+	// Custom collectors of this container, keyed by name.
+	collectors     map[string]container.Collector
+	collectorsLock sync.Mutex
+
+	// Source of the timestamps of stats.
+	clock clock.Clock
+
+	// Configuration files read by GetStats keyed by path, only kept with
+	// --skip_unchanged_config_files.
+	configFiles     map[string]configFile
+	configFilesLock sync.Mutex
+
+	// Options of the raw containers, shared by all the handlers.
+	options *Options
+
+	// First process of the container and its root mount, read from /proc
+	// once and reused by GetSpec until the process exits.
+	initProcess     *info.ProcessSpec
+	rootfs          *info.RootfsSpec
+	initProcessLock sync.Mutex
+}
+
+// Usage of a directory and when it was computed.
+type subpathUsage struct {
+	usage uint64
+	time  time.Time
+}
+
+// Contents of a cgroup configuration file and its modification time when it
+// was read.
+type configFile struct {
+	modTime  time.Time
+	contents string
 }
 
-func newRawContainerHandler(name string, cgroupSubsystems *libcontainer.CgroupSubsystems, machineInfoFactory info.MachineInfoFactory) (container.ContainerHandler, error) {
-	// Create the cgroup paths.
+// Returns the cgroup of the container name in every hierarchy of
+// cgroupSubsystems, keyed by subsystem. The cgroups need not exist.
+func CgroupPathsForName(name string, cgroupSubsystems *libcontainer.CgroupSubsystems) map[string]string {
 	cgroupPaths := make(map[string]string, len(cgroupSubsystems.MountPoints))
 	for key, val := range cgroupSubsystems.MountPoints {
 		cgroupPaths[key] = path.Join(val, name)
 	}
+	return cgroupPaths
+}
+
+func newRawContainerHandler(name string, cgroupSubsystems *libcontainer.CgroupSubsystems, machineInfoFactory info.MachineInfoFactory, options *Options) (container.ContainerHandler, error) {
+	cgroupPaths := CgroupPathsForName(name, cgroupSubsystems)
 
 	// TODO(vmarmol): Get from factory.
 	fsInfo, err := fs.NewFsInfo()
@@ -86,6 +199,18 @@ func newRawContainerHandler(name string, cgroupSubsystems *libcontainer.CgroupSu
 		return nil, err
 	}
 
+	statsFromProc := false
+	if name == "/" && options.RootStatsFromProc {
+		mounts, err := dockermount.GetMounts()
+		if err != nil {
+			return nil, err
+		}
+		statsFromProc = isScopedCgroupMount(mounts, cgroupSubsystems.MountPoints["cpu"]) || isScopedCgroupMount(mounts, cgroupSubsystems.MountPoints["memory"])
+		if statsFromProc {
+			glog.Infof("The cgroups of the root container are not the root of their hierarchy, reading its cpu and memory usage from /proc")
+		}
+	}
+
 	// Generate the equivalent libcontainer state for this container.
 	libcontainerState := dockerlibcontainer.State{
 		CgroupPaths: cgroupPaths,
@@ -93,14 +218,29 @@ func newRawContainerHandler(name string, cgroupSubsystems *libcontainer.CgroupSu
 
 	hasNetwork := false
 	var externalMounts []mount
-	for _, container := range cHints.AllHosts {
-		if name == container.FullName {
-			libcontainerState.NetworkState = network.NetworkState{
-				VethHost:  container.NetworkInterface.VethHost,
-				VethChild: container.NetworkInterface.VethChild,
-			}
-			hasNetwork = true
-			externalMounts = container.Mounts
+	var runtime, image string
+	var subpaths []string
+	collectors := make(map[string]container.Collector)
+	for _, cHint := range cHints.AllHosts {
+		if name == cHint.FullName {
+			if cHint.NetworkInterface != nil {
+				libcontainerState.NetworkState = network.NetworkState{
+					VethHost:  cHint.NetworkInterface.VethHost,
+					VethChild: cHint.NetworkInterface.VethChild,
+				}
+				hasNetwork = true
+			}
+			externalMounts = cHint.Mounts
+			runtime = cHint.Runtime
+			image = cHint.Image
+			subpaths = cHint.Subpaths
+			for _, collectorHint := range cHint.Collectors {
+				collectorName, collector, err := newHintCollector(collectorHint)
+				if err != nil {
+					return nil, fmt.Errorf("invalid hints for container %q: %v", name, err)
+				}
+				collectors[collectorName] = collector
+			}
 			break
 		}
 	}
@@ -117,201 +257,1557 @@ func newRawContainerHandler(name string, cgroupSubsystems *libcontainer.CgroupSu
 		watches:            make(map[string]struct{}),
 		cgroupWatches:      make(map[string]struct{}),
 		cgroupPaths:        cgroupPaths,
+		perfEventPath:      perfEventCgroupPath(name),
 		libcontainerState:  libcontainerState,
 		fsInfo:             fsInfo,
+		reader:             &cgroupReader{fs: utilsfs.OsFileSystem(), options: options},
 		hasNetwork:         hasNetwork,
 		externalMounts:     externalMounts,
+		runtime:            runtime,
+		image:              image,
+		subpaths:           subpaths,
+		subpathUsage:       make(map[string]subpathUsage),
+		collectors:         collectors,
+		subsystems:         existingSubsystems(cgroupPaths),
+		statsFromProc:      statsFromProc,
+		clock:              clock.RealClock{},
+		configFiles:        make(map[string]configFile),
+		options:            options,
 	}, nil
 }
 
+// Returns whether the cgroup filesystem mounted at mountpoint only shows a
+// sub-hierarchy, such as the cgroup of a container in a cgroup namespace. Its
+// root cgroup then only accounts for that cgroup.
+func isScopedCgroupMount(mounts []*dockermount.MountInfo, mountpoint string) bool {
+	for _, mount := range mounts {
+		if mount.Mountpoint == mountpoint {
+			return mount.Root != "/"
+		}
+	}
+	return false
+}
+
+// Replaces the cpu and memory usage in stats with those of the machine from
+// the stat and meminfo files of procDir.
+func addMachineUsage(stats *info.ContainerStats, procDir string) error {
+	cpuStats, err := sysinfo.GetCpuStats(path.Join(procDir, "stat"))
+	if err != nil {
+		return err
+	}
+	stats.Cpu.Usage = cpuStats.Usage
+	memoryStats, err := sysinfo.GetMemoryStats(path.Join(procDir, "meminfo"))
+	if err != nil {
+		return err
+	}
+	stats.Memory.Usage = memoryStats.Usage
+	stats.Memory.WorkingSet = memoryStats.WorkingSet
+	return nil
+}
+
+// Sets the steal and guest cpu time in stats to those of the machine from the
+// stat file of procDir. Cgroups do not account for them.
+func addMachineCpuTimes(stats *info.ContainerStats, procDir string) error {
+	cpuStats, err := sysinfo.GetCpuStats(path.Join(procDir, "stat"))
+	if err != nil {
+		return err
+	}
+	stats.Cpu.Usage.Steal = cpuStats.Usage.Steal
+	stats.Cpu.Usage.Guest = cpuStats.Usage.Guest
+	return nil
+}
+
+// Returns the controllers enabled for the cgroups at cgroupPaths, sorted. They
+// are listed in cgroup.controllers on the unified (v2) hierarchy and are the
+// hierarchies the container has a cgroup in otherwise.
+func (self *cgroupReader) enabledControllers(cgroupPaths map[string]string) []string {
+	for _, cgroupPath := range cgroupPaths {
+		if out := self.readString(cgroupPath, "cgroup.controllers"); out != "" {
+			controllers := strings.Fields(out)
+			sort.Strings(controllers)
+			return controllers
+		}
+	}
+	return existingSubsystems(cgroupPaths)
+}
+
+// Returns the subsystems whose cgroup exists, sorted.
+func existingSubsystems(cgroupPaths map[string]string) []string {
+	var subsystems []string
+	for subsystem, cgroupPath := range cgroupPaths {
+		if utils.FileExists(cgroupPath) {
+			subsystems = append(subsystems, subsystem)
+		}
+	}
+	sort.Strings(subsystems)
+	return subsystems
+}
+
+// Used to read the cgroup mounts, replaced in tests.
+var getCgroupSubsystems = libcontainer.GetCgroupSubsystems
+
+// Used to find where the perf_event hierarchy is mounted from
+// /proc/self/mountinfo, replaced in tests.
+var findCgroupMountpoint = cgroups.FindCgroupMountpoint
+
+// Returns the path of the perf_event cgroup of the named container, empty when
+// the perf_event hierarchy is not mounted.
+func perfEventCgroupPath(name string) string {
+	mountpoint, err := findCgroupMountpoint("perf_event")
+	if err != nil {
+		return ""
+	}
+	return path.Join(mountpoint, name)
+}
+
+// Returns the cgroup paths of the container. The map is replaced, not
+// modified, when the paths are refreshed.
+func (self *rawContainerHandler) getCgroupPaths() map[string]string {
+	self.cgroupPathsLock.RLock()
+	defer self.cgroupPathsLock.RUnlock()
+	return self.cgroupPaths
+}
+
+// Checks, at most every --cgroup_mount_check_interval, that the cgroup
+// hierarchies are still mounted where the cgroup paths of the container point
+// to and refreshes the paths when they were remounted elsewhere. They are also
+// checked whenever the watch of --cgroup_mounts_dir saw the mounts change,
+// e.g. when the hierarchies were mounted after the handler was created. The
+// existing watches of subcontainers are not moved.
+func (self *rawContainerHandler) checkCgroupMounts() {
+	generation := atomic.LoadUint64(&cgroupMountsGeneration)
+	if self.options.CgroupMountCheckInterval <= 0 && generation == 0 {
+		return
+	}
+	self.cgroupPathsLock.Lock()
+	defer self.cgroupPathsLock.Unlock()
+	now := self.clock.Now()
+	if generation == self.mountsGeneration {
+		if self.options.CgroupMountCheckInterval <= 0 || (!self.lastMountCheck.IsZero() && now.Sub(self.lastMountCheck) < self.options.CgroupMountCheckInterval) {
+			return
+		}
+	}
+	self.lastMountCheck = now
+	self.mountsGeneration = generation
+
+	cgroupSubsystems, err := getCgroupSubsystems()
+	if err != nil {
+		glog.Warningf("Failed to check the cgroup mounts of container %q: %v", self.name, err)
+		return
+	}
+	if reflect.DeepEqual(cgroupSubsystems.MountPoints, self.cgroupSubsystems.MountPoints) {
+		return
+	}
+	glog.Warningf("The cgroup hierarchies of container %q moved from %v to %v, refreshing its cgroup paths", self.name, self.cgroupSubsystems.MountPoints, cgroupSubsystems.MountPoints)
+	cgroupPaths := CgroupPathsForName(self.name, &cgroupSubsystems)
+	self.cgroupSubsystems = &cgroupSubsystems
+	self.cgroupPaths = cgroupPaths
+	self.perfEventPath = perfEventCgroupPath(self.name)
+	self.libcontainerState.CgroupPaths = cgroupPaths
+}
+
 func (self *rawContainerHandler) ContainerReference() (info.ContainerReference, error) {
 	// We only know the container by its one name.
 	return info.ContainerReference{
-		Name: self.name,
+		Name:    self.name,
+		Runtime: self.runtime,
+		Image:   self.image,
 	}, nil
 }
 
-func readString(dirpath string, file string) string {
-	cgroupFile := path.Join(dirpath, file)
+// Reads the cgroup files of a container.
+type cgroupReader struct {
+	// File system the files are read from. Reads that time out keep using it
+	// in the background.
+	fs utilsfs.FileSystem
 
-	// Ignore non-existent files
-	if !utils.FileExists(cgroupFile) {
-		return ""
+	// Files read and time spent reading them (in nanoseconds), only counted
+	// with --record_collection_cost.
+	filesRead    uint64
+	readDuration int64
+
+	// Timeouts and retries of the reads.
+	options *Options
+}
+
+// Counts files read in duration.
+func (self *cgroupReader) recordReads(files uint64, duration time.Duration) {
+	atomic.AddUint64(&self.filesRead, files)
+	atomic.AddInt64(&self.readDuration, int64(duration))
+}
+
+// Reads the specified file from the file system of the reader.
+func (self *cgroupReader) readFile(file string) ([]byte, error) {
+	f, err := self.fs.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// Reads the specified file, giving up after the specified timeout, 0 waiting
+// forever. A read that times out is left to finish in the background.
+func (self *cgroupReader) readFileWithTimeout(file string, timeout time.Duration) ([]byte, error) {
+	if self.options.RecordCollectionCost {
+		start := time.Now()
+		defer func() { self.recordReads(1, time.Since(start)) }()
+	}
+	if timeout <= 0 {
+		return self.readFile(file)
+	}
+
+	type result struct {
+		out []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		out, err := self.readFile(file)
+		done <- result{out, err}
+	}()
+	select {
+	case res := <-done:
+		return res.out, res.err
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("timed out after %v", timeout)
+	}
+}
+
+// Returns whether a failed read is likely to succeed if retried. A cgroup that
+// is gone (ENOENT) is not coming back.
+func isRetriableReadError(err error) bool {
+	if pathErr, ok := err.(*os.PathError); ok {
+		err = pathErr.Err
 	}
+	switch err {
+	case syscall.EINTR, syscall.EAGAIN, syscall.EIO:
+		return true
+	}
+	return false
+}
 
-	// Read
-	out, err := ioutil.ReadFile(cgroupFile)
+// Reads the specified file, retrying reads that fail with a transient error up
+// to attempts times. The delay between attempts starts at backoff and doubles
+// after every attempt.
+func (self *cgroupReader) readFileWithRetry(file string, attempts int, backoff time.Duration) ([]byte, error) {
+	for attempt := 1; ; attempt++ {
+		out, err := self.readFileWithTimeout(file, self.options.CgroupReadTimeout)
+		if err == nil || attempt >= attempts || !isRetriableReadError(err) {
+			return out, err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// Reads the specified file, reading it again up to retries times while it is
+// empty or fails with EINVAL. The kernel may not have populated the cgroup
+// files yet in the first moments after a container is created.
+func (self *cgroupReader) readFileWithStartupRetry(file string, retries int, backoff time.Duration) ([]byte, error) {
+	for retry := 0; ; retry++ {
+		out, err := self.readFileWithRetry(file, self.options.CgroupReadAttempts, self.options.CgroupReadBackoff)
+		if retry >= retries || !isStartupReadError(out, err) {
+			return out, err
+		}
+		time.Sleep(backoff)
+	}
+}
+
+func isStartupReadError(out []byte, err error) bool {
+	if err == nil {
+		return len(strings.TrimSpace(string(out))) == 0
+	}
+	if pathErr, ok := err.(*os.PathError); ok {
+		err = pathErr.Err
+	}
+	return err == syscall.EINVAL
+}
+
+// Reads a cgroup file with retries and the read timeout, the way all cgroup
+// files are read. Errors satisfy os.IsNotExist when the file is missing.
+func (self *cgroupReader) readCgroupFile(file string) ([]byte, error) {
+	return self.readFileWithRetry(file, self.options.CgroupReadAttempts, self.options.CgroupReadBackoff)
+}
+
+func (self *cgroupReader) readString(dirpath string, file string) string {
+	cgroupFile := path.Join(dirpath, file)
+	out, err := self.readFileWithStartupRetry(cgroupFile, self.options.CgroupStartupRetries, self.options.CgroupStartupBackoff)
 	if err != nil {
-		glog.Errorf("raw driver: Failed to read %q: %s", cgroupFile, err)
+		// Ignore non-existent files
+		if !os.IsNotExist(err) {
+			glog.Errorf("raw driver: Failed to read %q: %s", cgroupFile, err)
+		}
 		return ""
 	}
 	return strings.TrimSpace(string(out))
 }
 
-func readInt64(dirpath string, file string) uint64 {
-	out := readString(dirpath, file)
-	if out == "" {
-		return 0
+func (self *cgroupReader) readInt64(dirpath string, file string) uint64 {
+	out := self.readString(dirpath, file)
+	if out == "" {
+		return 0
+	}
+
+	val, err := strconv.ParseUint(out, 10, 64)
+	if err != nil {
+		glog.Errorf("raw driver: Failed to parse int %q from file %q: %s", out, path.Join(dirpath, file), err)
+		return 0
+	}
+
+	return val
+}
+
+// Reads a cpu.uclamp.min or cpu.uclamp.max file. Values are percentages or
+// "max" for 100%.
+func (self *cgroupReader) readUclampValue(dirpath string, file string) (float64, error) {
+	out := self.readString(dirpath, file)
+	if out == "max" {
+		return 100, nil
+	}
+	val, err := strconv.ParseFloat(out, 64)
+	if err != nil {
+		return 0, err
+	}
+	if val < 0 || val > 100 {
+		return 0, fmt.Errorf("%v is not a percentage", val)
+	}
+	return val, nil
+}
+
+// Reads the utilization clamping of the cpu cgroup at dirpath. Returns nil if
+// the kernel does not support it.
+func (self *cgroupReader) readUclamp(dirpath string) *info.UclampSpec {
+	if !utils.FileExists(path.Join(dirpath, "cpu.uclamp.min")) {
+		return nil
+	}
+	min, err := self.readUclampValue(dirpath, "cpu.uclamp.min")
+	if err != nil {
+		glog.Errorf("raw driver: Failed to parse %q: %s", path.Join(dirpath, "cpu.uclamp.min"), err)
+		return nil
+	}
+	max, err := self.readUclampValue(dirpath, "cpu.uclamp.max")
+	if err != nil {
+		glog.Errorf("raw driver: Failed to parse %q: %s", path.Join(dirpath, "cpu.uclamp.max"), err)
+		return nil
+	}
+	return &info.UclampSpec{
+		Min: min,
+		Max: max,
+	}
+}
+
+// Default cpu shares of a container.
+const defaultCpuShares = 1024
+
+// Reads the cpu shares of the cpu cgroup at dirpath relative to the default,
+// from cpu.shares or from cpu.weight on the unified hierarchy. Zero if neither
+// is present.
+func (self *cgroupReader) readCpuRelativeWeight(dirpath string) float64 {
+	if shares := self.readInt64(dirpath, "cpu.shares"); shares != 0 {
+		return float64(shares) / defaultCpuShares
+	}
+	if weight := self.readInt64(dirpath, "cpu.weight"); weight != 0 {
+		return cpuWeightToShares(weight) / defaultCpuShares
+	}
+	return 0
+}
+
+// Converts a cpu.weight (1-10000) to cpu shares (2-262144), inverting the
+// conversion of runc: weight = 1 + (shares - 2) * 9999 / 262142.
+func cpuWeightToShares(weight uint64) float64 {
+	return 2 + float64(weight-1)*262142/9999
+}
+
+// Reads a CFS quota, which is -1 (v1) or "max" (v2) when unlimited.
+func parseCfsQuota(out string) (uint64, error) {
+	if out == "-1" || out == "max" {
+		return math.MaxUint64, nil
+	}
+	return strconv.ParseUint(out, 10, 64)
+}
+
+// Reads the CFS bandwidth control (quota, period and burst) of the cpu cgroup
+// at dirpath from cpu.max and cpu.max.burst on the unified (v2) hierarchy, or
+// from the cpu.cfs_*_us files otherwise.
+func (self *cgroupReader) readCfsBandwidth(dirpath string) (quota, period, burst uint64) {
+	if out := self.readString(dirpath, "cpu.max"); out != "" {
+		// "$QUOTA $PERIOD"
+		fields := strings.Fields(out)
+		if len(fields) != 2 {
+			glog.Errorf("raw driver: Failed to parse %q from file %q", out, path.Join(dirpath, "cpu.max"))
+			return 0, 0, 0
+		}
+		var err error
+		quota, err = parseCfsQuota(fields[0])
+		if err == nil {
+			period, err = strconv.ParseUint(fields[1], 10, 64)
+		}
+		if err != nil {
+			glog.Errorf("raw driver: Failed to parse %q from file %q: %s", out, path.Join(dirpath, "cpu.max"), err)
+			return 0, 0, 0
+		}
+		return quota, period, self.readInt64(dirpath, "cpu.max.burst")
+	}
+
+	if out := self.readString(dirpath, "cpu.cfs_quota_us"); out != "" {
+		var err error
+		quota, err = parseCfsQuota(out)
+		if err != nil {
+			glog.Errorf("raw driver: Failed to parse %q from file %q: %s", out, path.Join(dirpath, "cpu.cfs_quota_us"), err)
+			quota = 0
+		}
+	}
+	return quota, self.readInt64(dirpath, "cpu.cfs_period_us"), self.readInt64(dirpath, "cpu.cfs_burst_us")
+}
+
+// Reads a blkio.throttle.*_device file. Each line is the limit of a device
+// (e.g. "8:0 1048576"). Devices are named after diskMap when known and by their
+// device numbers otherwise.
+func (self *cgroupReader) readBlkioThrottle(dirpath string, file string, diskMap map[string]info.DiskInfo) map[string]uint64 {
+	out := self.readString(dirpath, file)
+	if out == "" {
+		return nil
+	}
+
+	limits := make(map[string]uint64)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			glog.Errorf("raw driver: Failed to parse line %q from file %q", line, path.Join(dirpath, file))
+			continue
+		}
+		val, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			glog.Errorf("raw driver: Failed to parse int %q from file %q: %s", fields[1], path.Join(dirpath, file), err)
+			continue
+		}
+		limits[deviceName(fields[0], diskMap)] = val
+	}
+	return limits
+}
+
+// Reads the throttle limits of the blkio cgroup at dirpath, or of io.max on the
+// unified hierarchy, and the io.latency and io.cost settings where present.
+func (self *cgroupReader) readBlkioThrottleSpec(dirpath string, diskMap map[string]info.DiskInfo) info.DiskIoSpec {
+	if utils.FileExists(path.Join(dirpath, "io.max")) {
+		spec := self.readIoMax(dirpath, diskMap)
+		spec.LatencyTarget = self.readIoLatencyTargets(dirpath, diskMap)
+		spec.CostQos = self.readIoCostQos(dirpath, diskMap)
+		return spec
+	}
+	return info.DiskIoSpec{
+		ReadBpsDevice:   self.readBlkioThrottle(dirpath, "blkio.throttle.read_bps_device", diskMap),
+		WriteBpsDevice:  self.readBlkioThrottle(dirpath, "blkio.throttle.write_bps_device", diskMap),
+		ReadIopsDevice:  self.readBlkioThrottle(dirpath, "blkio.throttle.read_iops_device", diskMap),
+		WriteIopsDevice: self.readBlkioThrottle(dirpath, "blkio.throttle.write_iops_device", diskMap),
+		LatencyTarget:   self.readIoLatencyTargets(dirpath, diskMap),
+		CostQos:         self.readIoCostQos(dirpath, diskMap),
+	}
+}
+
+// Reads the throttle limits of io.max at dirpath. Each line is the limits of a
+// device (e.g. "8:0 rbps=1048576 wbps=max riops=max wiops=120"), "max" is no
+// limit.
+func (self *cgroupReader) readIoMax(dirpath string, diskMap map[string]info.DiskInfo) info.DiskIoSpec {
+	var spec info.DiskIoSpec
+	for device, values := range self.readIoKeyValues(dirpath, "io.max") {
+		for key, limits := range map[string]*map[string]uint64{
+			"rbps":  &spec.ReadBpsDevice,
+			"wbps":  &spec.WriteBpsDevice,
+			"riops": &spec.ReadIopsDevice,
+			"wiops": &spec.WriteIopsDevice,
+		} {
+			value, ok := values[key]
+			if !ok || value == "max" {
+				continue
+			}
+			val, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				glog.Errorf("raw driver: Failed to parse int %q from file %q: %s", value, path.Join(dirpath, "io.max"), err)
+				continue
+			}
+			if *limits == nil {
+				*limits = make(map[string]uint64)
+			}
+			(*limits)[deviceName(device, diskMap)] = val
+		}
+	}
+	return spec
+}
+
+// Reads a file of the io controller of the unified hierarchy. Each line is the
+// "key=value" settings or stats of a device (e.g. "8:0 target=75000"). Returns
+// the settings keyed by the device numbers.
+func (self *cgroupReader) readIoKeyValues(dirpath string, file string) map[string]map[string]string {
+	out := self.readString(dirpath, file)
+	if out == "" {
+		return nil
+	}
+
+	devices := make(map[string]map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		values := make(map[string]string, len(fields)-1)
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				glog.Errorf("raw driver: Failed to parse %q of line %q from file %q", field, line, path.Join(dirpath, file))
+				continue
+			}
+			values[kv[0]] = kv[1]
+		}
+		devices[fields[0]] = values
+	}
+	return devices
+}
+
+// Returns the name of a device of diskMap, or its device numbers if unknown.
+func deviceName(device string, diskMap map[string]info.DiskInfo) string {
+	if disk, ok := diskMap[device]; ok {
+		return disk.Name
+	}
+	return device
+}
+
+// Reads the target latencies of the io.latency controller at dirpath.
+func (self *cgroupReader) readIoLatencyTargets(dirpath string, diskMap map[string]info.DiskInfo) map[string]uint64 {
+	var targets map[string]uint64
+	for device, values := range self.readIoKeyValues(dirpath, "io.latency") {
+		target, ok := values["target"]
+		if !ok || target == "max" {
+			continue
+		}
+		val, err := strconv.ParseUint(target, 10, 64)
+		if err != nil {
+			glog.Errorf("raw driver: Failed to parse int %q from file %q: %s", target, path.Join(dirpath, "io.latency"), err)
+			continue
+		}
+		if targets == nil {
+			targets = make(map[string]uint64)
+		}
+		targets[deviceName(device, diskMap)] = val
+	}
+	return targets
+}
+
+// Reads the quality of service of the io.cost controller at dirpath.
+func (self *cgroupReader) readIoCostQos(dirpath string, diskMap map[string]info.DiskInfo) map[string]info.IoCostQos {
+	var qos map[string]info.IoCostQos
+	for device, values := range self.readIoKeyValues(dirpath, "io.cost.qos") {
+		q, err := parseIoCostQos(values)
+		if err != nil {
+			glog.Errorf("raw driver: Failed to parse the settings of device %q from file %q: %s", device, path.Join(dirpath, "io.cost.qos"), err)
+			continue
+		}
+		if qos == nil {
+			qos = make(map[string]info.IoCostQos)
+		}
+		qos[deviceName(device, diskMap)] = q
+	}
+	return qos
+}
+
+// Parses the io.cost.qos settings of a device (e.g. "enable=1 ctrl=auto
+// rpct=95.00 rlat=10000 wpct=95.00 wlat=20000 min=50.00 max=150.00").
+func parseIoCostQos(values map[string]string) (info.IoCostQos, error) {
+	q := info.IoCostQos{
+		Enabled: values["enable"] == "1",
+		Ctrl:    values["ctrl"],
+	}
+	floats := map[string]*float64{
+		"rpct": &q.ReadLatencyPercentile,
+		"wpct": &q.WriteLatencyPercentile,
+		"min":  &q.MinVrate,
+		"max":  &q.MaxVrate,
+	}
+	for key, dest := range floats {
+		if value, ok := values[key]; ok {
+			val, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return q, err
+			}
+			*dest = val
+		}
+	}
+	uints := map[string]*uint64{
+		"rlat": &q.ReadLatency,
+		"wlat": &q.WriteLatency,
+	}
+	for key, dest := range uints {
+		if value, ok := values[key]; ok {
+			val, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return q, err
+			}
+			*dest = val
+		}
+	}
+	return q, nil
+}
+
+// Reads the io.cost usage and wait of every device from the io.stat file at
+// dirpath, which only has them when the io.cost controller is enabled.
+func (self *cgroupReader) readIoCostStats(dirpath string) []info.PerDiskStats {
+	var stats []info.PerDiskStats
+	for device, values := range self.readIoKeyValues(dirpath, "io.stat") {
+		var major, minor uint64
+		if _, err := fmt.Sscanf(device, "%d:%d", &major, &minor); err != nil {
+			glog.Errorf("raw driver: Failed to parse device %q from file %q: %s", device, path.Join(dirpath, "io.stat"), err)
+			continue
+		}
+		cost := make(map[string]uint64)
+		for _, key := range []string{"usage", "wait", "indebt"} {
+			value, ok := values["cost."+key]
+			if !ok {
+				continue
+			}
+			val, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				glog.Errorf("raw driver: Failed to parse int %q from file %q: %s", value, path.Join(dirpath, "io.stat"), err)
+				continue
+			}
+			cost[key] = val
+		}
+		if len(cost) == 0 {
+			continue
+		}
+		stats = append(stats, info.PerDiskStats{
+			Major: major,
+			Minor: minor,
+			Stats: cost,
+		})
+	}
+	sort.Sort(perDiskStatsByDevice(stats))
+	return stats
+}
+
+// Reads the pressure stall information of a resource from file (e.g.
+// io.pressure) at dirpath. Returns nil if the kernel does not report it, either
+// because the file is missing or because PSI is disabled (psi=0), in which
+// case reads fail with EOPNOTSUPP.
+func (self *cgroupReader) readPressure(dirpath string, file string) *info.PressureStats {
+	pressureFile := path.Join(dirpath, file)
+	out, err := self.readCgroupFile(pressureFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if pathErr, ok := err.(*os.PathError); !ok || pathErr.Err != syscall.EOPNOTSUPP {
+			glog.Errorf("raw driver: Failed to read %q: %s", pressureFile, err)
+		}
+		return nil
+	}
+	pressure, err := parsePressure(string(out))
+	if err != nil {
+		glog.Errorf("raw driver: Failed to parse pressure from file %q: %s", path.Join(dirpath, file), err)
+		return nil
+	}
+	return pressure
+}
+
+// Returns the bytes read and written by the container, summed across devices,
+// from the Read and Write bytes of ioServiceBytes (v1) or else from the rbytes
+// and wbytes of the io.stat file at dirpath (unified hierarchy). Returns nil if
+// neither reports any device.
+func (self *cgroupReader) readIoActivity(dirpath string, ioServiceBytes []info.PerDiskStats) *info.IoActivityStats {
+	if len(ioServiceBytes) != 0 {
+		activity := &info.IoActivityStats{}
+		for _, disk := range ioServiceBytes {
+			activity.ReadBytes += disk.Stats["Read"]
+			activity.WriteBytes += disk.Stats["Write"]
+		}
+		return activity
+	}
+
+	devices := self.readIoKeyValues(dirpath, "io.stat")
+	if len(devices) == 0 {
+		return nil
+	}
+	activity := &info.IoActivityStats{}
+	for _, values := range devices {
+		for key, dest := range map[string]*uint64{"rbytes": &activity.ReadBytes, "wbytes": &activity.WriteBytes} {
+			value, ok := values[key]
+			if !ok {
+				continue
+			}
+			val, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				glog.Errorf("raw driver: Failed to parse int %q from file %q: %s", value, path.Join(dirpath, "io.stat"), err)
+				continue
+			}
+			*dest += val
+		}
+	}
+	return activity
+}
+
+// Parses the pressure stall information of the *.pressure files, which have a
+// "some" and a "full" line of the form
+// "some avg10=0.00 avg60=0.00 avg300=0.00 total=0".
+func parsePressure(out string) (*info.PressureStats, error) {
+	pressure := &info.PressureStats{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var data *info.PressureData
+		switch fields[0] {
+		case "some":
+			data = &pressure.Some
+		case "full":
+			data = &pressure.Full
+		default:
+			return nil, fmt.Errorf("unknown pressure line %q", line)
+		}
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("malformed pressure field %q", field)
+			}
+			var err error
+			switch kv[0] {
+			case "avg10":
+				data.Avg10, err = strconv.ParseFloat(kv[1], 64)
+			case "avg60":
+				data.Avg60, err = strconv.ParseFloat(kv[1], 64)
+			case "avg300":
+				data.Avg300, err = strconv.ParseFloat(kv[1], 64)
+			case "total":
+				data.Total, err = strconv.ParseUint(kv[1], 10, 64)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return pressure, nil
+}
+
+type perDiskStatsByDevice []info.PerDiskStats
+
+func (self perDiskStatsByDevice) Len() int      { return len(self) }
+func (self perDiskStatsByDevice) Swap(i, j int) { self[i], self[j] = self[j], self[i] }
+func (self perDiskStatsByDevice) Less(i, j int) bool {
+	if self[i].Major != self[j].Major {
+		return self[i].Major < self[j].Major
+	}
+	return self[i].Minor < self[j].Minor
+}
+
+// Reads a memory limit of the unified hierarchy (e.g. memory.high), which is
+// either in bytes or "max" when unlimited. Returns 0 if it is not set.
+func (self *cgroupReader) readMemoryLimit(dirpath string, file string) uint64 {
+	return parseMemoryLimit(self.readString(dirpath, file), path.Join(dirpath, file))
+}
+
+func parseMemoryLimit(out string, file string) uint64 {
+	switch out {
+	case "":
+		return 0
+	case "max":
+		return math.MaxUint64
+	}
+
+	val, err := strconv.ParseUint(out, 10, 64)
+	if err != nil {
+		glog.Errorf("raw driver: Failed to parse int %q from file %q: %s", out, file, err)
+		return 0
+	}
+	return val
+}
+
+// Fraction of the TCP memory limit above which the usage is near the limit.
+const tcpMemoryNearLimitRatio = 0.9
+
+// Reads the TCP buffer memory usage and limit of the memory cgroup at dirpath.
+// Returns nil if the kernel does not account TCP memory.
+func (self *cgroupReader) readTcpMemoryStats(dirpath string) *info.TcpMemoryStats {
+	if !utils.FileExists(path.Join(dirpath, "memory.kmem.tcp.usage_in_bytes")) {
+		return nil
+	}
+	stats := &info.TcpMemoryStats{
+		Usage: self.readInt64(dirpath, "memory.kmem.tcp.usage_in_bytes"),
+		Limit: self.readInt64(dirpath, "memory.kmem.tcp.limit_in_bytes"),
+	}
+	stats.NearLimit = stats.Limit != 0 && float64(stats.Usage) >= tcpMemoryNearLimitRatio*float64(stats.Limit)
+	return stats
+}
+
+// Returns whether the specified memory usage is above the high watermark of
+// the memory cgroup at dirpath.
+func (self *rawContainerHandler) isOverMemoryHigh(dirpath string, usage uint64) bool {
+	high := parseMemoryLimit(self.readConfigString(dirpath, "memory.high"), path.Join(dirpath, "memory.high"))
+	return high != 0 && usage > high
+}
+
+// Same as readString for cgroup configuration files, which are only read
+// again when their modification time changed with
+// --skip_unchanged_config_files. Counters must not be read with it: the
+// kernel updates them without changing their modification time.
+func (self *rawContainerHandler) readConfigString(dirpath string, file string) string {
+	if !self.options.SkipUnchangedConfigFiles {
+		return self.reader.readString(dirpath, file)
+	}
+	cgroupFile := path.Join(dirpath, file)
+	fileInfo, err := self.reader.fs.Stat(cgroupFile)
+	self.configFilesLock.Lock()
+	defer self.configFilesLock.Unlock()
+	if err != nil {
+		delete(self.configFiles, cgroupFile)
+		return self.reader.readString(dirpath, file)
+	}
+	if cached, ok := self.configFiles[cgroupFile]; ok && cached.modTime.Equal(fileInfo.ModTime()) {
+		return cached.contents
+	}
+	out := self.reader.readString(dirpath, file)
+	self.configFiles[cgroupFile] = configFile{fileInfo.ModTime(), out}
+	return out
+}
+
+func (self *rawContainerHandler) GetRootNetworkDevices() ([]info.NetInfo, error) {
+	nd := []info.NetInfo{}
+	if self.name == "/" {
+		mi, err := self.machineInfoFactory.GetMachineInfo()
+		if err != nil {
+			return nd, err
+		}
+		return mi.NetworkDevices, nil
+	}
+	return nd, nil
+}
+
+func (self *rawContainerHandler) GetSpec() (info.ContainerSpec, error) {
+	var spec info.ContainerSpec
+
+	// The raw driver assumes unified hierarchy containers.
+
+	// Get machine info.
+	mi, err := self.machineInfoFactory.GetMachineInfo()
+	if err != nil {
+		return spec, err
+	}
+
+	cgroupPaths := self.getCgroupPaths()
+
+	// CPU.
+	cpuRoot, ok := cgroupPaths["cpu"]
+	if ok {
+		if utils.FileExists(cpuRoot) {
+			spec.HasCpu = true
+			spec.Cpu.Limit = self.reader.readInt64(cpuRoot, "cpu.shares")
+			spec.Cpu.RelativeWeight = self.reader.readCpuRelativeWeight(cpuRoot)
+			spec.Cpu.Uclamp = self.reader.readUclamp(cpuRoot)
+			spec.Cpu.Quota, spec.Cpu.Period, spec.Cpu.Burst = self.reader.readCfsBandwidth(cpuRoot)
+		}
+	}
+
+	// Cpu Mask.
+	// This will fail for non-unified hierarchies. We'll return the whole machine mask in that case.
+	cpusetRoot, ok := cgroupPaths["cpuset"]
+	if ok {
+		if utils.FileExists(cpusetRoot) {
+			spec.HasCpu = true
+			spec.Cpu.Mask = self.reader.readString(cpusetRoot, "cpuset.cpus")
+			if spec.Cpu.Mask == "" {
+				spec.Cpu.Mask = fmt.Sprintf("0-%d", mi.NumCores-1)
+			}
+			spec.Cpu.EffectiveMask = self.effectiveCpuMask(spec.Cpu.Mask, mi.OnlineCpus)
+			spec.Cpu.CpuExclusive = self.reader.readString(cpusetRoot, "cpuset.cpu_exclusive") == "1"
+			spec.Cpu.MemExclusive = self.reader.readString(cpusetRoot, "cpuset.mem_exclusive") == "1"
+		}
+	}
+
+	// Memory.
+	memoryRoot, ok := cgroupPaths["memory"]
+	if ok {
+		if utils.FileExists(memoryRoot) {
+			spec.HasMemory = true
+			spec.Memory.Limit = self.reader.readInt64(memoryRoot, "memory.limit_in_bytes")
+			if spec.Memory.Limit == 0 {
+				// The unified hierarchy has memory.max instead.
+				spec.Memory.Limit = self.reader.readMemoryLimit(memoryRoot, "memory.max")
+			}
+			spec.Memory.SwapLimit = self.reader.readInt64(memoryRoot, "memory.memsw.limit_in_bytes")
+			spec.Memory.Low = self.reader.readMemoryLimit(memoryRoot, "memory.low")
+			spec.Memory.High = self.reader.readMemoryLimit(memoryRoot, "memory.high")
+			spec.Memory.OomGroup = self.reader.readString(memoryRoot, "memory.oom.group") == "1"
+		}
+	}
+
+	// Fs.
+	if self.name == "/" || self.getExternalMounts() != nil {
+		spec.HasFilesystem = true
+	}
+
+	//Network
+	spec.HasNetwork = self.hasNetwork
+
+	// DiskIo.
+	if blkioRoot, ok := cgroupPaths["blkio"]; ok && utils.FileExists(blkioRoot) {
+		spec.HasDiskIo = true
+		spec.DiskIo = self.reader.readBlkioThrottleSpec(blkioRoot, mi.DiskMap)
+	}
+
+	// Rdma.
+	if rdmaRoot, ok := cgroupPaths["rdma"]; ok && utils.FileExists(rdmaRoot) {
+		spec.HasRdma = true
+	}
+
+	// Misc.
+	if miscRoot, ok := cgroupPaths["misc"]; ok && utils.FileExists(miscRoot) {
+		spec.HasMisc = true
+	}
+
+	// PerfEvent.
+	self.cgroupPathsLock.RLock()
+	perfEventPath := self.perfEventPath
+	self.cgroupPathsLock.RUnlock()
+	if perfEventPath != "" && utils.FileExists(perfEventPath) {
+		spec.HasPerfEvent = true
+	}
+
+	// Cgroup type, only present on the unified hierarchy.
+	for _, cgroupPath := range cgroupPaths {
+		if cgroupType := self.reader.readString(cgroupPath, "cgroup.type"); cgroupType != "" {
+			spec.CgroupType = cgroupType
+			break
+		}
+	}
+
+	spec.EnabledControllers = self.reader.enabledControllers(cgroupPaths)
+	if devicesRoot, ok := cgroupPaths["devices"]; ok && utils.FileExists(devicesRoot) {
+		spec.Devices = self.reader.readDevicesList(devicesRoot)
+	}
+
+	spec.Init, spec.Rootfs = self.getInitProcess("/proc")
+
+	// Check physical network devices for root container.
+	nd, err := self.GetRootNetworkDevices()
+	if err != nil {
+		return spec, err
+	}
+	if len(nd) != 0 {
+		spec.HasNetwork = true
+	}
+	return spec, nil
+}
+
+// Sets the time the threads of the container waited for a cpu, with
+// --sched_wait_time, and the contention time of the container: the time it
+// was throttled plus the time its threads waited for a cpu. It approximates
+// the time the container was runnable but starved, e.g. by noisy neighbors:
+// the throttled time is wall time during which any number of threads may have
+// wanted a cpu, while the wait time is summed across threads and only covers
+// the threads alive now. Throttled threads are off the runqueues, so the two
+// do not overlap much.
+func (self *rawContainerHandler) addCpuContention(stats *info.ContainerStats, procRoot string) {
+	if self.options.SchedWaitTime {
+		stats.Cpu.SchedWaitTime = self.getSchedWaitTime(procRoot)
+	}
+	stats.Cpu.ContentionTime = stats.Cpu.ThrottledTime + stats.Cpu.SchedWaitTime
+}
+
+// Returns the time the threads of the container and of its subcontainers
+// waited for a cpu, from the procfs mounted at procRoot. Threads that exit
+// while they are read are skipped.
+func (self *rawContainerHandler) getSchedWaitTime(procRoot string) uint64 {
+	tids, err := self.ListThreads(container.ListRecursive)
+	if err != nil {
+		glog.V(4).Infof("raw driver: Failed to list the threads of container %q: %v", self.name, err)
+		return 0
+	}
+	var total time.Duration
+	for _, tid := range tids {
+		_, waitTime, err := procfs.GetSchedstat(procRoot, tid)
+		if err != nil {
+			continue
+		}
+		total += waitTime
+	}
+	return uint64(total)
+}
+
+// Returns the IO counters summed across the processes of the container and of
+// its subcontainers, from the procfs mounted at procRoot. Processes that exit
+// while they are read, or whose io file cannot be read for lack of
+// permission, are skipped.
+func (self *rawContainerHandler) getApplicationIo(procRoot string) info.ApplicationIoStats {
+	var total info.ApplicationIoStats
+	pids, err := self.ListProcesses(container.ListRecursive)
+	if err != nil {
+		glog.V(4).Infof("raw driver: Failed to list the processes of container %q: %v", self.name, err)
+		return total
+	}
+	for _, pid := range pids {
+		processIo, err := procfs.GetProcessIo(procRoot, pid)
+		if err != nil {
+			glog.V(5).Infof("raw driver: Failed to get the io of process %d of container %q: %v", pid, self.name, err)
+			continue
+		}
+		total.Rchar += processIo.Rchar
+		total.Wchar += processIo.Wchar
+		total.Syscr += processIo.Syscr
+		total.Syscw += processIo.Syscw
+		total.ReadBytes += processIo.ReadBytes
+		total.WriteBytes += processIo.WriteBytes
+	}
+	return total
+}
+
+// Sets the highest OOM killer score and adjustment across the processes of the
+// container and of its subcontainers in stats, from the procfs mounted at
+// procRoot. Processes whose scores cannot be read, usually because they
+// exited, are skipped.
+func (self *rawContainerHandler) addOomScores(stats *info.ProcessStats, procRoot string) {
+	pids, err := self.ListProcesses(container.ListRecursive)
+	if err != nil {
+		glog.V(4).Infof("raw driver: Failed to list the processes of container %q: %v", self.name, err)
+		return
+	}
+	first := true
+	for _, pid := range pids {
+		score, adj, err := procfs.GetOomScore(procRoot, pid)
+		if err != nil {
+			glog.V(5).Infof("raw driver: Failed to get the oom score of process %d of container %q: %v", pid, self.name, err)
+			continue
+		}
+		if first || score > stats.MaxOomScore {
+			stats.MaxOomScore = score
+			stats.MaxOomScorePid = pid
+		}
+		if first || adj > stats.MaxOomScoreAdj {
+			stats.MaxOomScoreAdj = adj
+		}
+		first = false
+	}
+}
+
+// Reads the device access rules of the devices cgroup at dirpath, one per line
+// in the format "c 1:3 rwm" with "*" for any major or minor number.
+func (self *cgroupReader) readDevicesList(dirpath string) []info.DeviceRule {
+	out := self.readString(dirpath, "devices.list")
+	var rules []info.DeviceRule
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" {
+			continue
+		}
+		rule, err := parseDeviceRule(line)
+		if err != nil {
+			glog.Errorf("raw driver: Failed to parse device rule %q from file %q: %s", line, path.Join(dirpath, "devices.list"), err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func parseDeviceRule(line string) (info.DeviceRule, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return info.DeviceRule{}, fmt.Errorf("expected 3 fields")
+	}
+	numbers := strings.Split(fields[1], ":")
+	if len(numbers) != 2 {
+		return info.DeviceRule{}, fmt.Errorf("invalid device numbers %q", fields[1])
+	}
+	var ids [2]int64
+	for i, number := range numbers {
+		if number == "*" {
+			ids[i] = info.DeviceWildcard
+			continue
+		}
+		id, err := strconv.ParseInt(number, 10, 64)
+		if err != nil {
+			return info.DeviceRule{}, err
+		}
+		ids[i] = id
+	}
+	return info.DeviceRule{
+		Type:   fields[0],
+		Major:  ids[0],
+		Minor:  ids[1],
+		Access: fields[2],
+	}, nil
+}
+
+// Returns the cpus of mask that are in onlineCpus. Returns mask as is when the
+// online cpus are unknown or either list is invalid.
+func (self *rawContainerHandler) effectiveCpuMask(mask string, onlineCpus string) string {
+	if onlineCpus == "" {
+		return mask
+	}
+	cpus, err := info.ParseCpuList(mask)
+	if err != nil {
+		glog.Errorf("raw driver: Failed to parse the cpuset of container %q: %v", self.name, err)
+		return mask
+	}
+	online, err := info.ParseCpuList(onlineCpus)
+	if err != nil {
+		glog.Errorf("raw driver: Failed to parse the online cpus: %v", err)
+		return mask
+	}
+	onlineSet := make(map[int]struct{}, len(online))
+	for _, cpu := range online {
+		onlineSet[cpu] = struct{}{}
+	}
+	var effective []int
+	for _, cpu := range cpus {
+		if _, ok := onlineSet[cpu]; ok {
+			effective = append(effective, cpu)
+		}
+	}
+	if len(effective) == 0 {
+		glog.Warningf("raw driver: None of the cpus %q of container %q is online", mask, self.name)
+	}
+	return info.FormatCpuList(effective)
+}
+
+// Returns the root mount of the process pid of the container, from the procfs
+// mounted at procRoot. Nil when the process exited.
+func (self *rawContainerHandler) getRootfsSpec(procRoot string, pid int) *info.RootfsSpec {
+	procDir := path.Join(procRoot, strconv.Itoa(pid))
+	hasMountNamespace, err := hasOwnMountNamespace(procDir, path.Join(procRoot, "1"))
+	if err != nil {
+		glog.V(4).Infof("raw driver: Failed to get the mount namespace of process %d of container %q: %v", pid, self.name, err)
+		return nil
+	}
+	if !hasMountNamespace {
+		return &info.RootfsSpec{}
+	}
+	spec, err := sysinfo.GetRootfsSpec(path.Join(procDir, "mountinfo"))
+	if err != nil {
+		glog.V(4).Infof("raw driver: Failed to get the root mount of container %q: %v", self.name, err)
+		return nil
+	}
+	return &spec
+}
+
+// Returns the first process of the container and its root mount, from the
+// procfs mounted at procRoot. They are only read again once the process
+// exited, the pids are listed on every call so that a new process is then
+// reported. Nil when the container has no processes.
+func (self *rawContainerHandler) getInitProcess(procRoot string) (*info.ProcessSpec, *info.RootfsSpec) {
+	pids, err := self.ListProcesses(container.ListSelf)
+	if err != nil {
+		return nil, nil
+	}
+
+	self.initProcessLock.Lock()
+	defer self.initProcessLock.Unlock()
+	if self.initProcess != nil && isRunning(procRoot, pids, self.initProcess.Pid) {
+		return self.initProcess, self.rootfs
+	}
+	self.initProcess = self.readInitProcess(procRoot, pids)
+	self.rootfs = nil
+	if self.initProcess != nil {
+		self.rootfs = self.getRootfsSpec(procRoot, self.initProcess.Pid)
+	}
+	return self.initProcess, self.rootfs
+}
+
+// Returns whether the process pid is among the processes pids of the container
+// and still running.
+func isRunning(procRoot string, pids []int, pid int) bool {
+	for _, p := range pids {
+		if p == pid {
+			return utils.FileExists(path.Join(procRoot, strconv.Itoa(pid)))
+		}
+	}
+	return false
+}
+
+// Returns the first of the processes pids that is still running. Nil when none
+// is.
+func (self *rawContainerHandler) readInitProcess(procRoot string, pids []int) *info.ProcessSpec {
+	// Processes that exited since they were listed are skipped.
+	for _, pid := range pids {
+		command, err := procfs.GetCmdline(procRoot, pid)
+		if err != nil {
+			glog.V(4).Infof("raw driver: Failed to get the command line of process %d of container %q: %v", pid, self.name, err)
+			continue
+		}
+		startTime, err := procfs.GetStartTime(procRoot, pid)
+		if err != nil {
+			glog.V(4).Infof("raw driver: Failed to get the start time of process %d of container %q: %v", pid, self.name, err)
+			continue
+		}
+		process := &info.ProcessSpec{
+			Pid:       pid,
+			Command:   command,
+			StartTime: startTime,
+		}
+		soft, hard, err := procfs.GetOpenFilesLimit(procRoot, pid)
+		if err != nil {
+			glog.V(4).Infof("raw driver: Failed to get the open files limit of process %d of container %q: %v", pid, self.name, err)
+		} else {
+			process.OpenFilesLimit = &info.RlimitSpec{Soft: soft, Hard: hard}
+		}
+		return process
+	}
+	return nil
+}
+
+// Returns whether the process at procDir has a mount namespace other than the
+// one of the process at hostProcDir.
+func hasOwnMountNamespace(procDir string, hostProcDir string) (bool, error) {
+	ns, err := os.Readlink(path.Join(procDir, "ns", "mnt"))
+	if err != nil {
+		return false, err
 	}
-
-	val, err := strconv.ParseUint(out, 10, 64)
+	hostNs, err := os.Readlink(path.Join(hostProcDir, "ns", "mnt"))
 	if err != nil {
-		glog.Errorf("raw driver: Failed to parse int %q from file %q: %s", out, path.Join(dirpath, file), err)
-		return 0
+		return false, err
 	}
-
-	return val
+	return ns != hostNs, nil
 }
 
-func (self *rawContainerHandler) GetRootNetworkDevices() ([]info.NetInfo, error) {
-	nd := []info.NetInfo{}
-	if self.name == "/" {
-		mi, err := self.machineInfoFactory.GetMachineInfo()
-		if err != nil {
-			return nd, err
-		}
-		return mi.NetworkDevices, nil
+// Filesystem stats are skipped for this round if the error is temporary so
+// the rest of the stats are still reported. Permanent errors are returned.
+func (self *rawContainerHandler) handleFsError(err error) error {
+	if fs.IsTemporary(err) {
+		glog.Warningf("raw driver: Skipping filesystem stats of %q: %v", self.name, err)
+		return nil
 	}
-	return nd, nil
+	return err
 }
 
-func (self *rawContainerHandler) GetSpec() (info.ContainerSpec, error) {
-	var spec info.ContainerSpec
-
-	// The raw driver assumes unified hierarchy containers.
-
-	// Get machine info.
-	mi, err := self.machineInfoFactory.GetMachineInfo()
-	if err != nil {
-		return spec, err
+// Filesystem stats change slowly and are expensive to collect, unlike cpu and
+// memory stats. They are collected at most once per --filesystem_stats_interval
+// and the latest snapshot is reported in between.
+func (self *rawContainerHandler) getSampledFsStats(stats *info.ContainerStats) error {
+	if self.options.FsStatsInterval <= 0 {
+		return self.getFsStats(stats)
 	}
 
-	// CPU.
-	cpuRoot, ok := self.cgroupPaths["cpu"]
-	if ok {
-		if utils.FileExists(cpuRoot) {
-			spec.HasCpu = true
-			spec.Cpu.Limit = readInt64(cpuRoot, "cpu.shares")
+	self.fsStatsLock.Lock()
+	defer self.fsStatsLock.Unlock()
+	if self.fsStatsTime.IsZero() || self.clock.Now().Sub(self.fsStatsTime) >= self.options.FsStatsInterval {
+		sample := &info.ContainerStats{}
+		err := self.getFsStats(sample)
+		if err != nil {
+			return err
 		}
+		self.fsStats = sample.Filesystem
+		self.fsSubpathStats = sample.Subpaths
+		self.fsStatsTime = self.clock.Now()
 	}
+	stats.Filesystem = append([]info.FsStats(nil), self.fsStats...)
+	stats.Subpaths = append([]info.SubpathStats(nil), self.fsSubpathStats...)
+	return nil
+}
 
-	// Cpu Mask.
-	// This will fail for non-unified hierarchies. We'll return the whole machine mask in that case.
-	cpusetRoot, ok := self.cgroupPaths["cpuset"]
-	if ok {
-		if utils.FileExists(cpusetRoot) {
-			spec.HasCpu = true
-			spec.Cpu.Mask = readString(cpusetRoot, "cpuset.cpus")
-			if spec.Cpu.Mask == "" {
-				spec.Cpu.Mask = fmt.Sprintf("0-%d", mi.NumCores-1)
+// Computes the usage of the directories listed in the hints of the container,
+// reusing the usage computed less than --subpath_usage_ttl ago. Directories
+// that do not exist are skipped.
+func (self *rawContainerHandler) getSubpathStats(stats *info.ContainerStats) error {
+	self.subpathUsageLock.Lock()
+	defer self.subpathUsageLock.Unlock()
+	for _, dir := range self.subpaths {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			delete(self.subpathUsage, dir)
+			continue
+		}
+		cached, ok := self.subpathUsage[dir]
+		if !ok || self.clock.Now().Sub(cached.time) >= self.options.SubpathUsageTtl {
+			usage, err := self.fsInfo.GetDirUsage(dir)
+			if err != nil {
+				if err = self.handleFsError(err); err != nil {
+					return err
+				}
+				continue
 			}
+			cached = subpathUsage{usage: usage, time: self.clock.Now()}
+			self.subpathUsage[dir] = cached
 		}
+		stats.Subpaths = append(stats.Subpaths, info.SubpathStats{Path: dir, Usage: cached.usage})
 	}
+	return nil
+}
 
-	// Memory.
-	memoryRoot, ok := self.cgroupPaths["memory"]
-	if ok {
-		if utils.FileExists(memoryRoot) {
-			spec.HasMemory = true
-			spec.Memory.Limit = readInt64(memoryRoot, "memory.limit_in_bytes")
-			spec.Memory.SwapLimit = readInt64(memoryRoot, "memory.memsw.limit_in_bytes")
+func (self *rawContainerHandler) getExternalMounts() []mount {
+	self.externalMountsLock.RLock()
+	defer self.externalMountsLock.RUnlock()
+	return self.externalMounts
+}
+
+// Registers hostDir as mounted at containerDir in the container, so the
+// filesystem of hostDir is reported in the stats of the container.
+func (self *rawContainerHandler) AddExternalMount(hostDir, containerDir string) error {
+	self.externalMountsLock.Lock()
+	for _, mount := range self.externalMounts {
+		if path.Clean(mount.HostDir) == path.Clean(hostDir) {
+			self.externalMountsLock.Unlock()
+			return fmt.Errorf("%q is already an external mount of container %q", hostDir, self.name)
 		}
 	}
+	// The slice is replaced rather than appended to since readers use it
+	// without holding the lock.
+	externalMounts := make([]mount, len(self.externalMounts), len(self.externalMounts)+1)
+	copy(externalMounts, self.externalMounts)
+	self.externalMounts = append(externalMounts, mount{HostDir: hostDir, ContainerDir: containerDir})
+	self.externalMountsLock.Unlock()
+
+	self.resetSampledFsStats()
+	return nil
+}
 
-	// Fs.
-	if self.name == "/" || self.externalMounts != nil {
-		spec.HasFilesystem = true
+// Unregisters the external mount of hostDir.
+func (self *rawContainerHandler) RemoveExternalMount(hostDir string) {
+	self.externalMountsLock.Lock()
+	var externalMounts []mount
+	for _, mount := range self.externalMounts {
+		if path.Clean(mount.HostDir) != path.Clean(hostDir) {
+			externalMounts = append(externalMounts, mount)
+		}
 	}
+	self.externalMounts = externalMounts
+	self.externalMountsLock.Unlock()
 
-	//Network
-	spec.HasNetwork = self.hasNetwork
+	self.resetSampledFsStats()
+}
 
-	// DiskIo.
-	if blkioRoot, ok := self.cgroupPaths["blkio"]; ok && utils.FileExists(blkioRoot) {
-		spec.HasDiskIo = true
-	}
+// Drops the latest filesystem stats so the next GetStats collects them again.
+func (self *rawContainerHandler) resetSampledFsStats() {
+	self.fsStatsLock.Lock()
+	defer self.fsStatsLock.Unlock()
+	self.fsStatsTime = time.Time{}
+}
 
-	// Check physical network devices for root container.
-	nd, err := self.GetRootNetworkDevices()
+// Gets the filesystems the external mounts of the container are on, sorted by
+// mountpoint. The directories mounted that are not the root of their
+// filesystem (bind mounts) are returned keyed by the mountpoint of their
+// filesystem, which is shared with the host.
+func (self *rawContainerHandler) getExternalMountsFs() ([]fs.Fs, map[string][]string, error) {
+	externalMounts := self.getExternalMounts()
+
+	// The filesystem of a directory is mounted at the directory or at one
+	// of its ancestors.
+	mountSet := make(map[string]struct{})
+	for _, mount := range externalMounts {
+		for dir := path.Clean(mount.HostDir); ; dir = path.Dir(dir) {
+			mountSet[dir] = struct{}{}
+			if dir == "/" || dir == "." {
+				break
+			}
+		}
+	}
+	candidates, err := self.fsInfo.GetFsInfoForPath(mountSet)
 	if err != nil {
-		return spec, err
+		return nil, nil, err
 	}
-	if len(nd) != 0 {
-		spec.HasNetwork = true
+	mountpoints := make(map[string]struct{}, len(candidates))
+	for _, fs := range candidates {
+		mountpoints[fs.Mountpoint] = struct{}{}
 	}
-	return spec, nil
+
+	used := make(map[string]struct{})
+	bindMounts := make(map[string][]string)
+	for _, mount := range externalMounts {
+		hostDir := path.Clean(mount.HostDir)
+		for dir := hostDir; ; dir = path.Dir(dir) {
+			if _, ok := mountpoints[dir]; ok {
+				used[dir] = struct{}{}
+				if dir != hostDir {
+					bindMounts[dir] = append(bindMounts[dir], hostDir)
+				}
+				break
+			}
+			if dir == "/" || dir == "." {
+				break
+			}
+		}
+	}
+	var filesystems []fs.Fs
+	for _, fs := range candidates {
+		if _, ok := used[fs.Mountpoint]; ok {
+			filesystems = append(filesystems, fs)
+		}
+	}
+	return filesystems, bindMounts, nil
 }
 
 func (self *rawContainerHandler) getFsStats(stats *info.ContainerStats) error {
+	var filesystems []fs.Fs
+	var bindMounts map[string][]string
+	var err error
 	// Get Filesystem information only for the root cgroup.
 	if self.name == "/" {
-		filesystems, err := self.fsInfo.GetGlobalFsInfo()
+		filesystems, err = self.fsInfo.GetGlobalFsInfo()
 		if err != nil {
-			return err
+			return self.handleFsError(err)
 		}
-		for _, fs := range filesystems {
-			stats.Filesystem = append(stats.Filesystem,
-				info.FsStats{
-					Device:          fs.Device,
-					Limit:           fs.Capacity,
-					Usage:           fs.Capacity - fs.Free,
-					ReadsCompleted:  fs.DiskStats.ReadsCompleted,
-					ReadsMerged:     fs.DiskStats.ReadsMerged,
-					SectorsRead:     fs.DiskStats.SectorsRead,
-					ReadTime:        fs.DiskStats.ReadTime,
-					WritesCompleted: fs.DiskStats.WritesCompleted,
-					WritesMerged:    fs.DiskStats.WritesMerged,
-					SectorsWritten:  fs.DiskStats.SectorsWritten,
-					WriteTime:       fs.DiskStats.WriteTime,
-					IoInProgress:    fs.DiskStats.IoInProgress,
-					IoTime:          fs.DiskStats.IoTime,
-					WeightedIoTime:  fs.DiskStats.WeightedIoTime,
-				})
-		}
-	} else if len(self.externalMounts) > 0 {
-		var mountSet map[string]struct{}
-		mountSet = make(map[string]struct{})
-		for _, mount := range self.externalMounts {
-			mountSet[mount.HostDir] = struct{}{}
-		}
-		filesystems, err := self.fsInfo.GetFsInfoForPath(mountSet)
+	} else if len(self.getExternalMounts()) > 0 {
+		filesystems, bindMounts, err = self.getExternalMountsFs()
 		if err != nil {
-			return err
+			return self.handleFsError(err)
 		}
-		for _, fs := range filesystems {
-			stats.Filesystem = append(stats.Filesystem,
-				info.FsStats{
-					Device:          fs.Device,
-					Limit:           fs.Capacity,
-					Usage:           fs.Capacity - fs.Free,
-					ReadsCompleted:  fs.DiskStats.ReadsCompleted,
-					ReadsMerged:     fs.DiskStats.ReadsMerged,
-					SectorsRead:     fs.DiskStats.SectorsRead,
-					ReadTime:        fs.DiskStats.ReadTime,
-					WritesCompleted: fs.DiskStats.WritesCompleted,
-					WritesMerged:    fs.DiskStats.WritesMerged,
-					SectorsWritten:  fs.DiskStats.SectorsWritten,
-					WriteTime:       fs.DiskStats.WriteTime,
-					IoInProgress:    fs.DiskStats.IoInProgress,
-					IoTime:          fs.DiskStats.IoTime,
-					WeightedIoTime:  fs.DiskStats.WeightedIoTime,
-				})
+	}
+	if self.options.DedupeFsStats {
+		filesystems = fs.DedupeByDevice(filesystems)
+	}
+	for _, fs := range filesystems {
+		usage := fs.Capacity - fs.Free
+		dirs, shared := bindMounts[fs.Mountpoint]
+		if shared && self.options.BindMountFsUsage {
+			usage = 0
+			for _, dir := range dirs {
+				dirUsage, err := self.fsInfo.GetDirUsage(dir)
+				if err != nil {
+					return self.handleFsError(err)
+				}
+				usage += dirUsage
+			}
 		}
+		stats.Filesystem = append(stats.Filesystem,
+			info.FsStats{
+				Device:          fs.Device,
+				Mountpoint:      fs.Mountpoint,
+				Limit:           fs.Capacity,
+				Usage:           usage,
+				Shared:          shared,
+				ReadsCompleted:  fs.DiskStats.ReadsCompleted,
+				ReadsMerged:     fs.DiskStats.ReadsMerged,
+				SectorsRead:     fs.DiskStats.SectorsRead,
+				ReadTime:        fs.DiskStats.ReadTime,
+				WritesCompleted: fs.DiskStats.WritesCompleted,
+				WritesMerged:    fs.DiskStats.WritesMerged,
+				SectorsWritten:  fs.DiskStats.SectorsWritten,
+				WriteTime:       fs.DiskStats.WriteTime,
+				IoInProgress:    fs.DiskStats.IoInProgress,
+				IoTime:          fs.DiskStats.IoTime,
+				WeightedIoTime:  fs.DiskStats.WeightedIoTime,
+			})
 	}
-	return nil
+	return self.getSubpathStats(stats)
 }
 
+// Safe for concurrent use, as is GetSpec: the state updated while collecting
+// stats (the sampled filesystem stats, the last stats of deltas and the custom
+// collectors) is locked.
 func (self *rawContainerHandler) GetStats() (*info.ContainerStats, error) {
-	stats, err := libcontainer.GetStats(self.cgroupPaths, &self.libcontainerState)
+	self.checkCgroupMounts()
+	start := self.clock.Now()
+	stats, err := self.getStatsWithCost()
+	if stats != nil {
+		stats.Timestamp = start
+		stats.CollectionDuration = self.clock.Now().Sub(start)
+	}
+	if err != nil {
+		return stats, err
+	}
+
+	switch {
+	case self.options.StatsDeltas:
+		return self.toStatsDelta(stats), nil
+	case self.options.StatsSinceCreation:
+		return self.toStatsSinceCreation(stats), nil
+	}
+	self.detectCounterReset(stats)
+	return stats, nil
+}
+
+// Gets the stats of the container and, with --record_collection_cost, the files
+// read to collect them.
+func (self *rawContainerHandler) getStatsWithCost() (*info.ContainerStats, error) {
+	if !self.options.RecordCollectionCost {
+		return self.getStats()
+	}
+	self.collectionCostLock.Lock()
+	defer self.collectionCostLock.Unlock()
+
+	files, duration := atomic.LoadUint64(&self.reader.filesRead), atomic.LoadInt64(&self.reader.readDuration)
+	stats, err := self.getStats()
+	if stats != nil {
+		stats.CollectionCost = &info.CollectionCost{
+			FilesRead:    atomic.LoadUint64(&self.reader.filesRead) - files,
+			ReadDuration: time.Duration(atomic.LoadInt64(&self.reader.readDuration) - duration),
+		}
+	}
+	return stats, err
+}
+
+func (self *rawContainerHandler) getStats() (*info.ContainerStats, error) {
+	if self.options.StrictSubsystems {
+		cgroupPaths := self.getCgroupPaths()
+		for _, subsystem := range self.subsystems {
+			if !utils.FileExists(cgroupPaths[subsystem]) {
+				return &info.ContainerStats{}, fmt.Errorf("cgroup of subsystem %q of container %q is missing", subsystem, self.name)
+			}
+		}
+	}
+
+	self.cgroupPathsLock.RLock()
+	cgroupPaths, libcontainerState := self.cgroupPaths, self.libcontainerState
+	self.cgroupPathsLock.RUnlock()
+	start := time.Now()
+	readDuration := atomic.LoadInt64(&self.reader.readDuration)
+	stats, err := libcontainer.GetStats(cgroupPaths, &libcontainerState, self.reader.readCgroupFile, self.options.Stats)
+	if self.options.RecordCollectionCost {
+		// Libcontainer reads the files of the v1 hierarchies itself, the
+		// other files went through the reader and are already recorded.
+		readerDuration := time.Duration(atomic.LoadInt64(&self.reader.readDuration) - readDuration)
+		self.reader.recordReads(libcontainer.CountStatsFiles(cgroupPaths, &libcontainerState), time.Since(start)-readerDuration)
+	}
 	if err != nil {
 		return stats, err
 	}
 
-	err = self.getFsStats(stats)
+	if self.statsFromProc {
+		err = addMachineUsage(stats, "/proc")
+		if err != nil {
+			return stats, err
+		}
+	} else if self.name == "/" {
+		err = addMachineCpuTimes(stats, "/proc")
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	err = self.getSampledFsStats(stats)
 	if err != nil {
 		return stats, err
 	}
 
+	self.addCpuContention(stats, "/proc")
+
+	if self.options.ApplicationIoStats {
+		stats.ApplicationIo = self.getApplicationIo("/proc")
+	}
+
+	// A thread is in one cgroup of every hierarchy, the threads are counted
+	// once across them. The hierarchies without a cgroup for the container
+	// are skipped.
+	if self.options.ThreadCountStats {
+		tids, err := self.ListThreads(container.ListSelf)
+		if err != nil {
+			glog.Warningf("Failed to count the threads of container %q: %v", self.name, err)
+		} else {
+			stats.Processes.ThreadCount = uint64(len(tids))
+		}
+	}
+	if self.options.OomScoreStats {
+		self.addOomScores(&stats.Processes, "/proc")
+	}
+
+	if blkioRoot, ok := cgroupPaths["blkio"]; ok {
+		stats.DiskIo.IoCost = self.reader.readIoCostStats(blkioRoot)
+		stats.DiskIo.Pressure = self.reader.readPressure(blkioRoot, "io.pressure")
+		if len(stats.Filesystem) == 0 {
+			stats.FilesystemActivity = self.reader.readIoActivity(blkioRoot, stats.DiskIo.IoServiceBytes)
+		}
+	}
+
+	if memoryRoot, ok := cgroupPaths["memory"]; ok {
+		stats.Memory.OverHigh = self.isOverMemoryHigh(memoryRoot, stats.Memory.Usage)
+		stats.Network.TcpMemory = self.reader.readTcpMemoryStats(memoryRoot)
+	}
+
 	// Fill in network stats for root.
 	nd, err := self.GetRootNetworkDevices()
 	if err != nil {
@@ -320,22 +1816,170 @@ func (self *rawContainerHandler) GetStats() (*info.ContainerStats, error) {
 	if len(nd) != 0 {
 		// ContainerStats only reports stat for one network device.
 		// TODO(rjnagal): Handle multiple physical network devices.
-		stats.Network, err = sysinfo.GetNetworkStats(nd[0].Name)
+		netStats, err := sysinfo.GetNetworkStats(nd[0].Name)
+		if err != nil {
+			return stats, err
+		}
+		// Keep the stats of the memory cgroup.
+		netStats.TcpMemory = stats.Network.TcpMemory
+		stats.Network = netStats
+		stats.Network.Interfaces, err = sysinfo.GetAllNetworkStats(self.options.LoopbackNetworkStats)
+		if err != nil {
+			return stats, err
+		}
+		err = libcontainer.AddNamespaceNetworkStats(&stats.Network, 0, self.options.Stats)
+		if err != nil {
+			return stats, err
+		}
+	} else if self.hasNetwork {
+		// Any process of the container is in its network namespace.
+		pids, err := self.listIds("cgroup.procs", container.ListSelf)
 		if err != nil {
 			return stats, err
 		}
+		if len(pids) != 0 {
+			err = libcontainer.AddNamespaceNetworkStats(&stats.Network, pids[0], self.options.Stats)
+			if err != nil {
+				return stats, err
+			}
+		}
 	}
+
+	self.collectCustomMetrics(stats)
 	return stats, nil
 }
 
+// Registers a collector whose metrics are added to the stats of this container.
+func (self *rawContainerHandler) AddCollector(name string, collector container.Collector) error {
+	self.collectorsLock.Lock()
+	defer self.collectorsLock.Unlock()
+	if _, ok := self.collectors[name]; ok {
+		return fmt.Errorf("collector %q is already registered for container %q", name, self.name)
+	}
+	self.collectors[name] = collector
+	return nil
+}
+
+// Unregisters the specified collector.
+func (self *rawContainerHandler) RemoveCollector(name string) {
+	self.collectorsLock.Lock()
+	defer self.collectorsLock.Unlock()
+	delete(self.collectors, name)
+}
+
+// Adds the metrics of all registered collectors to stats. Failing collectors
+// are logged and skipped so they don't fail the collection of the other stats.
+func (self *rawContainerHandler) collectCustomMetrics(stats *info.ContainerStats) {
+	self.collectorsLock.Lock()
+	defer self.collectorsLock.Unlock()
+	if len(self.collectors) == 0 {
+		return
+	}
+
+	stats.CustomMetrics = make(map[string]float64)
+	for name, collector := range self.collectors {
+		metrics, err := collector.Collect()
+		if err != nil {
+			glog.Warningf("raw driver: Failed to collect custom metrics of %q from collector %q: %v", self.name, name, err)
+			continue
+		}
+		for metric, value := range metrics {
+			stats.CustomMetrics[metric] = value
+		}
+	}
+}
+
+// Converts the cumulative stats to the delta since the last read. The first
+// read has no baseline and reports no change.
+func (self *rawContainerHandler) toStatsDelta(stats *info.ContainerStats) *info.ContainerStats {
+	self.lastStatsLock.Lock()
+	defer self.lastStatsLock.Unlock()
+	prev := self.lastStats
+	if prev == nil {
+		prev = stats
+	}
+	self.lastStats = stats
+	return &stats.Sub(prev).ContainerStats
+}
+
+// Sets CounterReset on the cumulative stats when a counter went backwards
+// since the last read.
+func (self *rawContainerHandler) detectCounterReset(stats *info.ContainerStats) {
+	self.lastStatsLock.Lock()
+	defer self.lastStatsLock.Unlock()
+	if self.lastStats != nil {
+		stats.CounterReset = stats.Sub(self.lastStats).CounterReset
+	}
+	self.lastStats = stats
+}
+
+// Converts the cumulative stats to the change since the first read. A counter
+// reset moves the baseline to the stats read, so that the counters restart
+// from zero instead of staying at zero until they catch up with the old
+// baseline.
+func (self *rawContainerHandler) toStatsSinceCreation(stats *info.ContainerStats) *info.ContainerStats {
+	self.lastStatsLock.Lock()
+	defer self.lastStatsLock.Unlock()
+	reset := self.lastStats != nil && stats.Sub(self.lastStats).CounterReset
+	self.lastStats = stats
+	if self.baselineStats == nil || reset {
+		self.baselineStats = stats
+	}
+	ret := &stats.Sub(self.baselineStats).ContainerStats
+	ret.CounterReset = reset
+	return ret
+}
+
 func (self *rawContainerHandler) GetCgroupPath(resource string) (string, error) {
-	path, ok := self.cgroupPaths[resource]
+	path, ok := self.getCgroupPaths()[resource]
 	if !ok {
 		return "", fmt.Errorf("could not find path for resource %q for container %q\n", resource, self.name)
 	}
 	return path, nil
 }
 
+// Returns the path of the cgroup of the container for resource relative to the
+// mountpoint of its hierarchy (e.g. "/test" for "/sys/fs/cgroup/cpu/test"), as
+// expected by tools that do not know where the hierarchies are mounted.
+func (self *rawContainerHandler) GetRelativeCgroupPath(resource string) (string, error) {
+	self.cgroupPathsLock.RLock()
+	cgroupPath, ok := self.cgroupPaths[resource]
+	mountpoint := self.cgroupSubsystems.MountPoints[resource]
+	self.cgroupPathsLock.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("could not find path for resource %q for container %q", resource, self.name)
+	}
+	if mountpoint == "" || (cgroupPath != mountpoint && !strings.HasPrefix(cgroupPath, strings.TrimSuffix(mountpoint, "/")+"/")) {
+		return "", fmt.Errorf("path %q for resource %q for container %q is not under the mountpoint %q of its hierarchy", cgroupPath, resource, self.name, mountpoint)
+	}
+	return path.Join("/", strings.TrimPrefix(cgroupPath, mountpoint)), nil
+}
+
+// Returns the contents of file in the cgroup of the specified subsystem. This is a
+// debugging aid and is only allowed when --allow_cgroup_file_reads is set.
+func (self *rawContainerHandler) ReadCgroupFile(subsystem, file string) (string, error) {
+	if !self.options.AllowCgroupFileReads {
+		return "", fmt.Errorf("reading cgroup files is disabled, enable with --allow_cgroup_file_reads")
+	}
+	cgroupPath, ok := self.getCgroupPaths()[subsystem]
+	if !ok {
+		return "", fmt.Errorf("unknown cgroup subsystem %q for container %q", subsystem, self.name)
+	}
+
+	// Ensure the file does not escape the cgroup directory.
+	cgroupPath = path.Clean(cgroupPath)
+	cgroupFile := path.Join(cgroupPath, file)
+	if path.IsAbs(file) || !strings.HasPrefix(cgroupFile, cgroupPath+"/") {
+		return "", fmt.Errorf("cgroup file %q is outside of the %q cgroup of container %q", file, subsystem, self.name)
+	}
+
+	out, err := self.reader.readCgroupFile(cgroupFile)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
 // Lists all directories under "path" and outputs the results as children of "parent".
 func listDirectories(dirpath string, parent string, recursive bool, output map[string]struct{}) error {
 	// Ignore if this hierarchy does not exist.
@@ -367,16 +2011,16 @@ func listDirectories(dirpath string, parent string, recursive bool, output map[s
 
 func (self *rawContainerHandler) ListContainers(listType container.ListType) ([]info.ContainerReference, error) {
 	containers := make(map[string]struct{})
-	for _, cgroupPath := range self.cgroupPaths {
+	for _, cgroupPath := range self.getCgroupPaths() {
 		err := listDirectories(cgroupPath, self.name, listType == container.ListRecursive, containers)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	// Make into container references.
+	// Make into container references, sorted by name.
 	ret := make([]info.ContainerReference, 0, len(containers))
-	for cont := range containers {
+	for _, cont := range sortedKeys(containers) {
 		ret = append(ret, info.ContainerReference{
 			Name: cont,
 		})
@@ -385,22 +2029,142 @@ func (self *rawContainerHandler) ListContainers(listType container.ListType) ([]
 	return ret, nil
 }
 
+// Threads are listed from the tasks file of the cgroups, which has the id of
+// every thread in the cgroup. It is named cgroup.threads on the unified
+// hierarchy.
 func (self *rawContainerHandler) ListThreads(listType container.ListType) ([]int, error) {
-	// TODO(vmarmol): Implement
-	return nil, nil
+	return self.listIds("tasks", listType)
 }
 
+// Processes are listed from the cgroup.procs file of the cgroups, which has
+// the id of the thread group leader of every process in the cgroup. A
+// multithreaded process appears once there but once per thread in tasks.
+// Threaded cgroups of the unified hierarchy have no processes of their own,
+// the processes of their threads are in their domain cgroup.
 func (self *rawContainerHandler) ListProcesses(listType container.ListType) ([]int, error) {
-	return cgroup_fs.GetPids(self.cgroup)
+	pids, err := self.listIds("cgroup.procs", listType)
+	if err != nil {
+		return nil, err
+	}
+	return libcontainer.FilterProcesses(pids, self.options.Stats), nil
+}
+
+// Lists the ids in the specified file (cgroup.procs or tasks) of the cgroups
+// of this container, and of its subcontainers if listing recursively. An id is
+// in the file of one cgroup per hierarchy so the result is deduplicated and
+// sorted.
+func (self *rawContainerHandler) listIds(file string, listType container.ListType) ([]int, error) {
+	idSet := make(map[int]struct{})
+	for _, cgroupPath := range self.getCgroupPaths() {
+		// Ignore if this hierarchy does not exist.
+		if !utils.FileExists(cgroupPath) {
+			continue
+		}
+		dirs := map[string]struct{}{
+			"/": {},
+		}
+		if listType == container.ListRecursive {
+			err := listDirectories(cgroupPath, "/", true, dirs)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for dir := range dirs {
+			dirpath := path.Join(cgroupPath, dir)
+			idsFile := file
+			switch {
+			case file == "tasks" && !utils.FileExists(path.Join(dirpath, file)):
+				idsFile = "cgroup.threads"
+			case file == "cgroup.procs" && self.reader.readString(dirpath, "cgroup.type") == "threaded":
+				continue
+			}
+			ids, err := self.reader.readIds(path.Join(dirpath, idsFile))
+			if err != nil {
+				// The subcontainer may have been removed since it was listed.
+				if os.IsNotExist(err) {
+					continue
+				}
+				return nil, err
+			}
+			for _, id := range ids {
+				idSet[id] = struct{}{}
+			}
+		}
+	}
+
+	ret := make([]int, 0, len(idSet))
+	for id := range idSet {
+		ret = append(ret, id)
+	}
+	sort.Ints(ret)
+	return ret, nil
+}
+
+// Reads a file with one id per line.
+func (self *cgroupReader) readIds(file string) ([]int, error) {
+	out, err := self.readCgroupFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, line := range strings.Split(string(out), "\n") {
+		if line == "" {
+			continue
+		}
+		id, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse id %q in %q: %v", line, file, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Cgroup files of the limits reported in the spec, watched for changes with
+// --watch_spec_changes.
+var specFiles = []string{
+	"cpu.shares",
+	"cpu.cfs_quota_us",
+	"cpu.cfs_period_us",
+	"cpu.max",
+	"cpuset.cpus",
+	"memory.limit_in_bytes",
+	"memory.memsw.limit_in_bytes",
+	"memory.max",
+	"memory.high",
+	"memory.low",
 }
 
 func (self *rawContainerHandler) watchDirectory(dir string, containerName string) error {
-	err := self.watcher.AddWatch(dir, inotify.IN_CREATE|inotify.IN_DELETE|inotify.IN_MOVE)
+	flags := inotify.IN_CREATE | inotify.IN_DELETE | inotify.IN_MOVE
+	if containerName == self.name {
+		// The parent directory is not watched, so the deletion of the
+		// container itself is only seen on its own directory.
+		flags |= inotify.IN_DELETE_SELF
+	}
+	err := self.watcher.AddWatch(dir, flags)
 	if err != nil {
 		return err
 	}
+	if self.options.WatchSpecChanges {
+		// The watches of the files go away with the directory. Only writes
+		// are watched: removing the cgroup changes the link count of its
+		// files (IN_ATTRIB) right before its deletion.
+		for _, file := range specFiles {
+			specFile := path.Join(dir, file)
+			if !utils.FileExists(specFile) {
+				continue
+			}
+			err = self.watcher.AddWatch(specFile, inotify.IN_MODIFY)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	self.watchesLock.Lock()
 	self.watches[containerName] = struct{}{}
 	self.cgroupWatches[dir] = struct{}{}
+	self.watchesLock.Unlock()
 
 	// TODO(vmarmol): We should re-do this once we're done to ensure directories were not added in the meantime.
 	// Watch subdirectories as well.
@@ -420,13 +2184,27 @@ func (self *rawContainerHandler) watchDirectory(dir string, containerName string
 }
 
 func (self *rawContainerHandler) processEvent(event *inotify.Event, events chan container.SubcontainerEvent) error {
-	// Convert the inotify event type to a container create or delete.
+	// Convert the inotify event type to a container create, delete or spec
+	// change.
 	var eventType container.SubcontainerEventType
+	eventPath := event.Name
 	switch {
+	case (event.Mask & inotify.IN_MODIFY) > 0:
+		// Only spec files are watched for these, the container is their
+		// directory.
+		eventType = container.SubcontainerSpecChanged
+		eventPath = path.Dir(event.Name)
+		// A container being removed has no spec to report.
+		if !utils.FileExists(eventPath) {
+			return nil
+		}
 	case (event.Mask & inotify.IN_CREATE) > 0:
 		eventType = container.SubcontainerAdd
 	case (event.Mask & inotify.IN_DELETE) > 0:
 		eventType = container.SubcontainerDelete
+	case (event.Mask & inotify.IN_DELETE_SELF) > 0:
+		// The directory of the container itself was deleted.
+		eventType = container.SubcontainerDelete
 	case (event.Mask & inotify.IN_MOVED_FROM) > 0:
 		eventType = container.SubcontainerDelete
 	case (event.Mask & inotify.IN_MOVED_TO) > 0:
@@ -438,10 +2216,18 @@ func (self *rawContainerHandler) processEvent(event *inotify.Event, events chan
 
 	// Derive the container name from the path name.
 	var containerName string
-	for _, mount := range self.cgroupSubsystems.Mounts {
+	self.cgroupPathsLock.RLock()
+	mounts := self.cgroupSubsystems.Mounts
+	self.cgroupPathsLock.RUnlock()
+	for _, mount := range mounts {
 		mountLocation := path.Clean(mount.Mountpoint) + "/"
-		if strings.HasPrefix(event.Name, mountLocation) {
-			containerName = event.Name[len(mountLocation)-1:]
+		if eventPath+"/" == mountLocation {
+			// The spec of the root container changed.
+			containerName = "/"
+			break
+		}
+		if strings.HasPrefix(eventPath, mountLocation) {
+			containerName = eventPath[len(mountLocation)-1:]
 			break
 		}
 	}
@@ -452,7 +2238,9 @@ func (self *rawContainerHandler) processEvent(event *inotify.Event, events chan
 	// Maintain the watch for the new or deleted container.
 	switch {
 	case eventType == container.SubcontainerAdd:
+		self.watchesLock.Lock()
 		_, alreadyWatched := self.watches[containerName]
+		self.watchesLock.Unlock()
 
 		// New container was created, watch it.
 		err := self.watchDirectory(event.Name, containerName)
@@ -465,11 +2253,19 @@ func (self *rawContainerHandler) processEvent(event *inotify.Event, events chan
 			return nil
 		}
 	case eventType == container.SubcontainerDelete:
+		self.watchesLock.Lock()
+		defer self.watchesLock.Unlock()
+
 		// Container was deleted, stop watching for it. Only delete the event if we registered it.
+		// The kernel already removed the watch of a directory deleting itself,
+		// and usually that of a removed subdirectory too, in which case
+		// removing it fails.
 		if _, ok := self.cgroupWatches[event.Name]; ok {
-			err := self.watcher.RemoveWatch(event.Name)
-			if err != nil {
-				return err
+			if (event.Mask & inotify.IN_DELETE_SELF) == 0 {
+				err := self.watcher.RemoveWatch(event.Name)
+				if err != nil {
+					glog.V(4).Infof("Failed to remove the watch of deleted container %q: %v", containerName, err)
+				}
 			}
 			delete(self.cgroupWatches, event.Name)
 		}
@@ -479,6 +2275,8 @@ func (self *rawContainerHandler) processEvent(event *inotify.Event, events chan
 			return nil
 		}
 		delete(self.watches, containerName)
+	case eventType == container.SubcontainerSpecChanged:
+		// Nothing to maintain, the watches stay.
 	default:
 		return fmt.Errorf("unknown event type %v", eventType)
 	}
@@ -495,7 +2293,7 @@ func (self *rawContainerHandler) processEvent(event *inotify.Event, events chan
 func (self *rawContainerHandler) WatchSubcontainers(events chan container.SubcontainerEvent) error {
 	// Lazily initialize the watcher so we don't use it when not asked to.
 	if self.watcher == nil {
-		w, err := inotify.NewWatcher()
+		w, err := newInotifyWatcher()
 		if err != nil {
 			return err
 		}
@@ -503,29 +2301,34 @@ func (self *rawContainerHandler) WatchSubcontainers(events chan container.Subcon
 	}
 
 	// Watch this container (all its cgroups) and all subdirectories.
-	for _, cgroupPath := range self.cgroupPaths {
+	for _, cgroupPath := range self.getCgroupPaths() {
 		err := self.watchDirectory(cgroupPath, self.name)
 		if err != nil {
 			return err
 		}
 	}
 
+	registerWatcher(self)
+
 	// Process the events received from the kernel.
 	go func() {
 		for {
 			select {
-			case event := <-self.watcher.Event:
+			case event := <-self.watcher.Event():
 				err := self.processEvent(event, events)
 				if err != nil {
 					glog.Warningf("Error while processing event (%+v): %v", event, err)
 				}
-			case err := <-self.watcher.Error:
+			case err := <-self.watcher.Error():
 				glog.Warningf("Error while watching %q:", self.name, err)
 			case <-self.stopWatcher:
 				err := self.watcher.Close()
 				if err == nil {
-					self.stopWatcher <- err
+					// Clear the watcher before the rendezvous so it is not
+					// written while the handler is used again.
 					self.watcher = nil
+					unregisterWatcher(self)
+					self.stopWatcher <- err
 					return
 				}
 			}
@@ -535,6 +2338,56 @@ func (self *rawContainerHandler) WatchSubcontainers(events chan container.Subcon
 	return nil
 }
 
+// Asks the kernel to reclaim the specified amount of memory from the container
+// by writing to its memory.reclaim file (unified hierarchy only). Unlike the
+// rest of the handler this modifies the container, so it must be enabled with
+// --allow_memory_reclaim.
+func (self *rawContainerHandler) ReclaimMemory(bytes uint64) error {
+	if !self.options.AllowMemoryReclaim {
+		return fmt.Errorf("memory reclaim is not allowed, enable it with --allow_memory_reclaim")
+	}
+	memoryRoot, ok := self.getCgroupPaths()["memory"]
+	if !ok {
+		return fmt.Errorf("container %q has no memory cgroup", self.name)
+	}
+	// Open without creating the file, it only exists when supported.
+	f, err := os.OpenFile(path.Join(memoryRoot, "memory.reclaim"), os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to reclaim memory of container %q: %v", self.name, err)
+	}
+	defer f.Close()
+	_, err = f.WriteString(strconv.FormatUint(bytes, 10))
+	if err != nil {
+		return fmt.Errorf("failed to reclaim memory of container %q: %v", self.name, err)
+	}
+	return nil
+}
+
+// Returns the names of the containers being watched for new subcontainers,
+// sorted. Meant for diagnostics.
+func (self *rawContainerHandler) WatchedContainers() []string {
+	self.watchesLock.Lock()
+	defer self.watchesLock.Unlock()
+	return sortedKeys(self.watches)
+}
+
+// Returns the cgroup paths being watched for new subcontainers, sorted. Meant
+// for diagnostics.
+func (self *rawContainerHandler) WatchedPaths() []string {
+	self.watchesLock.Lock()
+	defer self.watchesLock.Unlock()
+	return sortedKeys(self.cgroupWatches)
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func (self *rawContainerHandler) StopWatchingSubcontainers() error {
 	if self.watcher == nil {
 		return fmt.Errorf("can't stop watch that has not started for container %q", self.name)
@@ -545,9 +2398,16 @@ func (self *rawContainerHandler) StopWatchingSubcontainers() error {
 	return <-self.stopWatcher
 }
 
+func (self *rawContainerHandler) Cleanup() {
+	// Drop all custom collectors.
+	self.collectorsLock.Lock()
+	defer self.collectorsLock.Unlock()
+	self.collectors = make(map[string]container.Collector)
+}
+
 func (self *rawContainerHandler) Exists() bool {
 	// If any cgroup exists, the container is still alive.
-	for _, cgroupPath := range self.cgroupPaths {
+	for _, cgroupPath := range self.getCgroupPaths() {
 		if utils.FileExists(cgroupPath) {
 			return true
 		}
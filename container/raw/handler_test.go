@@ -0,0 +1,2464 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raw
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"code.google.com/p/go.exp/inotify"
+	dockermount "github.com/docker/docker/pkg/mount"
+	"github.com/docker/libcontainer/cgroups"
+	"github.com/google/cadvisor/container"
+	"github.com/google/cadvisor/container/libcontainer"
+	"github.com/google/cadvisor/fs"
+	"github.com/google/cadvisor/info"
+	"github.com/google/cadvisor/utils/clock"
+	utilsfs "github.com/google/cadvisor/utils/fs"
+	"github.com/google/cadvisor/utils/procfs"
+)
+
+// Create a raw container handler whose cgroups are the specified directories.
+func newTestRawContainerHandler(name string, cgroupPaths map[string]string) *rawContainerHandler {
+	options := &Options{}
+	return &rawContainerHandler{
+		name:          name,
+		cgroupPaths:   cgroupPaths,
+		stopWatcher:   make(chan error),
+		watches:       make(map[string]struct{}),
+		cgroupWatches: make(map[string]struct{}),
+		reader:        &cgroupReader{fs: osFileSystem{}, options: options},
+		collectors:    make(map[string]container.Collector),
+		clock:         clock.RealClock{},
+		configFiles:   make(map[string]configFile),
+		options:       options,
+	}
+}
+
+// Reader of the cgroup files of the real file system.
+func newTestCgroupReader() *cgroupReader {
+	return &cgroupReader{fs: osFileSystem{}, options: &Options{}}
+}
+
+// Create a temporary cgroup directory with the specified files.
+func newTestCgroupDir(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		err = os.MkdirAll(path.Dir(path.Join(dir, name)), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path.Join(dir, name), []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestReadCgroupFile(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"memory.limit_in_bytes": "1048576\n",
+	})
+	defer os.RemoveAll(dir)
+	handler := newTestRawContainerHandler("/test", map[string]string{
+		"memory": dir,
+	})
+	handler.options.AllowCgroupFileReads = true
+
+	out, err := handler.ReadCgroupFile("memory", "memory.limit_in_bytes")
+	if err != nil {
+		t.Fatalf("failed to read cgroup file: %v", err)
+	}
+	if out != "1048576\n" {
+		t.Errorf("read %q from cgroup file, expected %q", out, "1048576\n")
+	}
+
+	_, err = handler.ReadCgroupFile("cpu", "cpu.shares")
+	if err == nil {
+		t.Errorf("reading from a missing subsystem should have failed")
+	}
+}
+
+func TestReadCgroupFileTraversal(t *testing.T) {
+	dir := newTestCgroupDir(t, nil)
+	defer os.RemoveAll(dir)
+	handler := newTestRawContainerHandler("/test", map[string]string{
+		"memory": path.Join(dir, "test"),
+	})
+	handler.options.AllowCgroupFileReads = true
+	err := os.Mkdir(path.Join(dir, "test"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(path.Join(dir, "secret"), []byte("secret"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{"../secret", "/etc/passwd", "..", "a/../../secret"} {
+		out, err := handler.ReadCgroupFile("memory", file)
+		if err == nil {
+			t.Errorf("reading %q should have been rejected, read %q", file, out)
+		}
+	}
+}
+
+func TestReadCgroupFileDisabled(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"cpu.shares": "1024",
+	})
+	defer os.RemoveAll(dir)
+	handler := newTestRawContainerHandler("/test", map[string]string{
+		"cpu": dir,
+	})
+
+	_, err := handler.ReadCgroupFile("cpu", "cpu.shares")
+	if err == nil {
+		t.Errorf("reading a cgroup file should fail when not allowed")
+	}
+}
+
+// A file system whose files block on read until unblock is closed. closed is
+// closed once the file read is closed.
+type blockingFileSystem struct {
+	osFileSystem
+	unblock chan struct{}
+	closed  chan struct{}
+}
+
+func (self *blockingFileSystem) Open(name string) (utilsfs.File, error) {
+	return &blockingFile{self.unblock, self.closed}, nil
+}
+
+type blockingFile struct {
+	unblock chan struct{}
+	closed  chan struct{}
+}
+
+func (self *blockingFile) Read(p []byte) (int, error) {
+	<-self.unblock
+	return 0, io.EOF
+}
+
+func (self *blockingFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (self *blockingFile) Close() error {
+	close(self.closed)
+	return nil
+}
+
+// The real file system, embedded by the fake file systems.
+type osFileSystem struct{}
+
+func (osFileSystem) Open(name string) (utilsfs.File, error) {
+	return os.Open(name)
+}
+
+func (osFileSystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func TestReadFileWithTimeout(t *testing.T) {
+	fs := &blockingFileSystem{unblock: make(chan struct{}), closed: make(chan struct{})}
+	reader := &cgroupReader{fs: fs, options: &Options{}}
+	// The read left in the background is released before the test ends.
+	defer func() {
+		close(fs.unblock)
+		<-fs.closed
+	}()
+
+	start := time.Now()
+	_, err := reader.readFileWithTimeout("/sys/fs/cgroup/memory/memory.usage_in_bytes", 50*time.Millisecond)
+	if err == nil {
+		t.Fatalf("read of a blocked file should have timed out")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("read of a blocked file took %v, expected it to time out after %v", elapsed, 50*time.Millisecond)
+	}
+}
+
+// File system whose opens fail with the specified error a number of times
+// before returning the contents.
+// Fails the first reads with err, or makes them empty if err is nil.
+type flakyFileSystem struct {
+	osFileSystem
+	err      error
+	failures int
+	contents string
+	opens    int
+}
+
+func (self *flakyFileSystem) Open(name string) (utilsfs.File, error) {
+	self.opens++
+	if self.opens <= self.failures {
+		if self.err == nil {
+			return &stringFile{strings.NewReader("")}, nil
+		}
+		return nil, &os.PathError{Op: "open", Path: name, Err: self.err}
+	}
+	return &stringFile{strings.NewReader(self.contents)}, nil
+}
+
+type stringFile struct {
+	*strings.Reader
+}
+
+func (self *stringFile) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("read only file")
+}
+
+func (self *stringFile) Close() error {
+	return nil
+}
+
+func TestReadFileWithRetry(t *testing.T) {
+	// Transient errors are retried.
+	fs := &flakyFileSystem{err: syscall.EINTR, failures: 2, contents: "1024"}
+	reader := &cgroupReader{fs: fs, options: &Options{}}
+	out, err := reader.readFileWithRetry("/sys/fs/cgroup/cpu/cpu.shares", 3, time.Millisecond)
+	if err != nil {
+		t.Fatalf("read with transient errors should have been retried: %v", err)
+	}
+	if string(out) != "1024" || fs.opens != 3 {
+		t.Errorf("read %q in %d attempts, expected %q in 3", out, fs.opens, "1024")
+	}
+
+	// Retries are bounded.
+	fs = &flakyFileSystem{err: syscall.EIO, failures: 5}
+	reader = &cgroupReader{fs: fs, options: &Options{}}
+	_, err = reader.readFileWithRetry("/sys/fs/cgroup/cpu/cpu.shares", 3, time.Millisecond)
+	if err == nil || fs.opens != 3 {
+		t.Errorf("read failing %d times should fail after 3 attempts, made %d (error: %v)", fs.failures, fs.opens, err)
+	}
+
+	// Cgroups that are gone are not retried.
+	fs = &flakyFileSystem{err: syscall.ENOENT, failures: 1}
+	reader = &cgroupReader{fs: fs, options: &Options{}}
+	_, err = reader.readFileWithRetry("/sys/fs/cgroup/cpu/cpu.shares", 3, time.Millisecond)
+	if err == nil || fs.opens != 1 {
+		t.Errorf("read of a removed cgroup should fail without retrying, made %d attempts (error: %v)", fs.opens, err)
+	}
+}
+
+func TestReadFileWithStartupRetry(t *testing.T) {
+	// Invalid and empty reads are retried.
+	for _, fs := range []*flakyFileSystem{
+		{err: syscall.EINVAL, failures: 1, contents: "1024"},
+		{failures: 1, contents: "1024"},
+	} {
+		reader := &cgroupReader{fs: fs, options: &Options{}}
+		out, err := reader.readFileWithStartupRetry("/sys/fs/cgroup/cpu/cpu.shares", 2, time.Millisecond)
+		if err != nil {
+			t.Fatalf("read failing once with %v should have been retried: %v", fs.err, err)
+		}
+		if string(out) != "1024" || fs.opens != 2 {
+			t.Errorf("read %q in %d attempts, expected %q in 2", out, fs.opens, "1024")
+		}
+	}
+
+	// No retries by default.
+	fs := &flakyFileSystem{err: syscall.EINVAL, failures: 1, contents: "1024"}
+	reader := &cgroupReader{fs: fs, options: &Options{}}
+	_, err := reader.readFileWithStartupRetry("/sys/fs/cgroup/cpu/cpu.shares", 0, time.Millisecond)
+	if err == nil || fs.opens != 1 {
+		t.Errorf("read should fail without retrying, made %d attempts (error: %v)", fs.opens, err)
+	}
+}
+
+func TestReadStringThroughFileSystem(t *testing.T) {
+	// The file is only in the file system of the reader, read without a
+	// timeout.
+	fs := &flakyFileSystem{contents: "1024\n"}
+	reader := &cgroupReader{fs: fs, options: &Options{}}
+	if out := reader.readString("/sys/fs/cgroup/cpu/does_not_exist", "cpu.shares"); out != "1024" {
+		t.Errorf("read %q, expected %q from the file system of the reader", out, "1024")
+	}
+
+	// Missing files are empty.
+	fs = &flakyFileSystem{err: syscall.ENOENT, failures: 1}
+	reader = &cgroupReader{fs: fs, options: &Options{}}
+	if out := reader.readString("/sys/fs/cgroup/cpu", "cpu.shares"); out != "" || fs.opens != 1 {
+		t.Errorf("read %q in %d attempts, expected a missing file to be empty after 1", out, fs.opens)
+	}
+}
+
+type fakeCollector struct {
+	metrics map[string]float64
+	err     error
+}
+
+func (self *fakeCollector) Collect() (map[string]float64, error) {
+	return self.metrics, self.err
+}
+
+func TestCollectCustomMetrics(t *testing.T) {
+	handler := newTestRawContainerHandler("/test", nil)
+	err := handler.AddCollector("app", &fakeCollector{
+		metrics: map[string]float64{
+			"requests": 42,
+			"latency":  0.25,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = handler.AddCollector("app", &fakeCollector{}); err == nil {
+		t.Errorf("registering a collector twice should fail")
+	}
+
+	err = handler.AddCollector("broken", &fakeCollector{
+		err: fmt.Errorf("connection refused"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Failing collectors don't prevent collecting the others.
+	stats := &info.ContainerStats{}
+	handler.collectCustomMetrics(stats)
+	if stats.CustomMetrics["requests"] != 42 || stats.CustomMetrics["latency"] != 0.25 {
+		t.Errorf("custom metrics are %v, expected the metrics of the collector", stats.CustomMetrics)
+	}
+
+	// Removed collectors no longer contribute metrics.
+	handler.RemoveCollector("app")
+	handler.RemoveCollector("broken")
+	stats = &info.ContainerStats{}
+	handler.collectCustomMetrics(stats)
+	if len(stats.CustomMetrics) != 0 {
+		t.Errorf("custom metrics are %v, expected none", stats.CustomMetrics)
+	}
+}
+
+func TestCleanupRemovesCollectors(t *testing.T) {
+	handler := newTestRawContainerHandler("/test", nil)
+	err := handler.AddCollector("app", &fakeCollector{
+		metrics: map[string]float64{"requests": 42},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.Cleanup()
+
+	stats := &info.ContainerStats{}
+	handler.collectCustomMetrics(stats)
+	if len(stats.CustomMetrics) != 0 {
+		t.Errorf("custom metrics are %v after cleanup, expected none", stats.CustomMetrics)
+	}
+}
+
+func TestListProcessesRecursive(t *testing.T) {
+	cpuDir := newTestCgroupDir(t, map[string]string{
+		"cgroup.procs":       "1\n",
+		"a/cgroup.procs":     "2\n3\n",
+		"a/b/cgroup.procs":   "4\n",
+		"c/cgroup.procs":     "",
+		"a/b/d/cgroup.procs": "5\n",
+	})
+	defer os.RemoveAll(cpuDir)
+	memoryDir := newTestCgroupDir(t, map[string]string{
+		"cgroup.procs":   "1\n",
+		"a/cgroup.procs": "2\n3\n4\n5\n",
+	})
+	defer os.RemoveAll(memoryDir)
+	handler := newTestRawContainerHandler("/test", map[string]string{
+		"cpu":    cpuDir,
+		"memory": memoryDir,
+	})
+
+	pids, err := handler.ListProcesses(container.ListRecursive)
+	if err != nil {
+		t.Fatalf("failed to list processes: %v", err)
+	}
+	expected := []int{1, 2, 3, 4, 5}
+	if !reflect.DeepEqual(pids, expected) {
+		t.Errorf("listed pids %v, expected %v", pids, expected)
+	}
+}
+
+func TestListProcessesAndThreads(t *testing.T) {
+	// Process 10 has threads 11 and 12, process 20 is single threaded.
+	dir := newTestCgroupDir(t, map[string]string{
+		"cgroup.procs":   "10\n20\n",
+		"tasks":          "10\n11\n12\n20\n",
+		"a/cgroup.procs": "30\n",
+		"a/tasks":        "30\n31\n",
+	})
+	defer os.RemoveAll(dir)
+	handler := newTestRawContainerHandler("/test", map[string]string{
+		"cpu": dir,
+	})
+
+	testCases := []struct {
+		list     func(container.ListType) ([]int, error)
+		listType container.ListType
+		expected []int
+	}{
+		{handler.ListProcesses, container.ListSelf, []int{10, 20}},
+		{handler.ListThreads, container.ListSelf, []int{10, 11, 12, 20}},
+		{handler.ListProcesses, container.ListRecursive, []int{10, 20, 30}},
+		{handler.ListThreads, container.ListRecursive, []int{10, 11, 12, 20, 30, 31}},
+	}
+	for i, tc := range testCases {
+		ids, err := tc.list(tc.listType)
+		if err != nil {
+			t.Fatalf("case %d: failed to list ids: %v", i, err)
+		}
+		if !reflect.DeepEqual(ids, tc.expected) {
+			t.Errorf("case %d: listed %v, expected %v", i, ids, tc.expected)
+		}
+	}
+}
+
+// FsInfo whose calls all fail with the specified error.
+type failingFsInfo struct {
+	err error
+}
+
+func (self *failingFsInfo) GetGlobalFsInfo() ([]fs.Fs, error) {
+	return nil, self.err
+}
+
+func (self *failingFsInfo) GetFsInfoForPath(mountSet map[string]struct{}) ([]fs.Fs, error) {
+	return nil, self.err
+}
+
+func (self *failingFsInfo) GetDirUsage(dir string) (uint64, error) {
+	return 0, self.err
+}
+
+func (self *failingFsInfo) GetDirFsDevice(dir string) (*fs.DeviceInfo, error) {
+	return nil, self.err
+}
+
+func TestGetFsStatsErrors(t *testing.T) {
+	handler := newTestRawContainerHandler("/", map[string]string{})
+
+	// Temporary errors skip the filesystem stats.
+	handler.fsInfo = &failingFsInfo{fs.NewFsError(&os.PathError{Op: "statfs", Path: "/mnt", Err: syscall.ESTALE})}
+	stats := &info.ContainerStats{}
+	err := handler.getFsStats(stats)
+	if err != nil {
+		t.Errorf("temporary filesystem errors should not fail stats collection: %v", err)
+	}
+	if len(stats.Filesystem) != 0 {
+		t.Errorf("expected no filesystem stats, got %+v", stats.Filesystem)
+	}
+
+	// Permanent errors are returned.
+	handler.fsInfo = &failingFsInfo{fs.NewFsError(syscall.EACCES)}
+	err = handler.getFsStats(&info.ContainerStats{})
+	if err == nil {
+		t.Errorf("permanent filesystem errors should fail stats collection")
+	}
+}
+
+// FsInfo counting the calls for the filesystems of the host.
+type countingFsInfo struct {
+	failingFsInfo
+	calls int
+}
+
+func (self *countingFsInfo) GetGlobalFsInfo() ([]fs.Fs, error) {
+	self.calls++
+	return []fs.Fs{
+		{DeviceInfo: fs.DeviceInfo{Device: "/dev/sda1"}, Mountpoint: "/", Capacity: 1024, Free: 512},
+	}, nil
+}
+
+// Reports a fixed usage for every directory and counts the directories walked.
+type dirUsageFsInfo struct {
+	failingFsInfo
+	walked []string
+}
+
+func (self *dirUsageFsInfo) GetDirUsage(dir string) (uint64, error) {
+	self.walked = append(self.walked, dir)
+	return 4096, nil
+}
+
+func TestGetSubpathStats(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"logs/app.log":   "started\n",
+		"cache/data.bin": "data",
+	})
+	defer os.RemoveAll(dir)
+	handler := newTestRawContainerHandler("/test", map[string]string{})
+	handler.options.SubpathUsageTtl = time.Minute
+	fsInfo := &dirUsageFsInfo{}
+	handler.fsInfo = fsInfo
+	fakeClock := clock.NewFakeClock(time.Date(2015, time.June, 1, 12, 0, 0, 0, time.UTC))
+	handler.clock = fakeClock
+	logs, cache, missing := path.Join(dir, "logs"), path.Join(dir, "cache"), path.Join(dir, "missing")
+	handler.subpaths = []string{logs, missing, cache}
+	handler.subpathUsage = make(map[string]subpathUsage)
+
+	// Directories that do not exist are skipped and the usage of the others
+	// is reused within the ttl.
+	expected := []info.SubpathStats{{Path: logs, Usage: 4096}, {Path: cache, Usage: 4096}}
+	for i := 0; i < 2; i++ {
+		stats := &info.ContainerStats{}
+		if err := handler.getFsStats(stats); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(stats.Subpaths, expected) {
+			t.Errorf("expected subpath stats %+v, got %+v", expected, stats.Subpaths)
+		}
+	}
+	if !reflect.DeepEqual(fsInfo.walked, []string{logs, cache}) {
+		t.Errorf("expected %v to be walked once, walked %v", []string{logs, cache}, fsInfo.walked)
+	}
+
+	// The usage is computed again once the ttl elapsed.
+	fakeClock.Step(time.Minute)
+	if err := handler.getFsStats(&info.ContainerStats{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(fsInfo.walked) != 4 {
+		t.Errorf("expected the directories to be walked again, walked %v", fsInfo.walked)
+	}
+}
+
+func TestGetSampledFsStats(t *testing.T) {
+	handler := newTestRawContainerHandler("/", map[string]string{})
+	fsInfo := &countingFsInfo{}
+	handler.fsInfo = fsInfo
+	fakeClock := clock.NewFakeClock(time.Date(2015, time.June, 1, 12, 0, 0, 0, time.UTC))
+	handler.clock = fakeClock
+
+	// Collected every time by default.
+	for i := 0; i < 2; i++ {
+		if err := handler.getSampledFsStats(&info.ContainerStats{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fsInfo.calls != 2 {
+		t.Errorf("filesystem stats collected %d times, expected 2", fsInfo.calls)
+	}
+
+	// Reported from the latest snapshot within the interval.
+	handler.options.FsStatsInterval = time.Hour
+	fsInfo.calls = 0
+	for i := 0; i < 2; i++ {
+		stats := &info.ContainerStats{}
+		if err := handler.getSampledFsStats(stats); err != nil {
+			t.Fatal(err)
+		}
+		if len(stats.Filesystem) != 1 || stats.Filesystem[0].Usage != 512 {
+			t.Errorf("expected the stats of /dev/sda1, got %+v", stats.Filesystem)
+		}
+	}
+	if fsInfo.calls != 1 {
+		t.Errorf("filesystem stats collected %d times within the interval, expected 1", fsInfo.calls)
+	}
+
+	// Collected again once the interval elapsed.
+	fakeClock.Step(2 * time.Hour)
+	if err := handler.getSampledFsStats(&info.ContainerStats{}); err != nil {
+		t.Fatal(err)
+	}
+	if fsInfo.calls != 2 {
+		t.Errorf("filesystem stats collected %d times after the interval, expected 2", fsInfo.calls)
+	}
+}
+
+func TestReadUclamp(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"cpu.uclamp.min": "20.00\n",
+		"cpu.uclamp.max": "max\n",
+	})
+	defer os.RemoveAll(dir)
+
+	uclamp := newTestCgroupReader().readUclamp(dir)
+	expected := &info.UclampSpec{
+		Min: 20,
+		Max: 100,
+	}
+	if uclamp == nil || *uclamp != *expected {
+		t.Errorf("read uclamp %+v, expected %+v", uclamp, expected)
+	}
+}
+
+func TestReadUclampUnsupported(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"cpu.shares": "1024\n",
+	})
+	defer os.RemoveAll(dir)
+
+	if uclamp := newTestCgroupReader().readUclamp(dir); uclamp != nil {
+		t.Errorf("expected no uclamp without kernel support, got %+v", uclamp)
+	}
+}
+
+func TestGetSpecCpusetExclusive(t *testing.T) {
+	exclusiveDir := newTestCgroupDir(t, map[string]string{
+		"cpuset.cpus":          "0-1\n",
+		"cpuset.cpu_exclusive": "1\n",
+		"cpuset.mem_exclusive": "0\n",
+	})
+	defer os.RemoveAll(exclusiveDir)
+	sharedDir := newTestCgroupDir(t, map[string]string{
+		"cpuset.cpus": "0-1\n",
+	})
+	defer os.RemoveAll(sharedDir)
+
+	for _, test := range []struct {
+		dir                        string
+		cpuExclusive, memExclusive bool
+	}{
+		{exclusiveDir, true, false},
+		{sharedDir, false, false},
+	} {
+		handler := newTestRawContainerHandler("/", map[string]string{"cpuset": test.dir})
+		handler.machineInfoFactory = fakeMachineInfoFactory{}
+		spec, err := handler.GetSpec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if spec.Cpu.CpuExclusive != test.cpuExclusive || spec.Cpu.MemExclusive != test.memExclusive {
+			t.Errorf("expected cpu_exclusive %v and mem_exclusive %v for %q, got %+v", test.cpuExclusive, test.memExclusive, test.dir, spec.Cpu)
+		}
+	}
+}
+
+func TestGetSpecPerfEvent(t *testing.T) {
+	dir := newTestCgroupDir(t, nil)
+	defer os.RemoveAll(dir)
+	defer func(find func(string) (string, error)) { findCgroupMountpoint = find }(findCgroupMountpoint)
+
+	for _, test := range []struct {
+		mountpoint   string
+		name         string
+		hasPerfEvent bool
+	}{
+		{path.Dir(dir), "/" + path.Base(dir), true},
+		{path.Dir(dir), "/missing", false},
+		// The perf_event hierarchy is not mounted.
+		{"", "/" + path.Base(dir), false},
+	} {
+		findCgroupMountpoint = func(subsystem string) (string, error) {
+			if subsystem != "perf_event" || test.mountpoint == "" {
+				return "", fmt.Errorf("%s not mounted", subsystem)
+			}
+			return test.mountpoint, nil
+		}
+		handler := newTestRawContainerHandler(test.name, map[string]string{})
+		handler.perfEventPath = perfEventCgroupPath(test.name)
+		handler.machineInfoFactory = fakeMachineInfoFactory{}
+		spec, err := handler.GetSpec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if spec.HasPerfEvent != test.hasPerfEvent {
+			t.Errorf("expected has_perf_event %v for container %q with perf_event mounted at %q, got %v", test.hasPerfEvent, test.name, test.mountpoint, spec.HasPerfEvent)
+		}
+	}
+}
+
+func TestGetSpecEffectiveCpuMask(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"cpuset.cpus": "0-7\n",
+	})
+	defer os.RemoveAll(dir)
+	handler := newTestRawContainerHandler("/test", map[string]string{"cpuset": dir})
+
+	for _, test := range []struct {
+		onlineCpus string
+		expected   string
+	}{
+		// Cpus 4-7 are offline.
+		{"0-3", "0-3"},
+		{"0-3,6,8-15", "0-3,6"},
+		// Unknown.
+		{"", "0-7"},
+		// None online.
+		{"8-15", ""},
+	} {
+		handler.machineInfoFactory = fakeMachineInfoFactory{onlineCpus: test.onlineCpus}
+		spec, err := handler.GetSpec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if spec.Cpu.Mask != "0-7" || spec.Cpu.EffectiveMask != test.expected {
+			t.Errorf("expected the effective mask of 0-7 with cpus %q online to be %q, got %+v", test.onlineCpus, test.expected, spec.Cpu)
+		}
+	}
+}
+
+func TestReadDevicesList(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"devices.list": "c 1:3 rwm\nc 136:* rw\nb *:* m\ninvalid\n",
+	})
+	defer os.RemoveAll(dir)
+
+	expected := []info.DeviceRule{
+		{Type: "c", Major: 1, Minor: 3, Access: "rwm"},
+		{Type: "c", Major: 136, Minor: info.DeviceWildcard, Access: "rw"},
+		{Type: "b", Major: info.DeviceWildcard, Minor: info.DeviceWildcard, Access: "m"},
+	}
+	if rules := newTestCgroupReader().readDevicesList(dir); !reflect.DeepEqual(rules, expected) {
+		t.Errorf("read device rules %+v, expected %+v", rules, expected)
+	}
+
+	unconfiguredDir := newTestCgroupDir(t, nil)
+	defer os.RemoveAll(unconfiguredDir)
+	if rules := newTestCgroupReader().readDevicesList(unconfiguredDir); rules != nil {
+		t.Errorf("expected no device rules without devices.list, got %+v", rules)
+	}
+}
+
+func TestGetSpecDevices(t *testing.T) {
+	mountpoint := newTestCgroupDir(t, nil)
+	defer os.RemoveAll(mountpoint)
+	if err := os.Mkdir(path.Join(mountpoint, "test"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(mountpoint, "test", "devices.list"), []byte("c 1:3 rwm\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cgroupSubsystems := &libcontainer.CgroupSubsystems{
+		MountPoints: map[string]string{"devices": mountpoint},
+	}
+	handler := newTestRawContainerHandler("/test", CgroupPathsForName("/test", cgroupSubsystems))
+	handler.machineInfoFactory = fakeMachineInfoFactory{}
+	spec, err := handler.GetSpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []info.DeviceRule{{Type: "c", Major: 1, Minor: 3, Access: "rwm"}}
+	if !reflect.DeepEqual(spec.Devices, expected) {
+		t.Errorf("expected device rules %+v, got %+v", expected, spec.Devices)
+	}
+}
+
+func TestReadBlkioThrottleSpec(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"blkio.throttle.read_bps_device":   "8:0 1048576\n",
+		"blkio.throttle.write_bps_device":  "",
+		"blkio.throttle.read_iops_device":  "",
+		"blkio.throttle.write_iops_device": "",
+	})
+	defer os.RemoveAll(dir)
+	diskMap := map[string]info.DiskInfo{
+		"8:0":  {Name: "sda", Major: 8, Minor: 0},
+		"8:16": {Name: "sdb", Major: 8, Minor: 16},
+	}
+
+	spec := newTestCgroupReader().readBlkioThrottleSpec(dir, diskMap)
+	expected := info.DiskIoSpec{
+		ReadBpsDevice: map[string]uint64{
+			"sda": 1048576,
+		},
+	}
+	if !reflect.DeepEqual(spec, expected) {
+		t.Errorf("read throttle limits %+v, expected %+v", spec, expected)
+	}
+}
+
+func TestListProcessesAndThreadsThreaded(t *testing.T) {
+	// Process 10 has thread 11 in its domain cgroup and thread 12 in the
+	// threaded subcontainer, whose cgroup.procs can't be read.
+	dir := newTestCgroupDir(t, map[string]string{
+		"cgroup.type":      "domain threaded\n",
+		"cgroup.procs":     "10\n",
+		"cgroup.threads":   "10\n11\n",
+		"t/cgroup.type":    "threaded\n",
+		"t/cgroup.procs":   "operation not supported",
+		"t/cgroup.threads": "12\n",
+	})
+	defer os.RemoveAll(dir)
+	handler := newTestRawContainerHandler("/test", map[string]string{
+		"cpu": dir,
+	})
+
+	pids, err := handler.ListProcesses(container.ListRecursive)
+	if err != nil {
+		t.Fatalf("failed to list processes: %v", err)
+	}
+	if !reflect.DeepEqual(pids, []int{10}) {
+		t.Errorf("listed processes %v, expected %v", pids, []int{10})
+	}
+	tids, err := handler.ListThreads(container.ListRecursive)
+	if err != nil {
+		t.Fatalf("failed to list threads: %v", err)
+	}
+	if !reflect.DeepEqual(tids, []int{10, 11, 12}) {
+		t.Errorf("listed threads %v, expected %v", tids, []int{10, 11, 12})
+	}
+}
+
+func TestReadMemorySoftLimits(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"memory.high": "2147483648\n",
+		"memory.low":  "max\n",
+	})
+	defer os.RemoveAll(dir)
+
+	if high := newTestCgroupReader().readMemoryLimit(dir, "memory.high"); high != 2147483648 {
+		t.Errorf("read memory.high %d, expected %d", high, 2147483648)
+	}
+	if low := newTestCgroupReader().readMemoryLimit(dir, "memory.low"); low != math.MaxUint64 {
+		t.Errorf("read memory.low %d, expected %d", low, uint64(math.MaxUint64))
+	}
+	if newTestCgroupReader().readMemoryLimit(dir, "memory.min") != 0 {
+		t.Errorf("expected a missing limit to be 0")
+	}
+
+	handler := newTestRawContainerHandler("/test", map[string]string{"memory": dir})
+	if handler.isOverMemoryHigh(dir, 1<<30) {
+		t.Errorf("usage of 1GiB should be under the 2GiB high watermark")
+	}
+	if !handler.isOverMemoryHigh(dir, 3<<30) {
+		t.Errorf("usage of 3GiB should be over the 2GiB high watermark")
+	}
+}
+
+func TestReadCfsBandwidth(t *testing.T) {
+	for _, test := range []struct {
+		files                map[string]string
+		quota, period, burst uint64
+	}{
+		{
+			files: map[string]string{
+				"cpu.cfs_quota_us":  "50000\n",
+				"cpu.cfs_period_us": "100000\n",
+				"cpu.cfs_burst_us":  "20000\n",
+			},
+			quota:  50000,
+			period: 100000,
+			burst:  20000,
+		},
+		{
+			// Kernels without CFS burst support.
+			files: map[string]string{
+				"cpu.cfs_quota_us":  "-1\n",
+				"cpu.cfs_period_us": "100000\n",
+			},
+			quota:  math.MaxUint64,
+			period: 100000,
+		},
+		{
+			files: map[string]string{
+				"cpu.max":       "150000 100000\n",
+				"cpu.max.burst": "50000\n",
+			},
+			quota:  150000,
+			period: 100000,
+			burst:  50000,
+		},
+		{
+			files: map[string]string{
+				"cpu.max":       "max 100000\n",
+				"cpu.max.burst": "0\n",
+			},
+			quota:  math.MaxUint64,
+			period: 100000,
+		},
+	} {
+		dir := newTestCgroupDir(t, test.files)
+		quota, period, burst := newTestCgroupReader().readCfsBandwidth(dir)
+		os.RemoveAll(dir)
+		if quota != test.quota || period != test.period || burst != test.burst {
+			t.Errorf("read quota %d, period %d and burst %d from %v, expected %d, %d and %d", quota, period, burst, test.files, test.quota, test.period, test.burst)
+		}
+	}
+}
+
+func TestWatchedContainers(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"sub/cpu.shares": "1024\n",
+	})
+	defer os.RemoveAll(dir)
+	handler := newTestRawContainerHandler("/test", map[string]string{"cpu": dir})
+
+	if watched := handler.WatchedContainers(); len(watched) != 0 {
+		t.Errorf("expected no watches before watching, got %v", watched)
+	}
+	err := handler.WatchSubcontainers(make(chan container.SubcontainerEvent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handler.StopWatchingSubcontainers()
+
+	expectedContainers := []string{"/test", "/test/sub"}
+	if watched := handler.WatchedContainers(); !reflect.DeepEqual(watched, expectedContainers) {
+		t.Errorf("watched containers %v, expected %v", watched, expectedContainers)
+	}
+	expectedPaths := []string{dir, path.Join(dir, "sub")}
+	if watched := handler.WatchedPaths(); !reflect.DeepEqual(watched, expectedPaths) {
+		t.Errorf("watched paths %v, expected %v", watched, expectedPaths)
+	}
+}
+
+func TestReclaimMemory(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"memory.reclaim": "",
+	})
+	defer os.RemoveAll(dir)
+	handler := newTestRawContainerHandler("/test", map[string]string{"memory": dir})
+
+	// Not allowed by default.
+	if err := handler.ReclaimMemory(1 << 20); err == nil {
+		t.Errorf("memory reclaim should not be allowed by default")
+	}
+
+	handler.options.AllowMemoryReclaim = true
+	if err := handler.ReclaimMemory(1 << 20); err != nil {
+		t.Fatalf("failed to reclaim memory: %v", err)
+	}
+	out, err := ioutil.ReadFile(path.Join(dir, "memory.reclaim"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "1048576" {
+		t.Errorf("wrote %q to memory.reclaim, expected %q", out, "1048576")
+	}
+
+	// Unsupported without the file.
+	os.Remove(path.Join(dir, "memory.reclaim"))
+	if err := handler.ReclaimMemory(1 << 20); err == nil {
+		t.Errorf("memory reclaim should fail without memory.reclaim")
+	}
+	if _, err := os.Stat(path.Join(dir, "memory.reclaim")); !os.IsNotExist(err) {
+		t.Errorf("memory.reclaim should not be created when missing")
+	}
+}
+
+// Run with -race to detect unsynchronized access to the watches.
+func TestWatchSubcontainersConcurrentEvents(t *testing.T) {
+	dir := newTestCgroupDir(t, nil)
+	defer os.RemoveAll(dir)
+	handler := newTestRawContainerHandler("/", map[string]string{"cpu": dir})
+	handler.cgroupSubsystems = &libcontainer.CgroupSubsystems{
+		Mounts: []cgroups.Mount{{Mountpoint: dir, Subsystems: []string{"cpu"}}},
+	}
+
+	const numContainers = 20
+	events := make(chan container.SubcontainerEvent)
+	err := handler.WatchSubcontainers(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create containers while the watches are read and the events processed.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < numContainers; i++ {
+			if err := os.Mkdir(path.Join(dir, fmt.Sprintf("container%d", i)), 0755); err != nil {
+				t.Error(err)
+				return
+			}
+			handler.WatchedContainers()
+		}
+	}()
+	added := 0
+	timeout := time.After(10 * time.Second)
+	for added < numContainers {
+		select {
+		case event := <-events:
+			if event.EventType == container.SubcontainerAdd {
+				added++
+			}
+		case <-timeout:
+			t.Fatalf("received %d of %d container creations", added, numContainers)
+		}
+		handler.WatchedPaths()
+	}
+	<-done
+
+	if err := handler.StopWatchingSubcontainers(); err != nil {
+		t.Fatal(err)
+	}
+	if watched := handler.WatchedContainers(); len(watched) != numContainers+1 {
+		t.Errorf("watched %d containers, expected %d", len(watched), numContainers+1)
+	}
+}
+
+func TestGetStatsFilesystemActivity(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"io.stat": "8:0 rbytes=1048576 wbytes=4096 rios=256 wios=1 dbytes=0 dios=0\n8:16 rbytes=512 wbytes=0 rios=1 wios=0 dbytes=0 dios=0\n",
+	})
+	defer os.RemoveAll(dir)
+	handler := newTestRawContainerHandler("/test", map[string]string{"blkio": dir})
+
+	stats, err := handler.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Filesystem) != 0 {
+		t.Fatalf("expected no filesystem stats, got %+v", stats.Filesystem)
+	}
+	expected := &info.IoActivityStats{ReadBytes: 1048576 + 512, WriteBytes: 4096}
+	if !reflect.DeepEqual(stats.FilesystemActivity, expected) {
+		t.Errorf("expected filesystem activity %+v, got %+v", expected, stats.FilesystemActivity)
+	}
+
+	// The bytes serviced of v1 hierarchies are used when reported.
+	activity := newTestCgroupReader().readIoActivity(dir, []info.PerDiskStats{
+		{Major: 8, Minor: 0, Stats: map[string]uint64{"Read": 100, "Write": 50, "Total": 150}},
+		{Major: 8, Minor: 16, Stats: map[string]uint64{"Read": 10}},
+	})
+	if expected := (info.IoActivityStats{ReadBytes: 110, WriteBytes: 50}); activity == nil || *activity != expected {
+		t.Errorf("expected filesystem activity %+v, got %+v", expected, activity)
+	}
+}
+
+func TestGetStatsCounterReset(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"io.stat": "8:0 rbytes=1000 wbytes=100 rios=1 wios=1 dbytes=0 dios=0\n",
+	})
+	defer os.RemoveAll(dir)
+	writeIoStat := func(rbytes, wbytes int) {
+		content := fmt.Sprintf("8:0 rbytes=%d wbytes=%d rios=1 wios=1 dbytes=0 dios=0\n", rbytes, wbytes)
+		if err := ioutil.WriteFile(path.Join(dir, "io.stat"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkStats := func(handler *rawContainerHandler, expectedActivity info.IoActivityStats, expectedReset bool) {
+		stats, err := handler.GetStats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.FilesystemActivity == nil || *stats.FilesystemActivity != expectedActivity {
+			t.Errorf("expected filesystem activity %+v, got %+v", expectedActivity, stats.FilesystemActivity)
+		}
+		if stats.CounterReset != expectedReset {
+			t.Errorf("expected counter reset %v, got %v", expectedReset, stats.CounterReset)
+		}
+	}
+
+	// Cumulative stats are reported as is, with the reset flagged.
+	handler := newTestRawContainerHandler("/test", map[string]string{"blkio": dir})
+	checkStats(handler, info.IoActivityStats{ReadBytes: 1000, WriteBytes: 100}, false)
+	writeIoStat(1500, 200)
+	checkStats(handler, info.IoActivityStats{ReadBytes: 1500, WriteBytes: 200}, false)
+	writeIoStat(10, 200)
+	checkStats(handler, info.IoActivityStats{ReadBytes: 10, WriteBytes: 200}, true)
+	writeIoStat(20, 300)
+	checkStats(handler, info.IoActivityStats{ReadBytes: 20, WriteBytes: 300}, false)
+
+	// Stats since creation restart from zero after the reset.
+	writeIoStat(1000, 100)
+	handler = newTestRawContainerHandler("/test", map[string]string{"blkio": dir})
+	handler.options.StatsSinceCreation = true
+	checkStats(handler, info.IoActivityStats{}, false)
+	writeIoStat(1500, 200)
+	checkStats(handler, info.IoActivityStats{ReadBytes: 500, WriteBytes: 100}, false)
+	writeIoStat(10, 200)
+	checkStats(handler, info.IoActivityStats{}, true)
+	writeIoStat(20, 300)
+	checkStats(handler, info.IoActivityStats{ReadBytes: 10, WriteBytes: 100}, false)
+}
+
+func TestReadIoControllers(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"io.latency":  "8:0 target=75000\n8:16 target=max\n",
+		"io.max":      "8:0 rbps=1048576 wbps=max riops=max wiops=120\n8:16 rbps=max wbps=2097152 riops=max wiops=max\n",
+		"io.cost.qos": "8:0 enable=1 ctrl=auto rpct=95.00 rlat=10000 wpct=90.00 wlat=20000 min=50.00 max=150.00\n",
+		"io.stat":     "8:0 rbytes=1048576 wbytes=4096 rios=256 wios=1 dbytes=0 dios=0 cost.vrate=100.00 cost.usage=5120 cost.wait=300 cost.indebt=0\n8:16 rbytes=512 wbytes=0 rios=1 wios=0 dbytes=0 dios=0\n",
+	})
+	defer os.RemoveAll(dir)
+	diskMap := map[string]info.DiskInfo{
+		"8:0":  {Name: "sda", Major: 8, Minor: 0},
+		"8:16": {Name: "sdb", Major: 8, Minor: 16},
+	}
+
+	spec := newTestCgroupReader().readBlkioThrottleSpec(dir, diskMap)
+	expectedTargets := map[string]uint64{"sda": 75000}
+	if !reflect.DeepEqual(spec.LatencyTarget, expectedTargets) {
+		t.Errorf("read latency targets %+v, expected %+v", spec.LatencyTarget, expectedTargets)
+	}
+	if !reflect.DeepEqual(spec.ReadBpsDevice, map[string]uint64{"sda": 1048576}) ||
+		!reflect.DeepEqual(spec.WriteBpsDevice, map[string]uint64{"sdb": 2097152}) ||
+		spec.ReadIopsDevice != nil ||
+		!reflect.DeepEqual(spec.WriteIopsDevice, map[string]uint64{"sda": 120}) {
+		t.Errorf("read unexpected io.max limits %+v", spec)
+	}
+	expectedQos := map[string]info.IoCostQos{
+		"sda": {
+			Enabled:                true,
+			Ctrl:                   "auto",
+			ReadLatencyPercentile:  95,
+			ReadLatency:            10000,
+			WriteLatencyPercentile: 90,
+			WriteLatency:           20000,
+			MinVrate:               50,
+			MaxVrate:               150,
+		},
+	}
+	if !reflect.DeepEqual(spec.CostQos, expectedQos) {
+		t.Errorf("read io.cost qos %+v, expected %+v", spec.CostQos, expectedQos)
+	}
+
+	expectedCost := []info.PerDiskStats{
+		{Major: 8, Minor: 0, Stats: map[string]uint64{"usage": 5120, "wait": 300, "indebt": 0}},
+	}
+	if cost := newTestCgroupReader().readIoCostStats(dir); !reflect.DeepEqual(cost, expectedCost) {
+		t.Errorf("read io.cost stats %+v, expected %+v", cost, expectedCost)
+	}
+}
+
+func TestReadIoControllersUnconfigured(t *testing.T) {
+	dir := newTestCgroupDir(t, nil)
+	defer os.RemoveAll(dir)
+
+	spec := newTestCgroupReader().readBlkioThrottleSpec(dir, nil)
+	if !reflect.DeepEqual(spec, info.DiskIoSpec{}) {
+		t.Errorf("expected no io.max, io.latency or io.cost settings, got %+v", spec)
+	}
+	if cost := newTestCgroupReader().readIoCostStats(dir); cost != nil {
+		t.Errorf("expected no io.cost stats, got %+v", cost)
+	}
+}
+
+func TestReadPressure(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"io.pressure": "some avg10=12.50 avg60=4.20 avg300=1.05 total=123456\nfull avg10=10.00 avg60=3.00 avg300=0.75 total=98765\n",
+	})
+	defer os.RemoveAll(dir)
+
+	expected := &info.PressureStats{
+		Some: info.PressureData{Avg10: 12.5, Avg60: 4.2, Avg300: 1.05, Total: 123456},
+		Full: info.PressureData{Avg10: 10, Avg60: 3, Avg300: 0.75, Total: 98765},
+	}
+	if pressure := newTestCgroupReader().readPressure(dir, "io.pressure"); !reflect.DeepEqual(pressure, expected) {
+		t.Errorf("read io pressure %+v, expected %+v", pressure, expected)
+	}
+	if pressure := newTestCgroupReader().readPressure(dir, "memory.pressure"); pressure != nil {
+		t.Errorf("expected no pressure without the file, got %+v", pressure)
+	}
+	if _, err := parsePressure("some avg10=abc total=0"); err == nil {
+		t.Errorf("expected an error parsing a malformed average")
+	}
+}
+
+func TestReadTcpMemoryStats(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"memory.kmem.tcp.usage_in_bytes": "950272\n",
+		"memory.kmem.tcp.limit_in_bytes": "1048576\n",
+	})
+	defer os.RemoveAll(dir)
+
+	expected := &info.TcpMemoryStats{Usage: 950272, Limit: 1048576, NearLimit: true}
+	if stats := newTestCgroupReader().readTcpMemoryStats(dir); !reflect.DeepEqual(stats, expected) {
+		t.Errorf("read tcp memory %+v, expected %+v", stats, expected)
+	}
+
+	unlimitedDir := newTestCgroupDir(t, map[string]string{
+		"memory.kmem.tcp.usage_in_bytes": "4096\n",
+		"memory.kmem.tcp.limit_in_bytes": "9223372036854771712\n",
+	})
+	defer os.RemoveAll(unlimitedDir)
+	if stats := newTestCgroupReader().readTcpMemoryStats(unlimitedDir); stats == nil || stats.NearLimit {
+		t.Errorf("expected the tcp memory to be far from the limit, got %+v", stats)
+	}
+
+	unaccountedDir := newTestCgroupDir(t, map[string]string{
+		"memory.usage_in_bytes": "4096\n",
+	})
+	defer os.RemoveAll(unaccountedDir)
+	if stats := newTestCgroupReader().readTcpMemoryStats(unaccountedDir); stats != nil {
+		t.Errorf("expected no tcp memory without tcp accounting, got %+v", stats)
+	}
+}
+
+func TestGetStatsMissingSubsystem(t *testing.T) {
+	cpuDir := newTestCgroupDir(t, map[string]string{
+		"cpu.stat": "nr_periods 0\nnr_throttled 0\nthrottled_time 0\n",
+	})
+	defer os.RemoveAll(cpuDir)
+	devicesDir := newTestCgroupDir(t, nil)
+	handler := newTestRawContainerHandler("/test", map[string]string{
+		"cpu":     cpuDir,
+		"devices": devicesDir,
+	})
+	handler.subsystems = existingSubsystems(handler.cgroupPaths)
+	if !reflect.DeepEqual(handler.subsystems, []string{"cpu", "devices"}) {
+		t.Fatalf("recorded subsystems %v, expected [cpu devices]", handler.subsystems)
+	}
+	os.RemoveAll(devicesDir)
+
+	// The stats of the missing cgroup are empty by default.
+	if _, err := handler.GetStats(); err != nil {
+		t.Errorf("stats of a container with a missing cgroup should be collected: %v", err)
+	}
+
+	handler.options.StrictSubsystems = true
+	if _, err := handler.GetStats(); err == nil {
+		t.Errorf("stats of a container with a missing cgroup should fail with strict subsystems")
+	}
+}
+
+func TestGetStatsThreadCount(t *testing.T) {
+	cpuDir := newTestCgroupDir(t, map[string]string{
+		"cpu.stat": "nr_periods 0\nnr_throttled 0\nthrottled_time 0\n",
+		"tasks":    "100\n101\n102\n",
+	})
+	defer os.RemoveAll(cpuDir)
+	// The same threads, and a cgroup without a tasks file.
+	memoryDir := newTestCgroupDir(t, map[string]string{
+		"tasks": "100\n101\n102\n",
+	})
+	defer os.RemoveAll(memoryDir)
+	cpusetDir := newTestCgroupDir(t, nil)
+	defer os.RemoveAll(cpusetDir)
+	handler := newTestRawContainerHandler("/test", map[string]string{
+		"cpu":    cpuDir,
+		"memory": memoryDir,
+		"cpuset": cpusetDir,
+	})
+	handler.options.ThreadCountStats = true
+
+	stats, err := handler.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Processes.ThreadCount != 3 {
+		t.Errorf("expected 3 threads, got %d", stats.Processes.ThreadCount)
+	}
+
+	// The unified hierarchy lists the threads in cgroup.threads.
+	unifiedDir := newTestCgroupDir(t, map[string]string{
+		"cpu.stat":       "usage_usec 0\nuser_usec 0\nsystem_usec 0\n",
+		"cgroup.threads": "200\n201\n",
+	})
+	defer os.RemoveAll(unifiedDir)
+	handler = newTestRawContainerHandler("/test", map[string]string{"cpu": unifiedDir})
+	handler.options.ThreadCountStats = true
+	stats, err = handler.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Processes.ThreadCount != 2 {
+		t.Errorf("expected 2 threads on the unified hierarchy, got %d", stats.Processes.ThreadCount)
+	}
+
+	// A tasks file that can't be parsed leaves the thread count unset
+	// without failing the other stats.
+	brokenDir := newTestCgroupDir(t, map[string]string{
+		"cpu.stat": "nr_periods 0\nnr_throttled 0\nthrottled_time 0\n",
+		"tasks":    "100\nnot a thread\n",
+	})
+	defer os.RemoveAll(brokenDir)
+	handler = newTestRawContainerHandler("/test", map[string]string{"cpu": brokenDir})
+	handler.options.ThreadCountStats = true
+	stats, err = handler.GetStats()
+	if err != nil {
+		t.Fatalf("a broken tasks file must not fail the stats: %v", err)
+	}
+	if stats.Processes.ThreadCount != 0 {
+		t.Errorf("expected no thread count from a broken tasks file, got %d", stats.Processes.ThreadCount)
+	}
+}
+
+func TestGetStatsThreadCountDisabled(t *testing.T) {
+	cpuDir := newTestCgroupDir(t, map[string]string{
+		"cpu.stat": "nr_periods 0\nnr_throttled 0\nthrottled_time 0\n",
+		"tasks":    "100\n101\n102\n",
+	})
+	defer os.RemoveAll(cpuDir)
+	handler := newTestRawContainerHandler("/test", map[string]string{"cpu": cpuDir})
+
+	stats, err := handler.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Processes.ThreadCount != 0 {
+		t.Errorf("threads are only counted with --thread_count_stats, got %d", stats.Processes.ThreadCount)
+	}
+}
+
+func TestEnabledControllers(t *testing.T) {
+	cpuDir := newTestCgroupDir(t, nil)
+	defer os.RemoveAll(cpuDir)
+	memoryDir := newTestCgroupDir(t, nil)
+	defer os.RemoveAll(memoryDir)
+
+	// The hierarchies with a cgroup on v1.
+	controllers := newTestCgroupReader().enabledControllers(map[string]string{
+		"cpu":     cpuDir,
+		"memory":  memoryDir,
+		"cpuacct": "/dir_does_not_exist",
+	})
+	if !reflect.DeepEqual(controllers, []string{"cpu", "memory"}) {
+		t.Errorf("enabled controllers %v, expected [cpu memory]", controllers)
+	}
+
+	// The controllers listed in cgroup.controllers on v2.
+	unifiedDir := newTestCgroupDir(t, map[string]string{
+		"cgroup.controllers": "memory io cpu pids\n",
+	})
+	defer os.RemoveAll(unifiedDir)
+	controllers = newTestCgroupReader().enabledControllers(map[string]string{"cpu": unifiedDir, "memory": unifiedDir})
+	if !reflect.DeepEqual(controllers, []string{"cpu", "io", "memory", "pids"}) {
+		t.Errorf("enabled controllers %v, expected [cpu io memory pids]", controllers)
+	}
+}
+
+func TestWatchSpecChanges(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"memory.limit_in_bytes":      "1073741824\n",
+		"test/memory.limit_in_bytes": "536870912\n",
+	})
+	defer os.RemoveAll(dir)
+	handler := newTestRawContainerHandler("/", map[string]string{"memory": dir})
+	handler.options.WatchSpecChanges = true
+	handler.cgroupSubsystems = &libcontainer.CgroupSubsystems{
+		Mounts: []cgroups.Mount{{Mountpoint: dir, Subsystems: []string{"memory"}}},
+	}
+
+	events := make(chan container.SubcontainerEvent)
+	err := handler.WatchSubcontainers(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handler.StopWatchingSubcontainers()
+
+	for _, name := range []string{"/", "/test"} {
+		err = ioutil.WriteFile(path.Join(dir, name, "memory.limit_in_bytes"), []byte("268435456\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case event := <-events:
+			if event.EventType != container.SubcontainerSpecChanged || event.Name != name {
+				t.Errorf("expected a spec change of %q, got %+v", name, event)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("no event for the spec change of %q", name)
+		}
+		// Writing a file can produce several events.
+		for drained := false; !drained; {
+			select {
+			case <-events:
+			case <-time.After(100 * time.Millisecond):
+				drained = true
+			}
+		}
+	}
+}
+
+func TestWatchSpecChangesDelete(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"test/memory.limit_in_bytes": "536870912\n",
+	})
+	defer os.RemoveAll(dir)
+	handler := newTestRawContainerHandler("/", map[string]string{"memory": dir})
+	handler.options.WatchSpecChanges = true
+	handler.cgroupSubsystems = &libcontainer.CgroupSubsystems{
+		Mounts: []cgroups.Mount{{Mountpoint: dir, Subsystems: []string{"memory"}}},
+	}
+
+	events := make(chan container.SubcontainerEvent)
+	err := handler.WatchSubcontainers(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handler.StopWatchingSubcontainers()
+
+	// Removing the cgroup removes its files, then its directory. Only the
+	// deletion is reported.
+	if err = os.RemoveAll(path.Join(dir, "test")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-events:
+		expected := container.SubcontainerEvent{EventType: container.SubcontainerDelete, Name: "/test"}
+		if event != expected {
+			t.Errorf("expected event %+v, got %+v", expected, event)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("no event for the deletion of %q", "/test")
+	}
+}
+
+func TestGetApplicationIo(t *testing.T) {
+	cgroupDir := newTestCgroupDir(t, map[string]string{
+		"cgroup.procs":   "100\n101\n102\n",
+		"a/cgroup.procs": "200\n",
+	})
+	defer os.RemoveAll(cgroupDir)
+	// Process 101 exited since it was listed and the io of process 102 is
+	// not readable.
+	procIo := "rchar: %d\nwchar: %d\nsyscr: 10\nsyscw: 5\nread_bytes: %d\nwrite_bytes: %d\ncancelled_write_bytes: 0\n"
+	procRoot := newTestCgroupDir(t, map[string]string{
+		"100/io": fmt.Sprintf(procIo, 8192, 4096, 0, 4096),
+		"102/io": fmt.Sprintf(procIo, 1, 1, 1, 1),
+		"200/io": fmt.Sprintf(procIo, 1000, 2000, 512, 0),
+	})
+	defer os.RemoveAll(procRoot)
+	if err := os.Chmod(path.Join(procRoot, "102", "io"), 0); err != nil {
+		t.Fatal(err)
+	}
+	handler := newTestRawContainerHandler("/test", map[string]string{"cpu": cgroupDir})
+
+	expected := info.ApplicationIoStats{
+		Rchar:      8192 + 1000,
+		Wchar:      4096 + 2000,
+		Syscr:      20,
+		Syscw:      10,
+		ReadBytes:  512,
+		WriteBytes: 4096,
+	}
+	if os.Geteuid() == 0 {
+		// Root reads the io of process 102 regardless of its permissions.
+		expected.Rchar++
+		expected.Wchar++
+		expected.Syscr += 10
+		expected.Syscw += 5
+		expected.ReadBytes++
+		expected.WriteBytes++
+	}
+	if applicationIo := handler.getApplicationIo(procRoot); applicationIo != expected {
+		t.Errorf("expected application io %+v, got %+v", expected, applicationIo)
+	}
+}
+
+func TestAddOomScores(t *testing.T) {
+	cgroupDir := newTestCgroupDir(t, map[string]string{
+		"cgroup.procs":   "100\n101\n102\n",
+		"a/cgroup.procs": "200\n",
+	})
+	defer os.RemoveAll(cgroupDir)
+	// Process 101 exited since it was listed.
+	procRoot := newTestCgroupDir(t, map[string]string{
+		"100/oom_score":     "300\n",
+		"100/oom_score_adj": "-900\n",
+		"102/oom_score":     "10\n",
+		"102/oom_score_adj": "-500\n",
+		"200/oom_score":     "1200\n",
+		"200/oom_score_adj": "-999\n",
+	})
+	defer os.RemoveAll(procRoot)
+	handler := newTestRawContainerHandler("/test", map[string]string{"cpu": cgroupDir})
+
+	var stats info.ProcessStats
+	handler.addOomScores(&stats, procRoot)
+	expected := info.ProcessStats{MaxOomScore: 1200, MaxOomScorePid: 200, MaxOomScoreAdj: -500}
+	if stats != expected {
+		t.Errorf("expected process stats %+v, got %+v", expected, stats)
+	}
+}
+
+func TestGetInitProcess(t *testing.T) {
+	cgroupDir := newTestCgroupDir(t, map[string]string{
+		"cgroup.procs": "400\n200\n300\n",
+	})
+	defer os.RemoveAll(cgroupDir)
+	// Process 200 exited since it was listed.
+	procStat := "%d (sh) S 1 1 1 0 -1 4202752 1 0 0 0 5 3 0 0 20 0 1 0 %d 10000000 100\n"
+	procRoot := newTestCgroupDir(t, map[string]string{
+		"stat":        "btime 1420070400\n",
+		"300/cmdline": "/bin/sh\x00-c\x00sleep 1000\x00",
+		"300/stat":    fmt.Sprintf(procStat, 300, 500),
+		"300/limits":  "Limit                     Soft Limit           Hard Limit           Units     \nMax open files            1024                 unlimited            files     \n",
+		"400/cmdline": "sleep\x001000\x00",
+		"400/stat":    fmt.Sprintf(procStat, 400, 600),
+	})
+	defer os.RemoveAll(procRoot)
+	handler := newTestRawContainerHandler("/test", map[string]string{"cpu": cgroupDir})
+
+	expected := &info.ProcessSpec{
+		Pid:       300,
+		Command:   []string{"/bin/sh", "-c", "sleep 1000"},
+		StartTime: time.Unix(1420070400, 0).Add(procfs.JiffiesToDuration(500)),
+		OpenFilesLimit: &info.RlimitSpec{
+			Soft: 1024,
+			Hard: math.MaxUint64,
+		},
+	}
+	if process, _ := handler.getInitProcess(procRoot); !reflect.DeepEqual(process, expected) {
+		t.Errorf("expected init process %+v, got %+v", expected, process)
+	}
+
+	// The process is not read again while it runs.
+	if err := ioutil.WriteFile(path.Join(procRoot, "300/cmdline"), []byte("/bin/true\x00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if process, _ := handler.getInitProcess(procRoot); !reflect.DeepEqual(process, expected) {
+		t.Errorf("expected the init process to be reused as %+v, got %+v", expected, process)
+	}
+
+	// Once it exits the next process is the init process.
+	if err := os.RemoveAll(path.Join(procRoot, "300")); err != nil {
+		t.Fatal(err)
+	}
+	if process, _ := handler.getInitProcess(procRoot); process == nil || process.Pid != 400 {
+		t.Errorf("expected process 400 to be the init process, got %+v", process)
+	}
+}
+
+func TestGetSchedWaitTime(t *testing.T) {
+	cgroupDir := newTestCgroupDir(t, map[string]string{
+		"tasks":   "100\n101\n",
+		"a/tasks": "200\n",
+	})
+	defer os.RemoveAll(cgroupDir)
+	// Thread 101 exited since it was listed.
+	procRoot := newTestCgroupDir(t, map[string]string{
+		"100/schedstat": "1516264 234871 12\n",
+		"200/schedstat": "800000 100000 5\n",
+	})
+	defer os.RemoveAll(procRoot)
+	handler := newTestRawContainerHandler("/test", map[string]string{"cpu": cgroupDir})
+
+	if waitTime := handler.getSchedWaitTime(procRoot); waitTime != 234871+100000 {
+		t.Errorf("expected a wait time of %d, got %d", 234871+100000, waitTime)
+	}
+}
+
+func TestAddCpuContention(t *testing.T) {
+	cgroupDir := newTestCgroupDir(t, map[string]string{
+		"cpu.stat": "nr_periods 120\nnr_throttled 15\nthrottled_time 3000000\n",
+		"tasks":    "100\n101\n",
+	})
+	defer os.RemoveAll(cgroupDir)
+	procRoot := newTestCgroupDir(t, map[string]string{
+		"100/schedstat": "1516264 234871 12\n",
+		"101/schedstat": "800000 100000 5\n",
+	})
+	defer os.RemoveAll(procRoot)
+	handler := newTestRawContainerHandler("/test", map[string]string{"cpu": cgroupDir})
+
+	stats, err := handler.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Cpu.ThrottledTime != 3000000 || stats.Cpu.ContentionTime != 3000000 {
+		t.Errorf("expected a throttled and contention time of 3000000 without the wait time, got %d and %d", stats.Cpu.ThrottledTime, stats.Cpu.ContentionTime)
+	}
+
+	handler.options.SchedWaitTime = true
+	handler.addCpuContention(stats, procRoot)
+	if expected := uint64(3000000 + 234871 + 100000); stats.Cpu.ContentionTime != expected {
+		t.Errorf("expected a contention time of %d, got %d", expected, stats.Cpu.ContentionTime)
+	}
+}
+
+func TestHasOwnMountNamespace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for pid, ns := range map[string]string{
+		"1":   "mnt:[4026531840]",
+		"100": "mnt:[4026531840]",
+		"200": "mnt:[4026532290]",
+	} {
+		if err := os.MkdirAll(path.Join(dir, pid, "ns"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(ns, path.Join(dir, pid, "ns", "mnt")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for pid, expected := range map[string]bool{"100": false, "200": true} {
+		hasMountNamespace, err := hasOwnMountNamespace(path.Join(dir, pid), path.Join(dir, "1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hasMountNamespace != expected {
+			t.Errorf("expected process %s to have its own mount namespace: %v, got %v", pid, expected, hasMountNamespace)
+		}
+	}
+	if _, err := hasOwnMountNamespace(path.Join(dir, "300"), path.Join(dir, "1")); err == nil {
+		t.Errorf("expected an error for a process that exited")
+	}
+}
+
+func TestListContainersSorted(t *testing.T) {
+	cpuDir := newTestCgroupDir(t, map[string]string{
+		"b/cgroup.procs":   "",
+		"c/d/cgroup.procs": "",
+		"a/cgroup.procs":   "",
+	})
+	defer os.RemoveAll(cpuDir)
+	memoryDir := newTestCgroupDir(t, map[string]string{
+		"e/cgroup.procs": "",
+		"a/cgroup.procs": "",
+	})
+	defer os.RemoveAll(memoryDir)
+	handler := newTestRawContainerHandler("/", map[string]string{
+		"cpu":    cpuDir,
+		"memory": memoryDir,
+	})
+
+	containers, err := handler.ListContainers(container.ListRecursive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, cont := range containers {
+		names = append(names, cont.Name)
+	}
+	expected := []string{"/a", "/b", "/c", "/c/d", "/e"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("listed containers %v, expected %v", names, expected)
+	}
+}
+
+func TestCgroupPathsForName(t *testing.T) {
+	cgroupSubsystems := &libcontainer.CgroupSubsystems{
+		MountPoints: map[string]string{
+			"cpu":     "/sys/fs/cgroup/cpu,cpuacct",
+			"cpuacct": "/sys/fs/cgroup/cpu,cpuacct",
+			"memory":  "/sys/fs/cgroup/memory",
+		},
+	}
+	expected := map[string]string{
+		"cpu":     "/sys/fs/cgroup/cpu,cpuacct/docker/abc",
+		"cpuacct": "/sys/fs/cgroup/cpu,cpuacct/docker/abc",
+		"memory":  "/sys/fs/cgroup/memory/docker/abc",
+	}
+	cgroupPaths := CgroupPathsForName("/docker/abc", cgroupSubsystems)
+	if !reflect.DeepEqual(cgroupPaths, expected) {
+		t.Errorf("expected cgroup paths %v, got %v", expected, cgroupPaths)
+	}
+
+	handler, err := newRawContainerHandler("/docker/abc", cgroupSubsystems, nil, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handlerPaths := handler.(*rawContainerHandler).getCgroupPaths(); !reflect.DeepEqual(handlerPaths, cgroupPaths) {
+		t.Errorf("expected the cgroup paths %v of the handler, got %v", handlerPaths, cgroupPaths)
+	}
+}
+
+func TestCountContainers(t *testing.T) {
+	cpuDir := newTestCgroupDir(t, map[string]string{
+		"a/cgroup.procs":     "",
+		"a/b/cgroup.procs":   "",
+		"a/b/c/cgroup.procs": "",
+		"d/cgroup.procs":     "",
+	})
+	defer os.RemoveAll(cpuDir)
+	memoryDir := newTestCgroupDir(t, map[string]string{
+		"a/cgroup.procs":   "",
+		"a/e/cgroup.procs": "",
+	})
+	defer os.RemoveAll(memoryDir)
+	handler := newTestRawContainerHandler("/", map[string]string{
+		"cpu":    cpuDir,
+		"memory": memoryDir,
+	})
+
+	for _, test := range []struct {
+		recursive bool
+		expected  int
+	}{
+		{false, 2},
+		{true, 5},
+	} {
+		count, err := container.CountContainers(handler, test.recursive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != test.expected {
+			t.Errorf("expected %d containers when recursive is %v, got %d", test.expected, test.recursive, count)
+		}
+	}
+}
+
+func TestGetStatsTimestamp(t *testing.T) {
+	cpuDir := newTestCgroupDir(t, map[string]string{
+		"cpu.stat": "nr_periods 0\nnr_throttled 0\nthrottled_time 0\n",
+	})
+	defer os.RemoveAll(cpuDir)
+	handler := newTestRawContainerHandler("/test", map[string]string{
+		"cpu": cpuDir,
+	})
+	now := time.Date(2015, time.June, 1, 12, 0, 0, 0, time.UTC)
+	handler.clock = clock.NewFakeClock(now)
+
+	stats, err := handler.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stats.Timestamp.Equal(now) {
+		t.Errorf("expected stats timestamp %v, got %v", now, stats.Timestamp)
+	}
+	if stats.CollectionDuration != 0 {
+		t.Errorf("expected no collection duration with a fixed clock, got %v", stats.CollectionDuration)
+	}
+}
+
+// The real file system, counting the files opened.
+type countingFileSystem struct {
+	osFileSystem
+	opened uint64
+}
+
+func (self *countingFileSystem) Open(name string) (utilsfs.File, error) {
+	self.opened++
+	return self.osFileSystem.Open(name)
+}
+
+// File system whose files have the specified modification time, counting the
+// opens of every file.
+type mtimeFileSystem struct {
+	osFileSystem
+	modTime time.Time
+	opened  map[string]int
+}
+
+func (self *mtimeFileSystem) Open(name string) (utilsfs.File, error) {
+	self.opened[path.Base(name)]++
+	return self.osFileSystem.Open(name)
+}
+
+func (self *mtimeFileSystem) Stat(name string) (os.FileInfo, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return mtimeFileInfo{info, self.modTime}, nil
+}
+
+type mtimeFileInfo struct {
+	os.FileInfo
+	modTime time.Time
+}
+
+func (self mtimeFileInfo) ModTime() time.Time {
+	return self.modTime
+}
+
+func TestReadConfigStringUnchanged(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"memory.high": "2147483648\n",
+	})
+	defer os.RemoveAll(dir)
+	handler := newTestRawContainerHandler("/test", map[string]string{"memory": dir})
+	handler.options.SkipUnchangedConfigFiles = true
+	fs := &mtimeFileSystem{modTime: time.Unix(1000, 0), opened: make(map[string]int)}
+	handler.reader.fs = fs
+
+	for i := 0; i < 2; i++ {
+		if !handler.isOverMemoryHigh(dir, 3<<30) {
+			t.Errorf("usage of 3GiB should be over the 2GiB high watermark")
+		}
+	}
+	if fs.opened["memory.high"] != 1 {
+		t.Errorf("expected the unchanged memory.high to be read once, read %d times", fs.opened["memory.high"])
+	}
+
+	// Written since the last read.
+	if err := ioutil.WriteFile(path.Join(dir, "memory.high"), []byte("max\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fs.modTime = fs.modTime.Add(time.Second)
+	if handler.isOverMemoryHigh(dir, 3<<30) {
+		t.Errorf("usage should not be over an unlimited high watermark")
+	}
+	if fs.opened["memory.high"] != 2 {
+		t.Errorf("expected the changed memory.high to be read again, read %d times", fs.opened["memory.high"])
+	}
+}
+
+func TestGetStatsCollectionCost(t *testing.T) {
+	cpuDir := newTestCgroupDir(t, map[string]string{
+		"cpu.stat": "nr_periods 0\nnr_throttled 0\nthrottled_time 0\n",
+	})
+	defer os.RemoveAll(cpuDir)
+	blkioDir := newTestCgroupDir(t, map[string]string{
+		"io.stat": "8:0 rbytes=1048576 wbytes=4096 rios=256 wios=1 dbytes=0 dios=0 cost.vrate=100.00 cost.usage=5120 cost.wait=300 cost.indebt=0\n",
+	})
+	defer os.RemoveAll(blkioDir)
+	handler := newTestRawContainerHandler("/test", map[string]string{
+		"cpu":   cpuDir,
+		"blkio": blkioDir,
+	})
+	fs := &countingFileSystem{}
+	handler.reader.fs = fs
+
+	// Not recorded by default.
+	stats, err := handler.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.CollectionCost != nil {
+		t.Errorf("expected no collection cost by default, got %+v", stats.CollectionCost)
+	}
+
+	handler.options.RecordCollectionCost = true
+	fs.opened = 0
+	stats, err = handler.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.CollectionCost == nil {
+		t.Fatalf("expected the collection cost to be recorded")
+	}
+	// Libcontainer reads cpu.stat itself.
+	if fs.opened == 0 || stats.CollectionCost.FilesRead != fs.opened+1 {
+		t.Errorf("recorded %d files read, expected %d", stats.CollectionCost.FilesRead, fs.opened+1)
+	}
+}
+
+// Watcher recording the watched paths, whose events are fed by the test.
+type fakeWatcher struct {
+	lock    sync.Mutex
+	watches map[string]uint32
+	events  chan *inotify.Event
+	errors  chan error
+}
+
+func newFakeWatcher() *fakeWatcher {
+	return &fakeWatcher{
+		watches: make(map[string]uint32),
+		events:  make(chan *inotify.Event),
+		errors:  make(chan error),
+	}
+}
+
+func (self *fakeWatcher) AddWatch(path string, flags uint32) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.watches[path] = flags
+	return nil
+}
+
+func (self *fakeWatcher) RemoveWatch(path string) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if _, ok := self.watches[path]; !ok {
+		return fmt.Errorf("%q is not watched", path)
+	}
+	delete(self.watches, path)
+	return nil
+}
+
+func (self *fakeWatcher) Event() <-chan *inotify.Event {
+	return self.events
+}
+
+func (self *fakeWatcher) Error() <-chan error {
+	return self.errors
+}
+
+func (self *fakeWatcher) Close() error {
+	return nil
+}
+
+// Fake watcher signaling when it is closed.
+type closeNotifyingWatcher struct {
+	*fakeWatcher
+	closed chan struct{}
+}
+
+func (self *closeNotifyingWatcher) Close() error {
+	close(self.closed)
+	return nil
+}
+
+func (self *fakeWatcher) isWatched(path string) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	_, ok := self.watches[path]
+	return ok
+}
+
+func TestProcessEvent(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"a/cgroup.procs": "",
+		"b/cgroup.procs": "",
+	})
+	defer os.RemoveAll(dir)
+	handler := newTestRawContainerHandler("/", map[string]string{"cpu": dir})
+	handler.cgroupSubsystems = &libcontainer.CgroupSubsystems{
+		Mounts: []cgroups.Mount{{Mountpoint: dir, Subsystems: []string{"cpu"}}},
+	}
+	watcher := newFakeWatcher()
+	handler.watcher = watcher
+
+	cases := []struct {
+		description string
+		event       inotify.Event
+		expected    *container.SubcontainerEvent
+	}{
+		{
+			"container created",
+			inotify.Event{Mask: inotify.IN_CREATE | inotify.IN_ISDIR, Name: path.Join(dir, "a")},
+			&container.SubcontainerEvent{EventType: container.SubcontainerAdd, Name: "/a"},
+		},
+		{
+			"already watched container created again",
+			inotify.Event{Mask: inotify.IN_CREATE | inotify.IN_ISDIR, Name: path.Join(dir, "a")},
+			nil,
+		},
+		{
+			"container renamed away",
+			inotify.Event{Mask: inotify.IN_MOVED_FROM | inotify.IN_ISDIR, Name: path.Join(dir, "a")},
+			&container.SubcontainerEvent{EventType: container.SubcontainerDelete, Name: "/a"},
+		},
+		{
+			"container renamed in",
+			inotify.Event{Mask: inotify.IN_MOVED_TO | inotify.IN_ISDIR, Name: path.Join(dir, "b")},
+			&container.SubcontainerEvent{EventType: container.SubcontainerAdd, Name: "/b"},
+		},
+		{
+			"unwatched container deleted",
+			inotify.Event{Mask: inotify.IN_DELETE | inotify.IN_ISDIR, Name: path.Join(dir, "c")},
+			nil,
+		},
+		{
+			"container deleted",
+			inotify.Event{Mask: inotify.IN_DELETE | inotify.IN_ISDIR, Name: path.Join(dir, "b")},
+			&container.SubcontainerEvent{EventType: container.SubcontainerDelete, Name: "/b"},
+		},
+		{
+			"ignored event",
+			inotify.Event{Mask: inotify.IN_ACCESS, Name: path.Join(dir, "b")},
+			nil,
+		},
+		{
+			"spec file of a deleted container written",
+			inotify.Event{Mask: inotify.IN_MODIFY, Name: path.Join(dir, "c", "memory.limit_in_bytes")},
+			nil,
+		},
+	}
+	for _, c := range cases {
+		events := make(chan container.SubcontainerEvent, 1)
+		if err := handler.processEvent(&c.event, events); err != nil {
+			t.Fatalf("%s: %v", c.description, err)
+		}
+		select {
+		case event := <-events:
+			if c.expected == nil || event != *c.expected {
+				t.Errorf("%s: expected event %+v, got %+v", c.description, c.expected, event)
+			}
+		default:
+			if c.expected != nil {
+				t.Errorf("%s: expected event %+v, got none", c.description, c.expected)
+			}
+		}
+	}
+
+	if watcher.isWatched(path.Join(dir, "a")) || watcher.isWatched(path.Join(dir, "b")) {
+		t.Errorf("expected the watches of the removed containers to be removed, watching %v", watcher.watches)
+	}
+	if watched := handler.WatchedContainers(); len(watched) != 0 {
+		t.Errorf("expected no watched containers, got %v", watched)
+	}
+}
+
+func TestProcessEventSelfDeleted(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"a/b/cgroup.procs": "",
+	})
+	defer os.RemoveAll(dir)
+	handler := newTestRawContainerHandler("/a", map[string]string{"cpu": path.Join(dir, "a")})
+	handler.cgroupSubsystems = &libcontainer.CgroupSubsystems{
+		Mounts: []cgroups.Mount{{Mountpoint: dir, Subsystems: []string{"cpu"}}},
+	}
+	watcher := newFakeWatcher()
+	handler.watcher = watcher
+	if err := handler.watchDirectory(path.Join(dir, "a"), "/a"); err != nil {
+		t.Fatal(err)
+	}
+	if watcher.watches[path.Join(dir, "a")]&inotify.IN_DELETE_SELF == 0 || watcher.watches[path.Join(dir, "a", "b")]&inotify.IN_DELETE_SELF != 0 {
+		t.Errorf("expected only the directory of the container itself to be watched for its deletion, watching %v", watcher.watches)
+	}
+
+	events := make(chan container.SubcontainerEvent, 2)
+	// The deletion is only reported once.
+	for i := 0; i < 2; i++ {
+		if err := handler.processEvent(&inotify.Event{Mask: inotify.IN_DELETE_SELF, Name: path.Join(dir, "a")}, events); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected a single event for the deleted container, got %d", len(events))
+	}
+	expected := container.SubcontainerEvent{EventType: container.SubcontainerDelete, Name: "/a"}
+	if event := <-events; event != expected {
+		t.Errorf("expected event %+v, got %+v", expected, event)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"a/cgroup.procs": "",
+	})
+	defer os.RemoveAll(dir)
+	var handlers []*rawContainerHandler
+	for _, name := range []string{"/", "/a"} {
+		handler := newTestRawContainerHandler(name, map[string]string{"cpu": path.Join(dir, name)})
+		handler.watcher = newFakeWatcher()
+		if err := handler.WatchSubcontainers(make(chan container.SubcontainerEvent)); err != nil {
+			t.Fatal(err)
+		}
+		handlers = append(handlers, handler)
+	}
+
+	if err := Shutdown(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	for _, handler := range handlers {
+		if handler.watcher != nil {
+			t.Errorf("expected the watch of %q to be stopped", handler.name)
+		}
+	}
+	activeWatchersLock.Lock()
+	defer activeWatchersLock.Unlock()
+	if len(activeWatchers) != 0 {
+		t.Errorf("expected no active watchers after shutdown, got %d", len(activeWatchers))
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	// Nothing reads the stop requests of the handler.
+	handler := newTestRawContainerHandler("/stuck", map[string]string{})
+	handler.watcher = newFakeWatcher()
+	registerWatcher(handler)
+	defer unregisterWatcher(handler)
+
+	if err := Shutdown(10 * time.Millisecond); err == nil {
+		t.Errorf("expected an error when a watch does not stop")
+	}
+}
+
+func TestWatchSubcontainersFakeWatcher(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"a/cgroup.procs": "",
+	})
+	defer os.RemoveAll(dir)
+	handler := newTestRawContainerHandler("/", map[string]string{"cpu": dir})
+	handler.cgroupSubsystems = &libcontainer.CgroupSubsystems{
+		Mounts: []cgroups.Mount{{Mountpoint: dir, Subsystems: []string{"cpu"}}},
+	}
+	watcher := newFakeWatcher()
+	handler.watcher = watcher
+
+	events := make(chan container.SubcontainerEvent)
+	if err := handler.WatchSubcontainers(events); err != nil {
+		t.Fatal(err)
+	}
+	if !watcher.isWatched(dir) || !watcher.isWatched(path.Join(dir, "a")) {
+		t.Errorf("expected the existing cgroups to be watched, watching %v", watcher.watches)
+	}
+
+	if err := os.Mkdir(path.Join(dir, "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	watcher.events <- &inotify.Event{Mask: inotify.IN_CREATE | inotify.IN_ISDIR, Name: path.Join(dir, "b")}
+	select {
+	case event := <-events:
+		expected := container.SubcontainerEvent{EventType: container.SubcontainerAdd, Name: "/b"}
+		if event != expected {
+			t.Errorf("expected event %+v, got %+v", expected, event)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("no event for the created container")
+	}
+
+	if err := handler.StopWatchingSubcontainers(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadCpuRelativeWeight(t *testing.T) {
+	cases := []struct {
+		file     string
+		value    string
+		expected float64
+	}{
+		{"cpu.shares", "2048", 2.0},
+		{"cpu.shares", "512", 0.5},
+		{"cpu.shares", "1024", 1.0},
+		// Weights runc converts 2048 and 512 shares to.
+		{"cpu.weight", "79", 2.0},
+		{"cpu.weight", "20", 0.5},
+	}
+	for _, c := range cases {
+		dir := newTestCgroupDir(t, map[string]string{c.file: c.value + "\n"})
+		defer os.RemoveAll(dir)
+		// Weights are accurate to a weight step of about 26 shares.
+		if weight := newTestCgroupReader().readCpuRelativeWeight(dir); math.Abs(weight-c.expected) > 26.0/1024 {
+			t.Errorf("expected relative weight %v for %s %s, got %v", c.expected, c.file, c.value, weight)
+		}
+	}
+
+	dir := newTestCgroupDir(t, nil)
+	defer os.RemoveAll(dir)
+	if weight := newTestCgroupReader().readCpuRelativeWeight(dir); weight != 0 {
+		t.Errorf("expected no relative weight without cpu.shares or cpu.weight, got %v", weight)
+	}
+}
+
+// FsInfo of fixed filesystems and directory usages.
+type fakeFsInfo struct {
+	failingFsInfo
+	filesystems []fs.Fs
+	dirUsage    map[string]uint64
+}
+
+func (self *fakeFsInfo) GetFsInfoForPath(mountSet map[string]struct{}) ([]fs.Fs, error) {
+	var filesystems []fs.Fs
+	for _, fs := range self.filesystems {
+		if _, ok := mountSet[fs.Mountpoint]; ok {
+			filesystems = append(filesystems, fs)
+		}
+	}
+	return filesystems, nil
+}
+
+func (self *fakeFsInfo) GetDirUsage(dir string) (uint64, error) {
+	return self.dirUsage[dir], nil
+}
+
+func TestGetFsStatsBindMount(t *testing.T) {
+	handler := newTestRawContainerHandler("/test", map[string]string{})
+	handler.externalMounts = []mount{
+		// A whole filesystem.
+		{HostDir: "/mnt/disk", ContainerDir: "/disk"},
+		// A directory of the root filesystem of the host.
+		{HostDir: "/var/lib/app/", ContainerDir: "/data"},
+	}
+	handler.fsInfo = &fakeFsInfo{
+		filesystems: []fs.Fs{
+			{DeviceInfo: fs.DeviceInfo{Device: "/dev/sda1"}, Mountpoint: "/", Capacity: 1000, Free: 400},
+			{DeviceInfo: fs.DeviceInfo{Device: "/dev/sdb1"}, Mountpoint: "/mnt/disk", Capacity: 500, Free: 300},
+			{DeviceInfo: fs.DeviceInfo{Device: "/dev/sdc1"}, Mountpoint: "/mnt/other", Capacity: 100, Free: 100},
+		},
+		dirUsage: map[string]uint64{"/var/lib/app": 50},
+	}
+
+	stats := &info.ContainerStats{}
+	if err := handler.getFsStats(stats); err != nil {
+		t.Fatal(err)
+	}
+	expected := []info.FsStats{
+		{Device: "/dev/sda1", Mountpoint: "/", Limit: 1000, Usage: 600, Shared: true},
+		{Device: "/dev/sdb1", Mountpoint: "/mnt/disk", Limit: 500, Usage: 200},
+	}
+	if !reflect.DeepEqual(stats.Filesystem, expected) {
+		t.Errorf("expected filesystem stats %+v, got %+v", expected, stats.Filesystem)
+	}
+
+	// The usage of the mounted directory instead of its filesystem.
+	handler.options.BindMountFsUsage = true
+	stats = &info.ContainerStats{}
+	if err := handler.getFsStats(stats); err != nil {
+		t.Fatal(err)
+	}
+	expected[0].Usage = 50
+	if !reflect.DeepEqual(stats.Filesystem, expected) {
+		t.Errorf("expected filesystem stats %+v, got %+v", expected, stats.Filesystem)
+	}
+}
+
+func TestAddExternalMount(t *testing.T) {
+	handler := newTestRawContainerHandler("/test", map[string]string{})
+	handler.options.FsStatsInterval = time.Hour
+	handler.fsInfo = &fakeFsInfo{
+		filesystems: []fs.Fs{
+			{DeviceInfo: fs.DeviceInfo{Device: "/dev/sdb1"}, Mountpoint: "/mnt/disk", Capacity: 500, Free: 300},
+		},
+	}
+
+	stats := &info.ContainerStats{}
+	if err := handler.getSampledFsStats(stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Filesystem) != 0 {
+		t.Errorf("expected no filesystem stats without external mounts, got %+v", stats.Filesystem)
+	}
+
+	// The sampled stats are collected again with the new mount.
+	if err := handler.AddExternalMount("/mnt/disk", "/disk"); err != nil {
+		t.Fatal(err)
+	}
+	if err := handler.AddExternalMount("/mnt/disk/", "/other"); err == nil {
+		t.Errorf("expected an error adding an external mount twice")
+	}
+	stats = &info.ContainerStats{}
+	if err := handler.getSampledFsStats(stats); err != nil {
+		t.Fatal(err)
+	}
+	expected := []info.FsStats{
+		{Device: "/dev/sdb1", Mountpoint: "/mnt/disk", Limit: 500, Usage: 200},
+	}
+	if !reflect.DeepEqual(stats.Filesystem, expected) {
+		t.Errorf("expected filesystem stats %+v, got %+v", expected, stats.Filesystem)
+	}
+
+	handler.RemoveExternalMount("/mnt/disk")
+	stats = &info.ContainerStats{}
+	if err := handler.getSampledFsStats(stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Filesystem) != 0 {
+		t.Errorf("expected no filesystem stats after removing the external mount, got %+v", stats.Filesystem)
+	}
+}
+
+func TestIsScopedCgroupMount(t *testing.T) {
+	mounts := []*dockermount.MountInfo{
+		{Root: "/", Mountpoint: "/", Fstype: "ext4"},
+		{Root: "/", Mountpoint: "/sys/fs/cgroup/cpu,cpuacct", Fstype: "cgroup"},
+		{Root: "/docker/0123", Mountpoint: "/sys/fs/cgroup/memory", Fstype: "cgroup"},
+	}
+	if isScopedCgroupMount(mounts, "/sys/fs/cgroup/cpu,cpuacct") {
+		t.Errorf("the cpu hierarchy is mounted at its root")
+	}
+	if !isScopedCgroupMount(mounts, "/sys/fs/cgroup/memory") {
+		t.Errorf("the memory hierarchy is mounted at a cgroup of a container")
+	}
+	if isScopedCgroupMount(mounts, "/sys/fs/cgroup/blkio") {
+		t.Errorf("an unknown mountpoint is not scoped")
+	}
+}
+
+func TestAddMachineUsage(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"stat":    "cpu  100 0 50 1000 10 0 0 0 0 0\ncpu0 100 0 50 1000 10 0 0 0 0 0\n",
+		"meminfo": "MemTotal:       1000 kB\nMemFree:         200 kB\nMemAvailable:    600 kB\n",
+	})
+	defer os.RemoveAll(dir)
+	stats := &info.ContainerStats{}
+	stats.Cpu.Usage.Total = 1
+	stats.Memory.Usage = 1
+
+	if err := addMachineUsage(stats, dir); err != nil {
+		t.Fatal(err)
+	}
+	// In nanoseconds, from 100 ticks per second.
+	if stats.Cpu.Usage.Total != 150*1e7 || stats.Cpu.Usage.User != 100*1e7 || stats.Cpu.Usage.System != 50*1e7 {
+		t.Errorf("expected the cpu usage of /proc/stat, got %+v", stats.Cpu.Usage)
+	}
+	if stats.Memory.Usage != 800*1024 || stats.Memory.WorkingSet != 400*1024 {
+		t.Errorf("expected the memory usage of /proc/meminfo, got %+v", stats.Memory)
+	}
+}
+
+func TestAddMachineCpuTimes(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"stat": "cpu  100 0 50 1000 10 0 0 20 30 0\ncpu0 100 0 50 1000 10 0 0 20 30 0\n",
+	})
+	defer os.RemoveAll(dir)
+	stats := &info.ContainerStats{}
+	stats.Cpu.Usage.Total = 1
+
+	if err := addMachineCpuTimes(stats, dir); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Cpu.Usage.Steal != 20*1e7 || stats.Cpu.Usage.Guest != 30*1e7 {
+		t.Errorf("expected the steal and guest time of /proc/stat, got %+v", stats.Cpu.Usage)
+	}
+	if stats.Cpu.Usage.Total != 1 {
+		t.Errorf("expected the total usage to be kept, got %d", stats.Cpu.Usage.Total)
+	}
+}
+
+// Meant to be run with -race.
+func TestGetStatsConcurrent(t *testing.T) {
+	cpuDir := newTestCgroupDir(t, map[string]string{
+		"cpu.stat": "nr_periods 0\nnr_throttled 0\nthrottled_time 0\n",
+	})
+	defer os.RemoveAll(cpuDir)
+	handler := newTestRawContainerHandler("/", map[string]string{
+		"cpu": cpuDir,
+	})
+	handler.options.StatsDeltas = true
+	handler.options.FsStatsInterval = time.Hour
+	handler.fsInfo = &countingFsInfo{}
+	handler.machineInfoFactory = fakeMachineInfoFactory{}
+	if err := handler.AddCollector("fake", &fakeCollector{metrics: map[string]float64{"requests": 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	const numCallers = 8
+	errs := make(chan error, 2*numCallers)
+	var wg sync.WaitGroup
+	for i := 0; i < numCallers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if _, err := handler.GetStats(); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := handler.GetSpec(); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestCheckCgroupMounts(t *testing.T) {
+	defer func(get func() (libcontainer.CgroupSubsystems, error)) { getCgroupSubsystems = get }(getCgroupSubsystems)
+	mountPoints := map[string]string{"cpu": "/sys/fs/cgroup/cpu", "memory": "/sys/fs/cgroup/memory"}
+	getCgroupSubsystems = func() (libcontainer.CgroupSubsystems, error) {
+		return libcontainer.CgroupSubsystems{MountPoints: mountPoints}, nil
+	}
+	handler := newTestRawContainerHandler("/test", map[string]string{
+		"cpu":    "/sys/fs/cgroup/cpu/test",
+		"memory": "/sys/fs/cgroup/memory/test",
+	})
+	handler.cgroupSubsystems = &libcontainer.CgroupSubsystems{MountPoints: mountPoints}
+	fakeClock := clock.NewFakeClock(time.Date(2015, time.June, 1, 12, 0, 0, 0, time.UTC))
+	handler.clock = fakeClock
+
+	// Not checked by default.
+	mountPoints = map[string]string{"cpu": "/cgroup/cpu", "memory": "/cgroup/memory"}
+	handler.checkCgroupMounts()
+	if cpuPath, _ := handler.GetCgroupPath("cpu"); cpuPath != "/sys/fs/cgroup/cpu/test" {
+		t.Errorf("cgroup paths should not be checked by default, cpu path is %q", cpuPath)
+	}
+
+	handler.options.CgroupMountCheckInterval = time.Minute
+	handler.checkCgroupMounts()
+	expected := map[string]string{"cpu": "/cgroup/cpu/test", "memory": "/cgroup/memory/test"}
+	if paths := handler.getCgroupPaths(); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected refreshed cgroup paths %v, got %v", expected, paths)
+	}
+	if !reflect.DeepEqual(handler.libcontainerState.CgroupPaths, expected) {
+		t.Errorf("expected refreshed libcontainer cgroup paths %v, got %v", expected, handler.libcontainerState.CgroupPaths)
+	}
+
+	// Checked again once the interval elapsed.
+	mountPoints = map[string]string{"cpu": "/sys/fs/cgroup/cpu", "memory": "/sys/fs/cgroup/memory"}
+	handler.checkCgroupMounts()
+	if cpuPath, _ := handler.GetCgroupPath("cpu"); cpuPath != "/cgroup/cpu/test" {
+		t.Errorf("cgroup paths should not be checked within the interval, cpu path is %q", cpuPath)
+	}
+	fakeClock.Step(time.Minute)
+	handler.checkCgroupMounts()
+	if cpuPath, _ := handler.GetCgroupPath("cpu"); cpuPath != "/sys/fs/cgroup/cpu/test" {
+		t.Errorf("expected the cgroup paths to be refreshed after the interval, cpu path is %q", cpuPath)
+	}
+}
+
+func TestWatchCgroupMounts(t *testing.T) {
+	defer func(get func() (libcontainer.CgroupSubsystems, error)) { getCgroupSubsystems = get }(getCgroupSubsystems)
+	defer func(interval time.Duration) { cgroupMountRetryInterval = interval }(cgroupMountRetryInterval)
+	defer atomic.StoreUint64(&cgroupMountsGeneration, atomic.LoadUint64(&cgroupMountsGeneration))
+	cgroupMountRetryInterval = time.Millisecond
+
+	// Nothing is mounted when the watch starts, the cpu hierarchy is mounted
+	// some time after its mountpoint is created.
+	var lock sync.Mutex
+	mountPoints := map[string]string{}
+	reads := 0
+	getCgroupSubsystems = func() (libcontainer.CgroupSubsystems, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		reads++
+		if reads == 3 {
+			mountPoints = map[string]string{"cpu": "/sys/fs/cgroup/cpu"}
+		}
+		return libcontainer.CgroupSubsystems{MountPoints: mountPoints}, nil
+	}
+	handler := newTestRawContainerHandler("/test", map[string]string{})
+	handler.cgroupSubsystems = &libcontainer.CgroupSubsystems{MountPoints: map[string]string{}}
+
+	watcher := &closeNotifyingWatcher{newFakeWatcher(), make(chan struct{})}
+	stop := make(chan struct{})
+	generation := atomic.LoadUint64(&cgroupMountsGeneration)
+	if err := watchCgroupMounts(watcher, "/sys/fs/cgroup", map[string]string{}, stop); err != nil {
+		t.Fatal(err)
+	}
+	// The watch is stopped before the overridden variables are restored.
+	defer func() {
+		close(stop)
+		<-watcher.closed
+	}()
+	if !watcher.isWatched("/sys/fs/cgroup") {
+		t.Fatal("expected /sys/fs/cgroup to be watched")
+	}
+
+	watcher.events <- &inotify.Event{Name: "/sys/fs/cgroup/cpu", Mask: inotify.IN_CREATE | inotify.IN_ISDIR}
+	deadline := time.Now().Add(10 * time.Second)
+	for atomic.LoadUint64(&cgroupMountsGeneration) == generation {
+		if time.Now().After(deadline) {
+			t.Fatal("the change of the cgroup mounts was not noticed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Refreshed even though the mounts are not checked periodically.
+	handler.checkCgroupMounts()
+	expected := map[string]string{"cpu": "/sys/fs/cgroup/cpu/test"}
+	if paths := handler.getCgroupPaths(); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected refreshed cgroup paths %v, got %v", expected, paths)
+	}
+}
+
+func TestGetRelativeCgroupPath(t *testing.T) {
+	handler := newTestRawContainerHandler("/test/a", map[string]string{
+		"cpu":    "/sys/fs/cgroup/cpu,cpuacct/test/a",
+		"memory": "/sys/fs/cgroup/memory/test/a",
+		"blkio":  "/elsewhere/test/a",
+	})
+	handler.cgroupSubsystems = &libcontainer.CgroupSubsystems{
+		MountPoints: map[string]string{
+			"cpu":    "/sys/fs/cgroup/cpu,cpuacct",
+			"memory": "/sys/fs/cgroup/memory/",
+			"blkio":  "/sys/fs/cgroup/blkio",
+		},
+	}
+
+	for _, resource := range []string{"cpu", "memory"} {
+		relativePath, err := handler.GetRelativeCgroupPath(resource)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if relativePath != "/test/a" {
+			t.Errorf("expected the relative %s cgroup path to be /test/a, got %q", resource, relativePath)
+		}
+	}
+	if _, err := handler.GetRelativeCgroupPath("blkio"); err == nil {
+		t.Errorf("expected an error for a cgroup path outside of the mountpoint")
+	}
+	if _, err := handler.GetRelativeCgroupPath("cpuset"); err == nil {
+		t.Errorf("expected an error for a resource without a cgroup")
+	}
+
+	// The root cgroup is the mountpoint.
+	handler = newTestRawContainerHandler("/", map[string]string{"cpu": "/sys/fs/cgroup/cpu"})
+	handler.cgroupSubsystems = &libcontainer.CgroupSubsystems{MountPoints: map[string]string{"cpu": "/sys/fs/cgroup/cpu"}}
+	if relativePath, err := handler.GetRelativeCgroupPath("cpu"); err != nil || relativePath != "/" {
+		t.Errorf("expected the relative cgroup path of the root to be /, got %q (%v)", relativePath, err)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raw
+
+import (
+	"path"
+	"sort"
+
+	"github.com/google/cadvisor/container/libcontainer"
+	"github.com/google/cadvisor/info"
+)
+
+// A container and its subcontainers.
+type ContainerNode struct {
+	Reference info.ContainerReference `json:"reference"`
+
+	// Direct subcontainers, sorted by name.
+	Subcontainers []*ContainerNode `json:"subcontainers,omitempty"`
+}
+
+// Lists every raw container on the machine, including the root container "/",
+// sorted by name. A container is in the list if it exists in any of the
+// cgroup hierarchies.
+func ListAllContainers(cgroupSubsystems *libcontainer.CgroupSubsystems) ([]info.ContainerReference, error) {
+	containers := map[string]struct{}{
+		"/": {},
+	}
+	// Hierarchies with several subsystems (e.g. cpu,cpuacct) are only listed once.
+	mountPoints := make(map[string]struct{}, len(cgroupSubsystems.MountPoints))
+	for _, mountPoint := range cgroupSubsystems.MountPoints {
+		mountPoints[mountPoint] = struct{}{}
+	}
+	for mountPoint := range mountPoints {
+		err := listDirectories(mountPoint, "/", true, containers)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	names := make([]string, 0, len(containers))
+	for name := range containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ret := make([]info.ContainerReference, 0, len(names))
+	for _, name := range names {
+		ret = append(ret, info.ContainerReference{
+			Name: name,
+		})
+	}
+	return ret, nil
+}
+
+// Same as ListAllContainers but returns the containers as a tree rooted at the
+// root container "/".
+func ListAllContainersTree(cgroupSubsystems *libcontainer.CgroupSubsystems) (*ContainerNode, error) {
+	refs, err := ListAllContainers(cgroupSubsystems)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parents sort before their children so they are always found.
+	nodes := make(map[string]*ContainerNode, len(refs))
+	var root *ContainerNode
+	for _, ref := range refs {
+		node := &ContainerNode{
+			Reference: ref,
+		}
+		nodes[ref.Name] = node
+		if ref.Name == "/" {
+			root = node
+			continue
+		}
+		parent := nodes[path.Dir(ref.Name)]
+		parent.Subcontainers = append(parent.Subcontainers, node)
+	}
+	return root, nil
+}
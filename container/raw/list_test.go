@@ -0,0 +1,90 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raw
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/google/cadvisor/container/libcontainer"
+	"github.com/google/cadvisor/info"
+)
+
+func newTestCgroupSubsystems(t *testing.T) (*libcontainer.CgroupSubsystems, func()) {
+	cpuDir := newTestCgroupDir(t, map[string]string{
+		"a/cgroup.procs":   "",
+		"a/b/cgroup.procs": "",
+	})
+	memoryDir := newTestCgroupDir(t, map[string]string{
+		"a/cgroup.procs": "",
+		"c/cgroup.procs": "",
+	})
+	cgroupSubsystems := &libcontainer.CgroupSubsystems{
+		MountPoints: map[string]string{
+			"cpu":     cpuDir,
+			"cpuacct": cpuDir,
+			"memory":  memoryDir,
+		},
+	}
+	return cgroupSubsystems, func() {
+		os.RemoveAll(cpuDir)
+		os.RemoveAll(memoryDir)
+	}
+}
+
+func TestListAllContainers(t *testing.T) {
+	cgroupSubsystems, cleanup := newTestCgroupSubsystems(t)
+	defer cleanup()
+
+	containers, err := ListAllContainers(cgroupSubsystems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []info.ContainerReference{
+		{Name: "/"},
+		{Name: "/a"},
+		{Name: "/a/b"},
+		{Name: "/c"},
+	}
+	if !reflect.DeepEqual(containers, expected) {
+		t.Errorf("listed %+v, expected %+v", containers, expected)
+	}
+}
+
+func TestListAllContainersTree(t *testing.T) {
+	cgroupSubsystems, cleanup := newTestCgroupSubsystems(t)
+	defer cleanup()
+
+	root, err := ListAllContainersTree(cgroupSubsystems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &ContainerNode{
+		Reference: info.ContainerReference{Name: "/"},
+		Subcontainers: []*ContainerNode{
+			{
+				Reference: info.ContainerReference{Name: "/a"},
+				Subcontainers: []*ContainerNode{
+					{Reference: info.ContainerReference{Name: "/a/b"}},
+				},
+			},
+			{Reference: info.ContainerReference{Name: "/c"}},
+		},
+	}
+	if !reflect.DeepEqual(root, expected) {
+		t.Errorf("listed tree %+v, expected %+v", root, expected)
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raw
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/google/cadvisor/container/libcontainer"
+	"github.com/google/cadvisor/info"
+	"github.com/google/cadvisor/utils"
+)
+
+// Outcome of reading a cgroup file.
+type FileStatus string
+
+const (
+	FileReadable         FileStatus = "readable"
+	FileMissing          FileStatus = "missing"
+	FilePermissionDenied FileStatus = "permission denied"
+	FileUnreadable       FileStatus = "unreadable"
+)
+
+// Outcome of reading one of the cgroup files of a controller.
+type FileReport struct {
+	Controller string
+	// Absolute path to the file.
+	Path   string
+	Status FileStatus
+	// Error reading the file, empty if it was readable.
+	Error string
+}
+
+// Result of validating that the raw driver can read the cgroup files it
+// expects, on the root container.
+type ValidationReport struct {
+	// Controllers validated that are mounted, sorted.
+	Controllers []string
+	// Controllers validated that are not mounted, sorted.
+	MissingControllers []string
+	// Cgroup files expected for every mounted controller.
+	Files []FileReport
+	// Errors getting the spec and the stats of the root container, empty on
+	// success.
+	SpecError  string
+	StatsError string
+}
+
+// Returns whether the raw driver can collect the spec and stats of containers.
+// Missing files are expected on some kernels and cgroup versions, so only
+// files that exist but cannot be read make the validation fail.
+func (self *ValidationReport) Ok() bool {
+	if self.SpecError != "" || self.StatsError != "" {
+		return false
+	}
+	for _, file := range self.Files {
+		if file.Status == FilePermissionDenied || file.Status == FileUnreadable {
+			return false
+		}
+	}
+	return true
+}
+
+func (self *ValidationReport) String() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Controllers: %v\n", self.Controllers)
+	if len(self.MissingControllers) > 0 {
+		fmt.Fprintf(&b, "Missing controllers: %v\n", self.MissingControllers)
+	}
+	for _, file := range self.Files {
+		if file.Error != "" {
+			fmt.Fprintf(&b, "%s: %s (%s)\n", file.Path, file.Status, file.Error)
+		} else {
+			fmt.Fprintf(&b, "%s: %s\n", file.Path, file.Status)
+		}
+	}
+	if self.SpecError != "" {
+		fmt.Fprintf(&b, "Failed to get spec: %s\n", self.SpecError)
+	}
+	if self.StatsError != "" {
+		fmt.Fprintf(&b, "Failed to get stats: %s\n", self.StatsError)
+	}
+	if self.Ok() {
+		fmt.Fprintf(&b, "OK\n")
+	} else {
+		fmt.Fprintf(&b, "FAILED\n")
+	}
+	return b.String()
+}
+
+// Cgroup files the raw driver reads for every controller of the v1
+// hierarchies.
+var validatedFilesV1 = map[string][]string{
+	"cpu": {
+		"cpu.shares",
+		"cpu.cfs_quota_us",
+		"cpu.cfs_period_us",
+		"cpu.stat",
+	},
+	"cpuacct": {
+		"cpuacct.usage",
+		"cpuacct.usage_percpu",
+		"cpuacct.stat",
+	},
+	"cpuset": {
+		"cpuset.cpus",
+	},
+	"memory": {
+		"memory.usage_in_bytes",
+		"memory.max_usage_in_bytes",
+		"memory.limit_in_bytes",
+		"memory.failcnt",
+		"memory.stat",
+	},
+	"blkio": {
+		"blkio.io_service_bytes_recursive",
+		"blkio.io_serviced_recursive",
+		"blkio.io_queued_recursive",
+	},
+}
+
+// Cgroup files the raw driver reads for every controller of the unified (v2)
+// hierarchy. The cpuacct stats are in cpu.stat and the io controller is found
+// under the blkio cgroup path.
+var validatedFilesV2 = map[string][]string{
+	"cpu": {
+		"cpu.weight",
+		"cpu.max",
+		"cpu.stat",
+	},
+	"cpuset": {
+		"cpuset.cpus",
+		"cpuset.cpus.effective",
+	},
+	"memory": {
+		"memory.current",
+		"memory.max",
+		"memory.events",
+		"memory.stat",
+	},
+	"blkio": {
+		"io.stat",
+	},
+}
+
+// Returns the cgroup files to validate for the cgroup version of the
+// cgroups at cgroupPaths, which are on the unified hierarchy when they have a
+// cgroup.controllers file.
+func validatedFilesFor(cgroupPaths map[string]string) map[string][]string {
+	for _, cgroupPath := range cgroupPaths {
+		if utils.FileExists(path.Join(cgroupPath, "cgroup.controllers")) {
+			return validatedFilesV2
+		}
+	}
+	return validatedFilesV1
+}
+
+// Validates that the raw driver can read the cgroup files it expects: creates
+// the handler of the root container, reads its expected cgroup files and gets
+// its spec and stats. Nothing is registered.
+func Validate(machineInfoFactory info.MachineInfoFactory, options Options) (*ValidationReport, error) {
+	cgroupSubsystems, err := libcontainer.GetCgroupSubsystems()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cgroup subsystems: %v", err)
+	}
+	factory := &rawFactory{
+		machineInfoFactory: machineInfoFactory,
+		cgroupSubsystems:   &cgroupSubsystems,
+		options:            &options,
+	}
+	return factory.Validate()
+}
+
+func (self *rawFactory) Validate() (*ValidationReport, error) {
+	handler, err := newRawContainerHandler("/", self.cgroupSubsystems, self.machineInfoFactory, self.options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the root container handler: %v", err)
+	}
+	rawHandler := handler.(*rawContainerHandler)
+	defer rawHandler.Cleanup()
+	return validateHandler(rawHandler), nil
+}
+
+func validateHandler(handler *rawContainerHandler) *ValidationReport {
+	report := &ValidationReport{}
+	cgroupPaths := handler.getCgroupPaths()
+	validatedFiles := validatedFilesFor(cgroupPaths)
+	controllers := make([]string, 0, len(validatedFiles))
+	for controller := range validatedFiles {
+		controllers = append(controllers, controller)
+	}
+	sort.Strings(controllers)
+	for _, controller := range controllers {
+		cgroupPath, ok := cgroupPaths[controller]
+		if !ok {
+			report.MissingControllers = append(report.MissingControllers, controller)
+			continue
+		}
+		report.Controllers = append(report.Controllers, controller)
+		for _, file := range validatedFiles[controller] {
+			report.Files = append(report.Files, checkCgroupFile(controller, path.Join(cgroupPath, file)))
+		}
+	}
+
+	if _, err := handler.GetSpec(); err != nil {
+		report.SpecError = err.Error()
+	}
+	if _, err := handler.GetStats(); err != nil {
+		report.StatsError = err.Error()
+	}
+	return report
+}
+
+func checkCgroupFile(controller, file string) FileReport {
+	report := FileReport{
+		Controller: controller,
+		Path:       file,
+	}
+	f, err := os.Open(file)
+	if err == nil {
+		// Some cgroup files can be opened but fail on read.
+		_, err = f.Read(make([]byte, 1))
+		f.Close()
+	}
+	report.Status = fileStatus(err)
+	if report.Status != FileReadable {
+		report.Error = err.Error()
+	}
+	return report
+}
+
+func fileStatus(err error) FileStatus {
+	switch {
+	case err == nil || err == io.EOF:
+		return FileReadable
+	case os.IsNotExist(err):
+		return FileMissing
+	case os.IsPermission(err):
+		return FilePermissionDenied
+	}
+	return FileUnreadable
+}
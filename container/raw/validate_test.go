@@ -0,0 +1,151 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raw
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+
+	"github.com/google/cadvisor/info"
+)
+
+type fakeMachineInfoFactory struct {
+	onlineCpus string
+}
+
+func (self fakeMachineInfoFactory) GetMachineInfo() (*info.MachineInfo, error) {
+	return &info.MachineInfo{NumCores: 1, OnlineCpus: self.onlineCpus}, nil
+}
+
+func (fakeMachineInfoFactory) GetVersionInfo() (*info.VersionInfo, error) {
+	return &info.VersionInfo{}, nil
+}
+
+func TestValidateHandler(t *testing.T) {
+	cpuDir := newTestCgroupDir(t, map[string]string{
+		"cpu.shares":        "1024\n",
+		"cpu.cfs_quota_us":  "-1\n",
+		"cpu.cfs_period_us": "100000\n",
+		"cpu.stat":          "nr_periods 0\nnr_throttled 0\nthrottled_time 0\n",
+	})
+	defer os.RemoveAll(cpuDir)
+	cpusetDir := newTestCgroupDir(t, nil)
+	defer os.RemoveAll(cpusetDir)
+	handler := newTestRawContainerHandler("/", map[string]string{
+		"cpu":    cpuDir,
+		"cpuset": cpusetDir,
+	})
+	handler.machineInfoFactory = fakeMachineInfoFactory{}
+	handler.fsInfo = &countingFsInfo{}
+
+	report := validateHandler(handler)
+	if !report.Ok() {
+		t.Errorf("expected the validation to succeed: %s", report)
+	}
+	if fmt.Sprint(report.Controllers) != "[cpu cpuset]" {
+		t.Errorf("expected controllers [cpu cpuset], got %v", report.Controllers)
+	}
+	if fmt.Sprint(report.MissingControllers) != "[blkio cpuacct memory]" {
+		t.Errorf("expected missing controllers [blkio cpuacct memory], got %v", report.MissingControllers)
+	}
+	expected := map[string]FileStatus{
+		path.Join(cpuDir, "cpu.shares"):        FileReadable,
+		path.Join(cpuDir, "cpu.cfs_quota_us"):  FileReadable,
+		path.Join(cpuDir, "cpu.cfs_period_us"): FileReadable,
+		path.Join(cpuDir, "cpu.stat"):          FileReadable,
+		path.Join(cpusetDir, "cpuset.cpus"):    FileMissing,
+	}
+	if len(report.Files) != len(expected) {
+		t.Fatalf("expected %d files, got %+v", len(expected), report.Files)
+	}
+	for _, file := range report.Files {
+		if status, ok := expected[file.Path]; !ok || status != file.Status {
+			t.Errorf("expected %q to be %q, got %q", file.Path, status, file.Status)
+		}
+	}
+}
+
+func TestValidateHandlerUnified(t *testing.T) {
+	dir := newTestCgroupDir(t, map[string]string{
+		"cgroup.controllers":    "cpuset cpu io memory\n",
+		"cpu.weight":            "100\n",
+		"cpu.max":               "max 100000\n",
+		"cpu.stat":              "usage_usec 0\nuser_usec 0\nsystem_usec 0\n",
+		"cpuset.cpus":           "0-1\n",
+		"cpuset.cpus.effective": "0-1\n",
+		"memory.current":        "4096\n",
+		"memory.max":            "max\n",
+		"memory.events":         "low 0\nhigh 0\nmax 0\noom 0\noom_kill 0\n",
+		"memory.stat":           "anon 0\nfile 0\n",
+	})
+	defer os.RemoveAll(dir)
+	// The controllers of the unified hierarchy share a single cgroup.
+	handler := newTestRawContainerHandler("/", map[string]string{
+		"cpu":    dir,
+		"cpuset": dir,
+		"memory": dir,
+		"blkio":  dir,
+	})
+	handler.machineInfoFactory = fakeMachineInfoFactory{}
+	handler.fsInfo = &countingFsInfo{}
+
+	report := validateHandler(handler)
+	if fmt.Sprint(report.Controllers) != "[blkio cpu cpuset memory]" {
+		t.Errorf("expected controllers [blkio cpu cpuset memory], got %v", report.Controllers)
+	}
+	if len(report.MissingControllers) != 0 {
+		t.Errorf("expected no missing controllers, got %v", report.MissingControllers)
+	}
+	expected := map[string]FileStatus{
+		path.Join(dir, "cpu.weight"):            FileReadable,
+		path.Join(dir, "cpu.max"):               FileReadable,
+		path.Join(dir, "cpu.stat"):              FileReadable,
+		path.Join(dir, "cpuset.cpus"):           FileReadable,
+		path.Join(dir, "cpuset.cpus.effective"): FileReadable,
+		path.Join(dir, "memory.current"):        FileReadable,
+		path.Join(dir, "memory.max"):            FileReadable,
+		path.Join(dir, "memory.events"):         FileReadable,
+		path.Join(dir, "memory.stat"):           FileReadable,
+		path.Join(dir, "io.stat"):               FileMissing,
+	}
+	if len(report.Files) != len(expected) {
+		t.Fatalf("expected %d files, got %+v", len(expected), report.Files)
+	}
+	for _, file := range report.Files {
+		if status, ok := expected[file.Path]; !ok || status != file.Status {
+			t.Errorf("expected %q to be %q, got %q", file.Path, status, file.Status)
+		}
+	}
+}
+
+func TestFileStatus(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected FileStatus
+	}{
+		{nil, FileReadable},
+		{&os.PathError{Op: "open", Path: "/cgroup/memory.stat", Err: syscall.ENOENT}, FileMissing},
+		{&os.PathError{Op: "open", Path: "/cgroup/memory.stat", Err: syscall.EACCES}, FilePermissionDenied},
+		{&os.PathError{Op: "read", Path: "/cgroup/memory.stat", Err: syscall.EINVAL}, FileUnreadable},
+	}
+	for _, c := range cases {
+		if status := fileStatus(c.err); status != c.expected {
+			t.Errorf("expected status %q for %v, got %q", c.expected, c.err, status)
+		}
+	}
+}
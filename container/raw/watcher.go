@@ -0,0 +1,198 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raw
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"code.google.com/p/go.exp/inotify"
+	"github.com/golang/glog"
+)
+
+// Watcher of filesystem events. Implemented with inotify, replaced in tests to
+// feed synthetic events.
+type fsWatcher interface {
+	// Watches path for the events in flags (e.g. inotify.IN_CREATE).
+	AddWatch(path string, flags uint32) error
+	RemoveWatch(path string) error
+
+	// Channels of the events of the watched paths and of the errors watching
+	// them.
+	Event() <-chan *inotify.Event
+	Error() <-chan error
+
+	Close() error
+}
+
+type inotifyWatcher struct {
+	watcher *inotify.Watcher
+}
+
+func newInotifyWatcher() (fsWatcher, error) {
+	w, err := inotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return &inotifyWatcher{watcher: w}, nil
+}
+
+func (self *inotifyWatcher) AddWatch(path string, flags uint32) error {
+	return self.watcher.AddWatch(path, flags)
+}
+
+func (self *inotifyWatcher) RemoveWatch(path string) error {
+	return self.watcher.RemoveWatch(path)
+}
+
+func (self *inotifyWatcher) Event() <-chan *inotify.Event {
+	return self.watcher.Event
+}
+
+func (self *inotifyWatcher) Error() <-chan error {
+	return self.watcher.Error
+}
+
+func (self *inotifyWatcher) Close() error {
+	return self.watcher.Close()
+}
+
+// Generation of the cgroup mounts, incremented every time the watch of
+// --cgroup_mounts_dir finds that the cgroup hierarchies mounted changed.
+// Handlers refresh their cgroup paths when it is not the last generation they
+// saw.
+var cgroupMountsGeneration uint64
+
+// Number of times the cgroup mounts are read again after a mountpoint was
+// created, and the delay between reads: a hierarchy is mounted some time after
+// its mountpoint is created, which is all inotify reports.
+var (
+	cgroupMountRetries       = 10
+	cgroupMountRetryInterval = time.Second
+)
+
+// Watches dir, under which the cgroup hierarchies are mounted, for new
+// mountpoints and increments cgroupMountsGeneration when the cgroup mounts read
+// afterwards differ from mountPoints. The watch runs in the background until
+// stop is closed and closes watcher.
+func watchCgroupMounts(watcher fsWatcher, dir string, mountPoints map[string]string, stop <-chan struct{}) error {
+	err := watcher.AddWatch(dir, inotify.IN_CREATE|inotify.IN_MOVED_TO)
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer watcher.Close()
+		var retry <-chan time.Time
+		retries := 0
+		for {
+			select {
+			case <-watcher.Event():
+				retries = cgroupMountRetries
+				retry = time.After(0)
+			case err := <-watcher.Error():
+				glog.Warningf("Error while watching %q for cgroup mounts: %v", dir, err)
+			case <-retry:
+				retries--
+				if retries > 0 {
+					retry = time.After(cgroupMountRetryInterval)
+				} else {
+					retry = nil
+				}
+				cgroupSubsystems, err := getCgroupSubsystems()
+				if err != nil {
+					glog.V(3).Infof("Failed to read the cgroup mounts: %v", err)
+					continue
+				}
+				if reflect.DeepEqual(cgroupSubsystems.MountPoints, mountPoints) {
+					continue
+				}
+				glog.Infof("The cgroup hierarchies mounted changed from %v to %v", mountPoints, cgroupSubsystems.MountPoints)
+				mountPoints = cgroupSubsystems.MountPoints
+				atomic.AddUint64(&cgroupMountsGeneration, 1)
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Handlers watching their subcontainers, stopped by Shutdown.
+var (
+	activeWatchers     = make(map[*rawContainerHandler]struct{})
+	activeWatchersLock sync.Mutex
+)
+
+func registerWatcher(handler *rawContainerHandler) {
+	activeWatchersLock.Lock()
+	defer activeWatchersLock.Unlock()
+	activeWatchers[handler] = struct{}{}
+}
+
+func unregisterWatcher(handler *rawContainerHandler) {
+	activeWatchersLock.Lock()
+	defer activeWatchersLock.Unlock()
+	delete(activeWatchers, handler)
+}
+
+// Stops the subcontainer watches of all raw containers and waits for them to
+// exit, for up to timeout. Returns an error naming the containers whose watch
+// did not stop in time.
+func Shutdown(timeout time.Duration) error {
+	activeWatchersLock.Lock()
+	handlers := make([]*rawContainerHandler, 0, len(activeWatchers))
+	for handler := range activeWatchers {
+		handlers = append(handlers, handler)
+	}
+	activeWatchersLock.Unlock()
+
+	type result struct {
+		handler *rawContainerHandler
+		err     error
+	}
+	results := make(chan result, len(handlers))
+	for _, handler := range handlers {
+		go func(handler *rawContainerHandler) {
+			results <- result{handler, handler.StopWatchingSubcontainers()}
+		}(handler)
+	}
+
+	stopped := make(map[*rawContainerHandler]struct{}, len(handlers))
+	var errs []string
+	deadline := time.After(timeout)
+	for len(stopped) < len(handlers) {
+		select {
+		case res := <-results:
+			stopped[res.handler] = struct{}{}
+			if res.err != nil {
+				errs = append(errs, fmt.Sprintf("%q: %v", res.handler.name, res.err))
+			}
+		case <-deadline:
+			for _, handler := range handlers {
+				if _, ok := stopped[handler]; !ok {
+					errs = append(errs, fmt.Sprintf("%q: timed out after %v", handler.name, timeout))
+				}
+			}
+			return fmt.Errorf("failed to stop the watches of containers %v", errs)
+		}
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("failed to stop the watches of containers %v", errs)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package exporter pushes container stats to remote endpoints, for agents
+// that push their stats rather than being scraped.
+package exporter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/cadvisor/info"
+)
+
+// Source of the exported stats, e.g. a container.ContainerHandler.
+type StatsSource interface {
+	GetStats() (*info.ContainerStats, error)
+}
+
+// Body of the requests sent to the remote endpoint, gzipped JSON.
+type StatsBatch struct {
+	Stats []*info.ContainerStats `json:"stats"`
+}
+
+const (
+	// Number of times a batch is sent before keeping it for the next flush.
+	maxSendAttempts = 3
+	// Delay before resending a batch, doubled after every attempt.
+	sendBackoff = 100 * time.Millisecond
+	// Maximum number of snapshots kept while the remote is unavailable. The
+	// oldest are dropped first.
+	maxPendingStats = 1000
+)
+
+// Periodically samples the stats of a source and POSTs them in batches to a
+// remote URL.
+type HttpExporter struct {
+	source         StatsSource
+	url            string
+	client         *http.Client
+	sampleInterval time.Duration
+	flushInterval  time.Duration
+
+	// Snapshots sampled but not sent yet, oldest first.
+	pending []*info.ContainerStats
+	lock    sync.Mutex
+
+	stop chan struct{}
+}
+
+// Creates an exporter sampling the stats of source every sampleInterval and
+// sending the samples to url every flushInterval.
+func NewHttpExporter(source StatsSource, url string, sampleInterval, flushInterval time.Duration) *HttpExporter {
+	return &HttpExporter{
+		source:         source,
+		url:            url,
+		client:         &http.Client{Timeout: flushInterval},
+		sampleInterval: sampleInterval,
+		flushInterval:  flushInterval,
+		stop:           make(chan struct{}),
+	}
+}
+
+// Starts sampling and sending stats in the background. Stats are sent from
+// their own goroutine so that a slow remote does not delay the sampling.
+func (self *HttpExporter) Start() {
+	go func() {
+		ticker := time.NewTicker(self.sampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				err := self.Sample()
+				if err != nil {
+					glog.Warningf("Failed to sample stats for %q: %v", self.url, err)
+				}
+			case <-self.stop:
+				return
+			}
+		}
+	}()
+	go func() {
+		ticker := time.NewTicker(self.flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				err := self.Flush()
+				if err != nil {
+					glog.Warningf("Failed to export stats to %q: %v", self.url, err)
+				}
+			case <-self.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stops the exporter. Pending stats are not sent.
+func (self *HttpExporter) Stop() {
+	close(self.stop)
+}
+
+// Samples the stats of the source, to be sent on the next flush.
+func (self *HttpExporter) Sample() error {
+	stats, err := self.source.GetStats()
+	if err != nil {
+		return err
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.pending = append(self.pending, stats)
+	if len(self.pending) > maxPendingStats {
+		self.pending = self.pending[len(self.pending)-maxPendingStats:]
+	}
+	return nil
+}
+
+// Sends all pending stats. Stats that could not be sent are kept for the next
+// flush.
+func (self *HttpExporter) Flush() error {
+	self.lock.Lock()
+	batch := self.pending
+	self.pending = nil
+	self.lock.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	body, err := encodeBatch(batch)
+	if err != nil {
+		return err
+	}
+	backoff := sendBackoff
+	for attempt := 1; ; attempt++ {
+		err = self.send(body)
+		if err == nil {
+			return nil
+		}
+		if attempt >= maxSendAttempts {
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	// Keep the batch ahead of the stats sampled in the meantime, dropping the
+	// oldest if there are too many.
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.pending = append(batch, self.pending...)
+	if len(self.pending) > maxPendingStats {
+		self.pending = self.pending[len(self.pending)-maxPendingStats:]
+	}
+	return err
+}
+
+func (self *HttpExporter) send(body []byte) error {
+	req, err := http.NewRequest("POST", self.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := self.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("request to %q failed with status %q", self.url, resp.Status)
+	}
+	return nil
+}
+
+// Encodes the stats as gzipped JSON.
+func encodeBatch(stats []*info.ContainerStats) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	err := json.NewEncoder(w).Encode(StatsBatch{stats})
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/info"
+)
+
+type fakeStatsSource struct {
+	memoryUsage uint64
+}
+
+func (self *fakeStatsSource) GetStats() (*info.ContainerStats, error) {
+	stats := &info.ContainerStats{
+		Timestamp: time.Now(),
+	}
+	stats.Memory.Usage = self.memoryUsage
+	return stats, nil
+}
+
+// Counts the samples taken.
+type countingStatsSource struct {
+	samples int32
+}
+
+func (self *countingStatsSource) GetStats() (*info.ContainerStats, error) {
+	atomic.AddInt32(&self.samples, 1)
+	return &info.ContainerStats{Timestamp: time.Now()}, nil
+}
+
+func TestFlush(t *testing.T) {
+	received := make(chan StatsBatch, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("expected a gzipped request, got encoding %q", r.Header.Get("Content-Encoding"))
+		}
+		body, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var batch StatsBatch
+		err = json.NewDecoder(body).Decode(&batch)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		received <- batch
+	}))
+	defer server.Close()
+
+	exporter := NewHttpExporter(&fakeStatsSource{4096}, server.URL, time.Second, time.Second)
+	err := exporter.Sample()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = exporter.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := <-received
+	if len(batch.Stats) != 1 || batch.Stats[0].Memory.Usage != 4096 {
+		t.Errorf("received %+v, expected one snapshot with a memory usage of 4096", batch)
+	}
+	if len(exporter.pending) != 0 {
+		t.Errorf("expected no pending stats after a flush, found %d", len(exporter.pending))
+	}
+}
+
+func TestFlushUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	source := &fakeStatsSource{1024}
+	exporter := NewHttpExporter(source, server.URL, time.Second, time.Second)
+	err := exporter.Sample()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = exporter.Flush()
+	if err == nil {
+		t.Fatalf("flushing to an unavailable remote should fail")
+	}
+
+	// The unsent stats are kept ahead of newer ones.
+	source.memoryUsage = 2048
+	err = exporter.Sample()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exporter.pending) != 2 || exporter.pending[0].Memory.Usage != 1024 || exporter.pending[1].Memory.Usage != 2048 {
+		t.Errorf("expected the unsent and newest stats to be pending, found %+v", exporter.pending)
+	}
+}
+
+func TestSampleDuringSlowFlush(t *testing.T) {
+	requested := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case requested <- struct{}{}:
+		default:
+		}
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	source := &countingStatsSource{}
+	exporter := NewHttpExporter(source, server.URL, 10*time.Millisecond, 50*time.Millisecond)
+	// The flush blocks until the remote answers.
+	exporter.client = &http.Client{}
+	exporter.Start()
+	defer exporter.Stop()
+
+	select {
+	case <-requested:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected the stats to be sent")
+	}
+	samples := atomic.LoadInt32(&source.samples)
+	deadline := time.Now().Add(10 * time.Second)
+	for atomic.LoadInt32(&source.samples) < samples+3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the stats to be sampled while the flush is blocked, sampled %d times", atomic.LoadInt32(&source.samples)-samples)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/cadvisor/utils/oomparser"
+)
+
+const (
+	// Minimum time between two updates of the exemplar of an OOM counter.
+	// Under high OOM rates the counter keeps counting but its exemplar only
+	// changes this often.
+	minExemplarInterval = time.Second
+	// Maximum combined length of the label names and values of an exemplar,
+	// as set by OpenMetrics.
+	maxExemplarLabelsLength = 128
+)
+
+// OOM kills of a container, with the last kill sampled as an exemplar.
+type oomCounter struct {
+	count        uint64
+	exemplar     *oomparser.OomInstance
+	exemplarTime time.Time
+}
+
+// Serves the stats of a source and the OOM kills reported by the OOM parser
+// in the OpenMetrics text format. Every OOM counter carries the killed
+// process of one of its kills as an exemplar.
+type OpenMetricsExporter struct {
+	source    StatsSource
+	oomEvents <-chan *oomparser.OomInstance
+
+	// OOM kills keyed by container name.
+	ooms map[string]*oomCounter
+	lock sync.Mutex
+
+	stop chan struct{}
+}
+
+// Creates an exporter for the stats of source and the OOM kills received on
+// oomEvents.
+func NewOpenMetricsExporter(source StatsSource, oomEvents <-chan *oomparser.OomInstance) *OpenMetricsExporter {
+	return &OpenMetricsExporter{
+		source:    source,
+		oomEvents: oomEvents,
+		ooms:      make(map[string]*oomCounter),
+		stop:      make(chan struct{}),
+	}
+}
+
+// Starts counting the OOM events in the background.
+func (self *OpenMetricsExporter) Start() {
+	go func() {
+		for {
+			select {
+			case oom, ok := <-self.oomEvents:
+				if !ok {
+					return
+				}
+				self.RecordOom(oom)
+			case <-self.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stops counting the OOM events.
+func (self *OpenMetricsExporter) Stop() {
+	close(self.stop)
+}
+
+// Counts an OOM kill of the container of oom. OOMs that ended without a
+// kill are ignored.
+func (self *OpenMetricsExporter) RecordOom(oom *oomparser.OomInstance) {
+	if !oom.Killed {
+		return
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	counter, ok := self.ooms[oom.ContainerName]
+	if !ok {
+		counter = &oomCounter{}
+		self.ooms[oom.ContainerName] = counter
+	}
+	counter.count++
+	now := time.Now()
+	if counter.exemplar == nil || now.Sub(counter.exemplarTime) >= minExemplarInterval {
+		counter.exemplar = oom
+		counter.exemplarTime = now
+	}
+}
+
+func (self *OpenMetricsExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	stats, err := self.source.GetStats()
+	if err != nil {
+		glog.Errorf("Failed to get stats to export: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	fmt.Fprintf(w, "# TYPE container_cpu_usage_seconds counter\n")
+	fmt.Fprintf(w, "# UNIT container_cpu_usage_seconds seconds\n")
+	fmt.Fprintf(w, "container_cpu_usage_seconds_total %s\n", formatFloat(float64(stats.Cpu.Usage.Total)/float64(time.Second)))
+	fmt.Fprintf(w, "# TYPE container_memory_usage_bytes gauge\n")
+	fmt.Fprintf(w, "# UNIT container_memory_usage_bytes bytes\n")
+	fmt.Fprintf(w, "container_memory_usage_bytes %d\n", stats.Memory.Usage)
+	fmt.Fprintf(w, "# TYPE container_memory_working_set_bytes gauge\n")
+	fmt.Fprintf(w, "# UNIT container_memory_working_set_bytes bytes\n")
+	fmt.Fprintf(w, "container_memory_working_set_bytes %d\n", stats.Memory.WorkingSet)
+	self.writeOoms(w)
+	fmt.Fprintf(w, "# EOF\n")
+}
+
+func (self *OpenMetricsExporter) writeOoms(w io.Writer) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	names := make([]string, 0, len(self.ooms))
+	for name := range self.ooms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(w, "# TYPE container_oom_events counter\n")
+	fmt.Fprintf(w, "# HELP container_oom_events Number of OOM kills of processes of the container.\n")
+	for _, name := range names {
+		counter := self.ooms[name]
+		fmt.Fprintf(w, "container_oom_events_total{container=%s} %d", quoteLabelValue(name), counter.count)
+		if counter.exemplar != nil {
+			fmt.Fprintf(w, " # {%s} 1 %s", exemplarLabels(counter.exemplar), formatFloat(float64(counter.exemplarTime.UnixNano())/float64(time.Second)))
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+// Returns the labels of the exemplar of an OOM kill, the pid and name of the
+// killed process. The process name is truncated to fit the length limit of
+// exemplar labels.
+func exemplarLabels(oom *oomparser.OomInstance) string {
+	pid := strconv.Itoa(oom.Pid)
+	name := oom.ProcessName
+	maxNameLength := maxExemplarLabelsLength - len("pid") - len(pid) - len("process_name")
+	if runes := []rune(name); len(runes) > maxNameLength {
+		name = string(runes[:maxNameLength])
+	}
+	return fmt.Sprintf("pid=%s,process_name=%s", quoteLabelValue(pid), quoteLabelValue(name))
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabelValue(value string) string {
+	return `"` + labelValueEscaper.Replace(value) + `"`
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,132 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/utils/oomparser"
+)
+
+func scrape(t *testing.T, exporter *OpenMetricsExporter) string {
+	w := httptest.NewRecorder()
+	exporter.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "application/openmetrics-text") {
+		t.Errorf("unexpected content type %q", w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	if !strings.HasSuffix(body, "# EOF\n") {
+		t.Errorf("exposition should end with # EOF, got %q", body)
+	}
+	checkMetricFamilies(t, body)
+	return body
+}
+
+// Checks that every family is declared once, before its samples, and that
+// every sample belongs to the family declared last.
+func checkMetricFamilies(t *testing.T, body string) {
+	families := make(map[string]bool)
+	family, familyType := "", ""
+	for _, line := range strings.Split(strings.TrimSuffix(body, "\n"), "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case line == "# EOF":
+		case strings.HasPrefix(line, "# TYPE "):
+			if len(fields) != 4 {
+				t.Errorf("malformed type line %q", line)
+				continue
+			}
+			if families[fields[2]] {
+				t.Errorf("family %q is declared twice in %q", fields[2], body)
+			}
+			families[fields[2]] = true
+			family, familyType = fields[2], fields[3]
+		case strings.HasPrefix(line, "# UNIT "), strings.HasPrefix(line, "# HELP "):
+			if len(fields) < 3 || fields[2] != family {
+				t.Errorf("metadata line %q does not describe the current family %q", line, family)
+			}
+		default:
+			name := fields[0]
+			if i := strings.Index(name, "{"); i >= 0 {
+				name = name[:i]
+			}
+			if name != family && !(familyType == "counter" && name == family+"_total") {
+				t.Errorf("sample %q does not belong to the current family %q", line, family)
+			}
+		}
+	}
+}
+
+func TestMemoryFamilies(t *testing.T) {
+	exporter := NewOpenMetricsExporter(&fakeStatsSource{memoryUsage: 1024}, nil)
+	body := scrape(t, exporter)
+	for _, family := range []string{"container_memory_usage_bytes", "container_memory_working_set_bytes"} {
+		if !strings.Contains(body, "# TYPE "+family+" gauge\n# UNIT "+family+" bytes\n"+family+" ") {
+			t.Errorf("expected family %q with its type and unit, got %q", family, body)
+		}
+	}
+}
+
+func TestOomExemplar(t *testing.T) {
+	oomEvents := make(chan *oomparser.OomInstance)
+	exporter := NewOpenMetricsExporter(&fakeStatsSource{memoryUsage: 1024}, oomEvents)
+	exporter.Start()
+	defer exporter.Stop()
+
+	if body := scrape(t, exporter); strings.Contains(body, "container_oom_events_total{") {
+		t.Errorf("expected no OOM events before a kill, got %q", body)
+	}
+
+	oomEvents <- &oomparser.OomInstance{
+		Pid:           31057,
+		ProcessName:   "stress",
+		ContainerName: "/test",
+		Killed:        true,
+	}
+	expected := regexp.MustCompile(`(?m)^container_oom_events_total\{container="/test"\} 1 # \{pid="31057",process_name="stress"\} 1 [0-9.]+$`)
+	deadline := time.Now().Add(10 * time.Second)
+	for body := scrape(t, exporter); !expected.MatchString(body); body = scrape(t, exporter) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected an OOM event with an exemplar, got %q", body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOomExemplarRateCapped(t *testing.T) {
+	exporter := NewOpenMetricsExporter(&fakeStatsSource{}, nil)
+	exporter.RecordOom(&oomparser.OomInstance{Pid: 1, ProcessName: "first", ContainerName: "/test", Killed: true})
+	exporter.RecordOom(&oomparser.OomInstance{Pid: 2, ProcessName: "second", ContainerName: "/test", Killed: true})
+	// An OOM that ended without a kill is not counted.
+	exporter.RecordOom(&oomparser.OomInstance{ContainerName: "/test"})
+
+	body := scrape(t, exporter)
+	if !strings.Contains(body, `container_oom_events_total{container="/test"} 2 # {pid="1",process_name="first"}`) {
+		t.Errorf("expected both kills counted with the first as exemplar, got %q", body)
+	}
+}
+
+func TestExemplarLabelsLength(t *testing.T) {
+	labels := exemplarLabels(&oomparser.OomInstance{Pid: 123, ProcessName: strings.Repeat("x", 200)})
+	// Without the quotes, equal signs and separator.
+	length := len(labels) - len(`="",=""`)
+	if length > maxExemplarLabelsLength {
+		t.Errorf("exemplar labels are %d characters long, more than %d", length, maxExemplarLabelsLength)
+	}
+}
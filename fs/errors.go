@@ -0,0 +1,83 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Error returned by FsInfo. Temporary errors are caused by a mount or device
+// being unavailable for a while (e.g. it is being mounted or unmounted, or a
+// network filesystem is not responding) and may go away on retry. All others
+// are permanent, usually caused by a misconfiguration.
+type FsError struct {
+	Err       error
+	temporary bool
+}
+
+func (self *FsError) Error() string {
+	return self.Err.Error()
+}
+
+// Whether retrying the failed operation may succeed.
+func (self *FsError) Temporary() bool {
+	return self.temporary
+}
+
+// Returns whether err is a temporary FsInfo error.
+func IsTemporary(err error) bool {
+	fsErr, ok := err.(*FsError)
+	return ok && fsErr.Temporary()
+}
+
+// Errnos caused by a mount or device being temporarily unavailable.
+var temporaryErrnos = map[syscall.Errno]struct{}{
+	syscall.ENOENT:    {},
+	syscall.ESTALE:    {},
+	syscall.EAGAIN:    {},
+	syscall.EINTR:     {},
+	syscall.EBUSY:     {},
+	syscall.ETIMEDOUT: {},
+	syscall.ENOTCONN:  {},
+}
+
+// Returns whether the errno underlying err is caused by a temporarily
+// unavailable mount or device.
+func isTemporaryErrno(err error) bool {
+	switch e := err.(type) {
+	case *os.PathError:
+		err = e.Err
+	case *os.SyscallError:
+		err = e.Err
+	}
+	errno, ok := err.(syscall.Errno)
+	if !ok {
+		return false
+	}
+	_, ok = temporaryErrnos[errno]
+	return ok
+}
+
+// Wraps err in an FsError, classifying it by its underlying errno.
+func NewFsError(err error) *FsError {
+	return &FsError{Err: err, temporary: isTemporaryErrno(err)}
+}
+
+// Creates a permanent FsError with the specified message.
+func newPermanentFsError(format string, args ...interface{}) *FsError {
+	return &FsError{Err: fmt.Errorf(format, args...)}
+}
@@ -25,11 +25,13 @@ import "C"
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"os"
 	"os/exec"
 	"path"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -41,6 +43,8 @@ import (
 
 var partitionRegex = regexp.MustCompile("(:?s|xv)d[a-z]+\\d")
 
+var globalFsMountpoints = flag.String("global_fs_mountpoints", "", "Comma-separated list of mountpoints to report the filesystems of, along with the filesystems mounted under them. All filesystems are reported if empty")
+
 type partition struct {
 	mountpoint string
 	major      uint
@@ -48,7 +52,10 @@ type partition struct {
 }
 
 type RealFsInfo struct {
+	// Partitions keyed by device, with the first mountpoint of the device.
 	partitions map[string]partition
+	// Devices of the partitions keyed by mountpoint, including bind mounts.
+	mounts map[string]string
 }
 
 func NewFsInfo() (FsInfo, error) {
@@ -57,10 +64,12 @@ func NewFsInfo() (FsInfo, error) {
 		return nil, err
 	}
 	partitions := make(map[string]partition, 0)
+	mountpoints := make(map[string]string, 0)
 	for _, mount := range mounts {
 		if !strings.HasPrefix(mount.Fstype, "ext") {
 			continue
 		}
+		mountpoints[mount.Mountpoint] = mount.Source
 		// Avoid bind mounts.
 		if _, ok := partitions[mount.Source]; ok {
 			continue
@@ -68,38 +77,56 @@ func NewFsInfo() (FsInfo, error) {
 		partitions[mount.Source] = partition{mount.Mountpoint, uint(mount.Major), uint(mount.Minor)}
 	}
 	glog.Infof("Filesystem partitions: %+v", partitions)
-	return &RealFsInfo{partitions}, nil
+	return &RealFsInfo{partitions, mountpoints}, nil
 }
 
 func (self *RealFsInfo) GetFsInfoForPath(mountSet map[string]struct{}) ([]Fs, error) {
 	filesystems := make([]Fs, 0)
-	deviceSet := make(map[string]struct{})
 	diskStatsMap, err := getDiskStatsMap("/proc/diskstats")
 	if err != nil {
-		return nil, err
+		return nil, NewFsError(err)
 	}
-	for device, partition := range self.partitions {
-		_, hasMount := mountSet[partition.mountpoint]
-		_, hasDevice := deviceSet[device]
-		if mountSet == nil || (hasMount && !hasDevice) {
-			total, free, err := getVfsStats(partition.mountpoint)
-			if err != nil {
-				glog.Errorf("Statvfs failed. Error: %v", err)
-			} else {
-				deviceSet[device] = struct{}{}
-				deviceInfo := DeviceInfo{
-					Device: device,
-					Major:  uint(partition.major),
-					Minor:  uint(partition.minor),
-				}
-				fs := Fs{deviceInfo, total, free, diskStatsMap[device]}
-				filesystems = append(filesystems, fs)
-			}
+	mountpoints := make([]string, 0, len(self.mounts))
+	for mountpoint := range self.mounts {
+		if _, hasMount := mountSet[mountpoint]; mountSet == nil || hasMount {
+			mountpoints = append(mountpoints, mountpoint)
 		}
 	}
+	sort.Strings(mountpoints)
+	for _, mountpoint := range mountpoints {
+		device := self.mounts[mountpoint]
+		partition := self.partitions[device]
+		total, free, err := getVfsStats(mountpoint)
+		if err != nil {
+			glog.Errorf("Statvfs failed. Error: %v", err)
+			continue
+		}
+		deviceInfo := DeviceInfo{
+			Device: device,
+			Major:  uint(partition.major),
+			Minor:  uint(partition.minor),
+		}
+		fs := Fs{deviceInfo, mountpoint, total, free, diskStatsMap[device]}
+		filesystems = append(filesystems, fs)
+	}
 	return filesystems, nil
 }
 
+// Keeps the first filesystem of every device, for when a device mounted at
+// several mountpoints should only be counted once.
+func DedupeByDevice(filesystems []Fs) []Fs {
+	deviceSet := make(map[string]struct{}, len(filesystems))
+	ret := make([]Fs, 0, len(filesystems))
+	for _, fs := range filesystems {
+		if _, ok := deviceSet[fs.Device]; ok {
+			continue
+		}
+		deviceSet[fs.Device] = struct{}{}
+		ret = append(ret, fs)
+	}
+	return ret
+}
+
 func getDiskStatsMap(diskStatsFile string) (map[string]DiskStats, error) {
 	diskStatsMap := make(map[string]DiskStats)
 	file, err := os.Open(diskStatsFile)
@@ -153,8 +180,27 @@ func getDiskStatsMap(diskStatsFile string) (map[string]DiskStats, error) {
 	return diskStatsMap, nil
 }
 
+// Keeps the filesystems mounted at or under one of mountpoints.
+func FilterByMountpoint(filesystems []Fs, mountpoints []string) []Fs {
+	ret := make([]Fs, 0, len(filesystems))
+	for _, fs := range filesystems {
+		for _, mountpoint := range mountpoints {
+			mountpoint = path.Clean(mountpoint)
+			if fs.Mountpoint == mountpoint || strings.HasPrefix(fs.Mountpoint, strings.TrimSuffix(mountpoint, "/")+"/") {
+				ret = append(ret, fs)
+				break
+			}
+		}
+	}
+	return ret
+}
+
 func (self *RealFsInfo) GetGlobalFsInfo() ([]Fs, error) {
-	return self.GetFsInfoForPath(nil)
+	filesystems, err := self.GetFsInfoForPath(nil)
+	if err != nil || *globalFsMountpoints == "" {
+		return filesystems, err
+	}
+	return FilterByMountpoint(filesystems, strings.Split(*globalFsMountpoints, ",")), nil
 }
 
 func major(devNumber uint64) uint {
@@ -169,7 +215,10 @@ func (self *RealFsInfo) GetDirFsDevice(dir string) (*DeviceInfo, error) {
 	var buf syscall.Stat_t
 	err := syscall.Stat(dir, &buf)
 	if err != nil {
-		return nil, fmt.Errorf("stat failed on %s with error: %s", dir, err)
+		return nil, &FsError{
+			Err:       fmt.Errorf("stat failed on %s with error: %s", dir, err),
+			temporary: isTemporaryErrno(err),
+		}
 	}
 	major := major(buf.Dev)
 	minor := minor(buf.Dev)
@@ -178,17 +227,21 @@ func (self *RealFsInfo) GetDirFsDevice(dir string) (*DeviceInfo, error) {
 			return &DeviceInfo{device, major, minor}, nil
 		}
 	}
-	return nil, fmt.Errorf("could not find device with major: %d, minor: %d in cached partitions map", major, minor)
+	return nil, newPermanentFsError("could not find device with major: %d, minor: %d in cached partitions map", major, minor)
 }
 
 func (self *RealFsInfo) GetDirUsage(dir string) (uint64, error) {
 	out, err := exec.Command("du", "-s", dir).CombinedOutput()
 	if err != nil {
-		return 0, fmt.Errorf("du command failed on %s with output %s - %s", dir, out, err)
+		// du fails when files are removed while it runs, so this is likely to go away.
+		return 0, &FsError{
+			Err:       fmt.Errorf("du command failed on %s with output %s - %s", dir, out, err),
+			temporary: true,
+		}
 	}
 	usageInKb, err := strconv.ParseUint(strings.Fields(string(out))[0], 10, 64)
 	if err != nil {
-		return 0, fmt.Errorf("cannot parse 'du' output %s - %s", out, err)
+		return 0, newPermanentFsError("cannot parse 'du' output %s - %s", out, err)
 	}
 	return usageInKb * 1024, nil
 }
@@ -15,6 +15,10 @@
 package fs
 
 import (
+	"fmt"
+	"os"
+	"reflect"
+	"syscall"
 	"testing"
 )
 
@@ -66,3 +70,56 @@ func TestFileNotExist(t *testing.T) {
 		t.Fatalf("getDiskStatsMap must not error for absent file: %s", err)
 	}
 }
+
+func TestIsTemporary(t *testing.T) {
+	testCases := []struct {
+		err       error
+		temporary bool
+	}{
+		{NewFsError(&os.PathError{Op: "open", Path: "/mnt/data", Err: syscall.ENOENT}), true},
+		{NewFsError(&os.PathError{Op: "open", Path: "/mnt/nfs", Err: syscall.ESTALE}), true},
+		{NewFsError(&os.PathError{Op: "open", Path: "/mnt/data", Err: syscall.EACCES}), false},
+		{NewFsError(fmt.Errorf("could not parse all 11 columns of /proc/diskstats")), false},
+		{newPermanentFsError("could not find device"), false},
+		{syscall.ENOENT, false},
+	}
+	for _, tc := range testCases {
+		if IsTemporary(tc.err) != tc.temporary {
+			t.Errorf("expected IsTemporary(%v) to be %v", tc.err, tc.temporary)
+		}
+	}
+}
+
+func TestDedupeByDevice(t *testing.T) {
+	filesystems := []Fs{
+		{DeviceInfo: DeviceInfo{Device: "/dev/sda1"}, Mountpoint: "/"},
+		{DeviceInfo: DeviceInfo{Device: "/dev/sdb1"}, Mountpoint: "/data"},
+		{DeviceInfo: DeviceInfo{Device: "/dev/sda1"}, Mountpoint: "/var/lib/docker"},
+	}
+	deduped := DedupeByDevice(filesystems)
+	if len(deduped) != 2 || deduped[0].Mountpoint != "/" || deduped[1].Mountpoint != "/data" {
+		t.Errorf("expected the first mountpoint of each device, got %+v", deduped)
+	}
+}
+
+func TestFilterByMountpoint(t *testing.T) {
+	filesystems := []Fs{
+		{Mountpoint: "/"},
+		{Mountpoint: "/data"},
+		{Mountpoint: "/data/backup"},
+		{Mountpoint: "/database"},
+		{Mountpoint: "/var/lib/docker"},
+	}
+	filtered := FilterByMountpoint(filesystems, []string{"/data/", "/var/lib/docker"})
+	mountpoints := make([]string, 0, len(filtered))
+	for _, fs := range filtered {
+		mountpoints = append(mountpoints, fs.Mountpoint)
+	}
+	expected := []string{"/data", "/data/backup", "/var/lib/docker"}
+	if !reflect.DeepEqual(mountpoints, expected) {
+		t.Errorf("expected mountpoints %v, got %v", expected, mountpoints)
+	}
+	if filtered := FilterByMountpoint(filesystems, []string{"/"}); len(filtered) != len(filesystems) {
+		t.Errorf("expected all filesystems to be under /, got %+v", filtered)
+	}
+}
@@ -22,9 +22,12 @@ type DeviceInfo struct {
 
 type Fs struct {
 	DeviceInfo
-	Capacity  uint64
-	Free      uint64
-	DiskStats DiskStats
+	// Where the filesystem is mounted. A device mounted at several
+	// mountpoints is reported once per mountpoint.
+	Mountpoint string
+	Capacity   uint64
+	Free       uint64
+	DiskStats  DiskStats
 }
 
 type DiskStats struct {
@@ -42,7 +45,7 @@ type DiskStats struct {
 }
 
 type FsInfo interface {
-	// Returns capacity and free space, in bytes, of all the ext2, ext3, ext4 filesystems on the host.
+	// Returns capacity and free space, in bytes, of all the ext2, ext3, ext4 filesystems on the host, once per mountpoint.
 	GetGlobalFsInfo() ([]Fs, error)
 
 	// Returns capacity and free space, in bytes, of the set of mounts passed.
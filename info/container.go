@@ -16,6 +16,7 @@ package info
 
 import (
 	"reflect"
+	"strings"
 	"time"
 )
 
@@ -23,6 +24,43 @@ type CpuSpec struct {
 	Limit    uint64 `json:"limit"`
 	MaxLimit uint64 `json:"max_limit"`
 	Mask     string `json:"mask,omitempty"`
+
+	// Cpus of Mask that are online, which the container can actually run on.
+	// Empty when none of them is online.
+	EffectiveMask string `json:"effective_mask,omitempty"`
+
+	// Whether the cpus and memory nodes of the cpuset of the container are
+	// exclusive, i.e. not shared with its siblings.
+	CpuExclusive bool `json:"cpu_exclusive,omitempty"`
+	MemExclusive bool `json:"mem_exclusive,omitempty"`
+
+	// Cpu shares of the container relative to the default of 1024 shares
+	// (e.g. 2.0 for 2048 shares). The cpu.weight of the unified (v2)
+	// hierarchy is converted to shares as runc converts shares to weights,
+	// so a container configured in shares has the same relative weight on
+	// both. The default weight of 100 converts to about 2.54.
+	RelativeWeight float64 `json:"relative_weight,omitempty"`
+
+	// CFS bandwidth control of the container: the container may run for
+	// Quota every Period, and for up to Burst more when it accumulated unused
+	// quota. Quota is unlimited (-1) when not set.
+	// Units: microseconds.
+	Quota  uint64 `json:"quota,omitempty"`
+	Period uint64 `json:"period,omitempty"`
+	Burst  uint64 `json:"burst,omitempty"`
+
+	// Utilization clamping of the container. Not set when the kernel does
+	// not support it.
+	Uclamp *UclampSpec `json:"uclamp,omitempty"`
+}
+
+type UclampSpec struct {
+	// Minimum utilization the scheduler assumes for the tasks of the
+	// container, as a percentage (0-100).
+	Min float64 `json:"min"`
+	// Maximum utilization the scheduler assumes for the tasks of the
+	// container, as a percentage (0-100). Unclamped is 100.
+	Max float64 `json:"max"`
 }
 
 type MemorySpec struct {
@@ -37,6 +75,60 @@ type MemorySpec struct {
 	// The amount of swap space requested. Default is unlimited (-1).
 	// Units: bytes.
 	SwapLimit uint64 `json:"swap_limit,omitempty"`
+
+	// Memory usage below which the container is protected from reclaim
+	// (memory.low). Only set on the unified (v2) hierarchy, "max" is -1.
+	// Units: bytes.
+	Low uint64 `json:"low,omitempty"`
+
+	// Memory usage above which the container is throttled and reclaimed
+	// (memory.high). Only set on the unified (v2) hierarchy, "max" is -1.
+	// Units: bytes.
+	High uint64 `json:"high,omitempty"`
+
+	// Whether all the processes of the container are killed together when
+	// one of them is OOM killed (memory.oom.group). Only set on the unified
+	// (v2) hierarchy.
+	OomGroup bool `json:"oom_group,omitempty"`
+}
+
+type DiskIoSpec struct {
+	// Throttle limits of the container keyed by device name (e.g. "sda"),
+	// from blkio.throttle.* or io.max on the unified (v2) hierarchy. Only
+	// devices with a limit are present.
+	// Units: bytes per second.
+	ReadBpsDevice  map[string]uint64 `json:"read_bps_device,omitempty"`
+	WriteBpsDevice map[string]uint64 `json:"write_bps_device,omitempty"`
+	// Units: operations per second.
+	ReadIopsDevice  map[string]uint64 `json:"read_iops_device,omitempty"`
+	WriteIopsDevice map[string]uint64 `json:"write_iops_device,omitempty"`
+
+	// Target latency protected by the io.latency controller (unified (v2)
+	// hierarchy) keyed by device name. Only devices with a target are present.
+	// Units: microseconds.
+	LatencyTarget map[string]uint64 `json:"latency_target,omitempty"`
+
+	// Quality of service of the io.cost controller (unified (v2) hierarchy)
+	// keyed by device name. Only set on the root container.
+	CostQos map[string]IoCostQos `json:"cost_qos,omitempty"`
+}
+
+type IoCostQos struct {
+	Enabled bool `json:"enabled"`
+	// Whether the parameters are set by the user or by the kernel ("user" or
+	// "auto").
+	Ctrl string `json:"ctrl"`
+	// The device is considered saturated when the ReadLatencyPercentile
+	// percentile of read latencies exceeds ReadLatency, or similarly for
+	// writes.
+	// Units: microseconds.
+	ReadLatencyPercentile  float64 `json:"read_latency_percentile"`
+	ReadLatency            uint64  `json:"read_latency"`
+	WriteLatencyPercentile float64 `json:"write_latency_percentile"`
+	WriteLatency           uint64  `json:"write_latency"`
+	// Range the virtual rate of the device is scaled within, as a percentage.
+	MinVrate float64 `json:"min_vrate"`
+	MaxVrate float64 `json:"max_vrate"`
 }
 
 type ContainerSpec struct {
@@ -51,7 +143,100 @@ type ContainerSpec struct {
 	HasFilesystem bool `json:"has_filesystem"`
 
 	// HasDiskIo when true, indicates that DiskIo stats will be available.
-	HasDiskIo bool `json:"has_diskio"`
+	HasDiskIo bool       `json:"has_diskio"`
+	DiskIo    DiskIoSpec `json:"diskio,omitempty"`
+
+	// HasRdma when true, indicates that Rdma stats will be available.
+	HasRdma bool `json:"has_rdma"`
+
+	// HasMisc when true, indicates that the stats of the misc controller
+	// (e.g. SEV ASIDs) will be available.
+	HasMisc bool `json:"has_misc"`
+
+	// HasPerfEvent when true, indicates that the container is in a cgroup of
+	// the perf_event hierarchy, so perf counters can be attached to it.
+	HasPerfEvent bool `json:"has_perf_event"`
+
+	// Type of the cgroup on the unified (v2) hierarchy: "domain", "domain
+	// threaded", "domain invalid" or "threaded". Empty on v1 hierarchies.
+	// Threaded cgroups only contain threads of processes in their domain.
+	CgroupType string `json:"cgroup_type,omitempty"`
+
+	// Cgroup controllers enabled for the container (e.g. "cpu", "memory"),
+	// sorted. Only the stats of these resources are meaningful.
+	EnabledControllers []string `json:"enabled_controllers,omitempty"`
+
+	// Root mount of the processes of the container, nil when it has no
+	// processes.
+	Rootfs *RootfsSpec `json:"rootfs,omitempty"`
+
+	// Init process of the container, its process with the lowest pid. Nil
+	// when it has no processes.
+	Init *ProcessSpec `json:"init,omitempty"`
+
+	// Devices the container may access, from devices.list of the devices
+	// cgroup (v1 only).
+	Devices []DeviceRule `json:"devices,omitempty"`
+}
+
+// Wildcard major or minor number of a device rule.
+const DeviceWildcard = -1
+
+type DeviceRule struct {
+	// Device type: "a" (all), "b" (block) or "c" (character).
+	Type string `json:"type"`
+
+	// Major and minor numbers of the device, DeviceWildcard for any.
+	Major int64 `json:"major"`
+	Minor int64 `json:"minor"`
+
+	// Allowed access: any of "r" (read), "w" (write) and "m" (mknod).
+	Access string `json:"access"`
+}
+
+type ProcessSpec struct {
+	Pid int `json:"pid"`
+
+	// Command line of the process, one element per argument.
+	Command []string `json:"command,omitempty"`
+
+	// When the process started.
+	StartTime time.Time `json:"start_time"`
+
+	// Limits on the number of files the process can open, nil if unknown.
+	OpenFilesLimit *RlimitSpec `json:"open_files_limit,omitempty"`
+}
+
+// Soft and hard limits of a resource of a process. Unlimited limits are the
+// maximum uint64 value.
+type RlimitSpec struct {
+	Soft uint64 `json:"soft"`
+	Hard uint64 `json:"hard"`
+}
+
+// Propagation of mount events between a mount and its peers.
+const (
+	// Mount events propagate to and from the peers.
+	MountPropagationShared = "shared"
+	// Mount events propagate from the master only.
+	MountPropagationSlave = "slave"
+	// Mount events do not propagate.
+	MountPropagationPrivate = "private"
+	// Private and cannot be bind mounted.
+	MountPropagationUnbindable = "unbindable"
+)
+
+type RootfsSpec struct {
+	// Whether the processes of the container have their own mount namespace.
+	// ReadOnly and Propagation are not applicable when they share the mount
+	// namespace of the host and are left empty.
+	HasMountNamespace bool `json:"has_mount_namespace"`
+
+	// Whether the root mount is read-only.
+	ReadOnly bool `json:"read_only"`
+
+	// Propagation of the root mount, one of the MountPropagation constants.
+	Propagation string `json:"propagation,omitempty"`
 }
 
 // Container reference contains enough information to uniquely identify a container
@@ -66,6 +251,57 @@ type ContainerReference struct {
 	// Namespace under which the aliases of a container are unique.
 	// An example of a namespace is "docker" for Docker containers.
 	Namespace string `json:"namespace,omitempty"`
+
+	// The runtime running the container (e.g. docker, containerd or cri-o)
+	// and the image it was created from, when known.
+	Runtime string `json:"runtime,omitempty"`
+	Image   string `json:"image,omitempty"`
+}
+
+// Returns the components of the name of the container from the top-level
+// container down to the container itself (e.g. ["docker", "abc"] for
+// "/docker/abc"). The root container has none. A slash escaped with a
+// backslash is part of a component and is not a separator.
+func (self *ContainerReference) Ancestry() []string {
+	var components []string
+	var component []byte
+	escaped := false
+	for i := 0; i < len(self.Name); i++ {
+		c := self.Name[i]
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '/':
+			if len(component) != 0 {
+				components = append(components, string(component))
+				component = component[:0]
+			}
+			continue
+		}
+		component = append(component, c)
+	}
+	if len(component) != 0 {
+		components = append(components, string(component))
+	}
+	return components
+}
+
+// Returns the number of levels of the container below the root container,
+// which has depth 0.
+func (self *ContainerReference) Depth() int {
+	return len(self.Ancestry())
+}
+
+// Returns the name of the parent of the container, which is empty for the
+// root container.
+func (self *ContainerReference) Parent() string {
+	ancestry := self.Ancestry()
+	if len(ancestry) == 0 {
+		return ""
+	}
+	return "/" + strings.Join(ancestry[:len(ancestry)-1], "/")
 }
 
 // ContainerInfoQuery is used when users check a container info from the REST api.
@@ -196,12 +432,37 @@ type CpuStats struct {
 		// Time spent in kernel space.
 		// Unit: nanoseconds
 		System uint64 `json:"system"`
+
+		// Time the hypervisor ran other virtual machines while the cpus
+		// had work (steal), and time spent running guest virtual machines,
+		// which is also counted as user time (guest). Only reported for the
+		// root container, from /proc/stat.
+		// Unit: nanoseconds
+		Steal uint64 `json:"steal,omitempty"`
+		Guest uint64 `json:"guest,omitempty"`
 	} `json:"usage"`
 	// Smoothed average of number of runnable threads x 1000.
 	// We multiply by thousand to avoid using floats, but preserving precision.
 	// Load is smoothed over the last 10 seconds. Instantaneous value can be read
 	// from LoadStats.NrRunning.
 	LoadAverage int32 `json:"load_average"`
+
+	// Time the threads of the container currently alive spent runnable but
+	// waiting for a cpu, summed across threads. Only reported with
+	// --sched_wait_time. It goes backwards when threads exit.
+	// Unit: nanoseconds
+	SchedWaitTime uint64 `json:"sched_wait_time,omitempty"`
+
+	// Time the container was throttled by the CFS bandwidth control because
+	// it used up its quota.
+	// Unit: nanoseconds
+	ThrottledTime uint64 `json:"throttled_time,omitempty"`
+
+	// Approximation of the time the container wanted a cpu but did not get
+	// one: ThrottledTime + SchedWaitTime. Without --sched_wait_time it is the
+	// throttled time alone. It goes backwards when threads exit.
+	// Unit: nanoseconds
+	ContentionTime uint64 `json:"contention_time,omitempty"`
 }
 
 type PerDiskStats struct {
@@ -215,10 +476,45 @@ type DiskIoStats struct {
 	IoServiced     []PerDiskStats `json:"io_serviced,omitempty"`
 	IoQueued       []PerDiskStats `json:"io_queued,omitempty"`
 	Sectors        []PerDiskStats `json:"sectors,omitempty"`
-	IoServiceTime  []PerDiskStats `json:"io_service_time,omitempty"`
-	IoWaitTime     []PerDiskStats `json:"io_wait_time,omitempty"`
-	IoMerged       []PerDiskStats `json:"io_merged,omitempty"`
-	IoTime         []PerDiskStats `json:"io_time,omitempty"`
+
+	// Time spent servicing and waiting for IOs per device, keyed by operation
+	// (Read, Write, Sync, Async).
+	// Units: nanoseconds.
+	IoServiceTime []PerDiskStats `json:"io_service_time,omitempty"`
+	IoWaitTime    []PerDiskStats `json:"io_wait_time,omitempty"`
+
+	IoMerged []PerDiskStats `json:"io_merged,omitempty"`
+	IoTime   []PerDiskStats `json:"io_time,omitempty"`
+
+	// Usage and wait of the io.cost controller (unified (v2) hierarchy) per
+	// device, keyed by "usage", "wait" and "indebt".
+	// Units: microseconds.
+	IoCost []PerDiskStats `json:"io_cost,omitempty"`
+
+	// Time the tasks of the container were stalled waiting for IO, from
+	// io.pressure (unified (v2) hierarchy). Nil when the kernel does not
+	// report pressure stall information.
+	Pressure *PressureStats `json:"pressure,omitempty"`
+}
+
+// Pressure stall information (PSI) of a resource.
+type PressureStats struct {
+	// Time some of the tasks were stalled on the resource.
+	Some PressureData `json:"some"`
+
+	// Time all of the tasks were stalled on the resource at once.
+	Full PressureData `json:"full"`
+}
+
+type PressureData struct {
+	// Percentage of the time stalled over the last 10, 60 and 300 seconds.
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+
+	// Cumulative time stalled.
+	// Units: microseconds.
+	Total uint64 `json:"total"`
 }
 
 type MemoryStats struct {
@@ -232,15 +528,129 @@ type MemoryStats struct {
 	// Units: Bytes.
 	WorkingSet uint64 `json:"working_set"`
 
+	// Shared memory (shmem and tmpfs) charged to the container, included in
+	// the usage. Zero when the kernel does not report it.
+	// Units: Bytes.
+	Shmem uint64 `json:"shmem,omitempty"`
+
+	// Anonymous memory plus page cache, without the shared memory. Closer to
+	// the memory used by the processes than the usage when files in tmpfs
+	// are charged to the container.
+	// Units: Bytes.
+	UsageWithoutShmem uint64 `json:"usage_without_shmem,omitempty"`
+
+	// Estimate of the memory the kernel can take back from the container
+	// under pressure, the inactive page cache and the reclaimable slab, and of
+	// the rest of the usage, which is the real footprint of the container.
+	// Both are zero when memory.stat does not report the inactive page cache.
+	// Units: Bytes.
+	ReclaimableMemory   uint64 `json:"reclaimable_memory,omitempty"`
+	UnreclaimableMemory uint64 `json:"unreclaimable_memory,omitempty"`
+
+	// Whether usage is above the high watermark (memory.high) of the
+	// container, where it is throttled and reclaimed.
+	OverHigh bool `json:"over_high,omitempty"`
+
+	// Cumulative reclaim activity of the container. Only reported by kernels
+	// exposing pgscan and pgsteal in memory.stat.
+	Reclaim MemoryReclaimStats `json:"reclaim,omitempty"`
+
+	// Kernel slab memory charged to the container, which includes the dentry
+	// and inode caches. Only reported on the unified (v2) hierarchy.
+	Slab MemorySlabStats `json:"slab,omitempty"`
+
+	// Cumulative refaults of evicted pages of the container, which tell
+	// whether it is thrashing. Only reported by kernels exposing the
+	// workingset counters in memory.stat.
+	Refault MemoryRefaultStats `json:"refault,omitempty"`
+
+	// Cumulative memory events of the container and its subcontainers. Only
+	// reported on the unified (v2) hierarchy.
+	Events MemoryEventsStats `json:"events,omitempty"`
+
 	ContainerData    MemoryStatsMemoryData `json:"container_data,omitempty"`
 	HierarchicalData MemoryStatsMemoryData `json:"hierarchical_data,omitempty"`
 }
 
+type MemoryReclaimStats struct {
+	// Number of pages scanned for reclaim, by kswapd in the background and
+	// directly by allocating tasks. Pgscan is the sum of both.
+	Pgscan       uint64 `json:"pgscan"`
+	PgscanKswapd uint64 `json:"pgscan_kswapd"`
+	PgscanDirect uint64 `json:"pgscan_direct"`
+
+	// Number of pages reclaimed, by kswapd in the background and directly by
+	// allocating tasks. Pgsteal is the sum of both.
+	Pgsteal       uint64 `json:"pgsteal"`
+	PgstealKswapd uint64 `json:"pgsteal_kswapd"`
+	PgstealDirect uint64 `json:"pgsteal_direct"`
+}
+
+type MemorySlabStats struct {
+	// Slab memory that can be reclaimed under pressure, such as the dentry
+	// and inode caches, and that cannot.
+	// Units: Bytes.
+	Reclaimable   uint64 `json:"reclaimable"`
+	Unreclaimable uint64 `json:"unreclaimable"`
+}
+
+type MemoryRefaultStats struct {
+	// Number of evicted anonymous and page cache pages faulted in again.
+	// Kernels before 5.9 only report a total, which is reported as the page
+	// cache refaults since anonymous pages were not tracked.
+	Anon uint64 `json:"anon"`
+	File uint64 `json:"file"`
+
+	// Number of refaulted anonymous and page cache pages that were
+	// immediately activated, because they were evicted while still in use.
+	// A high rate of activations means the container is thrashing rather
+	// than reusing old pages.
+	ActivateAnon uint64 `json:"activate_anon"`
+	ActivateFile uint64 `json:"activate_file"`
+}
+
+type MemoryEventsStats struct {
+	// Number of times usage went below memory.low while the container was
+	// reclaimed anyway, because of high pressure.
+	Low uint64 `json:"low"`
+	// Number of times usage went above memory.high and the container was
+	// throttled and reclaimed.
+	High uint64 `json:"high"`
+	// Number of times usage was about to go above memory.max.
+	Max uint64 `json:"max"`
+	// Number of times the container hit its limit and invoked the OOM killer,
+	// whether or not a process was killed.
+	Oom uint64 `json:"oom"`
+	// Number of processes of the container killed by the OOM killer.
+	OomKill uint64 `json:"oom_kill"`
+}
+
 type MemoryStatsMemoryData struct {
 	Pgfault    uint64 `json:"pgfault"`
 	Pgmajfault uint64 `json:"pgmajfault"`
 }
 
+// Stats of a network interface, as reported per interface in
+// NetworkStats.Interfaces.
+type InterfaceStats struct {
+	// Cumulative count of bytes received.
+	RxBytes uint64 `json:"rx_bytes"`
+	// Cumulative count of packets received.
+	RxPackets uint64 `json:"rx_packets"`
+	// Cumulative count of receive errors encountered.
+	RxErrors uint64 `json:"rx_errors"`
+	// Cumulative count of packets dropped while receiving.
+	RxDropped uint64 `json:"rx_dropped"`
+	// Cumulative count of bytes transmitted.
+	TxBytes uint64 `json:"tx_bytes"`
+	// Cumulative count of packets transmitted.
+	TxPackets uint64 `json:"tx_packets"`
+	// Cumulative count of transmit errors encountered.
+	TxErrors uint64 `json:"tx_errors"`
+	// Cumulative count of packets dropped while transmitting.
+	TxDropped uint64 `json:"tx_dropped"`
+}
+
 type NetworkStats struct {
 	// Cumulative count of bytes received.
 	RxBytes uint64 `json:"rx_bytes"`
@@ -258,18 +668,164 @@ type NetworkStats struct {
 	TxErrors uint64 `json:"tx_errors"`
 	// Cumulative count of packets dropped while transmitting.
 	TxDropped uint64 `json:"tx_dropped"`
+
+	// Stats of each network interface keyed by interface name. Only reported
+	// for the root container.
+	Interfaces map[string]InterfaceStats `json:"interfaces,omitempty"`
+
+	// IPv6 traffic of the network namespace, zero when IPv6 is disabled.
+	Ipv6 Ipv6Stats `json:"ipv6"`
+
+	// TCP health counters of the network namespace. Only reported when
+	// enabled.
+	TcpAdvanced TcpAdvancedStats `json:"tcp_advanced"`
+
+	// Stats of the root queueing discipline of each network interface of the
+	// network namespace, keyed by interface name. They count the packets
+	// dropped or delayed by traffic shaping, which the interface counters
+	// miss. Only reported when enabled.
+	Qdiscs map[string]QdiscStats `json:"qdiscs,omitempty"`
+
+	// TCP buffer memory charged to the memory cgroup of the container. Nil
+	// when the kernel does not account it (e.g. on the unified hierarchy or
+	// with cgroup.memory=nokmem).
+	TcpMemory *TcpMemoryStats `json:"tcp_memory,omitempty"`
+}
+
+type QdiscStats struct {
+	// Kind of the queueing discipline, e.g. "fq_codel" or "htb".
+	Kind string `json:"kind"`
+	// Cumulative count of bytes and packets sent.
+	Bytes   uint64 `json:"bytes"`
+	Packets uint64 `json:"packets"`
+	// Cumulative count of packets dropped.
+	Drops uint64 `json:"drops"`
+	// Cumulative count of times a packet was delayed because the interface
+	// was over its rate limit.
+	Overlimits uint64 `json:"overlimits"`
+	// Cumulative count of packets queued again after the driver refused them.
+	Requeues uint64 `json:"requeues"`
+	// Current number of bytes and packets queued.
+	Backlog uint64 `json:"backlog"`
+	Qlen    uint64 `json:"qlen"`
+}
+
+type TcpMemoryStats struct {
+	// Current TCP buffer memory usage.
+	// Units: Bytes.
+	Usage uint64 `json:"usage"`
+
+	// Limit of the TCP buffer memory, math.MaxInt64 rounded down to a page
+	// when unlimited.
+	// Units: Bytes.
+	Limit uint64 `json:"limit"`
+
+	// Whether usage is close to the limit, above which the kernel refuses to
+	// grow the TCP buffers of the container.
+	NearLimit bool `json:"near_limit,omitempty"`
+}
+
+type TcpAdvancedStats struct {
+	// Cumulative count of TCP segments retransmitted.
+	RetransSegs uint64 `json:"retrans_segs"`
+	// Cumulative count of TCP resets sent.
+	OutRsts uint64 `json:"out_rsts"`
+	// Cumulative count of established TCP connections reset.
+	EstabResets uint64 `json:"estab_resets"`
+	// Cumulative count of connections dropped because the accept queue of a
+	// listening socket was full.
+	ListenOverflows uint64 `json:"listen_overflows"`
+	// Cumulative count of connections dropped by listening sockets for any
+	// reason, including overflows.
+	ListenDrops uint64 `json:"listen_drops"`
+}
+
+type Ipv6Stats struct {
+	// Cumulative count of IPv6 bytes received.
+	RxBytes uint64 `json:"rx_bytes"`
+	// Cumulative count of IPv6 packets received.
+	RxPackets uint64 `json:"rx_packets"`
+	// Cumulative count of IPv6 bytes transmitted.
+	TxBytes uint64 `json:"tx_bytes"`
+	// Cumulative count of IPv6 packets transmitted.
+	TxPackets uint64 `json:"tx_packets"`
+}
+
+type RdmaDeviceStats struct {
+	// The RDMA device (e.g. mlx5_0).
+	Device string `json:"device"`
+
+	// Number of HCA handles.
+	HcaHandles uint64 `json:"hca_handles"`
+
+	// Number of HCA objects.
+	HcaObjects uint64 `json:"hca_objects"`
+}
+
+type RdmaStats struct {
+	// Current usage of each RDMA device.
+	Usage []RdmaDeviceStats `json:"usage,omitempty"`
+
+	// Limits on each RDMA device. Unlimited resources are reported as the
+	// maximum uint64 value.
+	Limit []RdmaDeviceStats `json:"limit,omitempty"`
+}
+
+type MiscResourceStats struct {
+	// The resource (e.g. sev, sev_es).
+	Resource string `json:"resource"`
+
+	// Amount of the resource.
+	Value uint64 `json:"value"`
+}
+
+type MiscStats struct {
+	// Current usage of each resource.
+	Usage []MiscResourceStats `json:"usage,omitempty"`
+
+	// Limits on each resource. Unlimited resources are reported as the
+	// maximum uint64 value.
+	Limit []MiscResourceStats `json:"limit,omitempty"`
+}
+
+// Bytes read and written by a container, summed across devices. A proxy for
+// the disk activity of containers whose filesystems are unknown: it measures
+// IO activity, not the usage or capacity of a filesystem.
+type IoActivityStats struct {
+	// Units: Bytes.
+	ReadBytes  uint64 `json:"read_bytes"`
+	WriteBytes uint64 `json:"write_bytes"`
+}
+
+type SubpathStats struct {
+	// The directory.
+	Path string `json:"path"`
+
+	// Number of bytes used by the files under the directory, as computed by
+	// du. Refreshed at most once per --subpath_usage_ttl.
+	Usage uint64 `json:"usage"`
 }
 
 type FsStats struct {
 	// The block device name associated with the filesystem.
 	Device string `json:"device,omitempty"`
 
+	// Where the filesystem is mounted. A device mounted at several
+	// mountpoints is reported once per mountpoint unless deduplicated.
+	Mountpoint string `json:"mountpoint,omitempty"`
+
 	// Number of bytes that can be consumed by the container on this filesystem.
 	Limit uint64 `json:"capacity"`
 
 	// Number of bytes that is consumed by the container on this filesystem.
 	Usage uint64 `json:"usage"`
 
+	// Whether the filesystem is shared with the host because the container
+	// bind mounts one of its directories. Usage is then the usage of the
+	// whole filesystem, or of the directories mounted with
+	// --bind_mount_fs_usage, and is not used by the container alone.
+	Shared bool `json:"shared,omitempty"`
+
 	// Number of reads completed
 	// This is the total number of reads completed successfully.
 	ReadsCompleted uint64 `json:"reads_completed"`
@@ -326,18 +882,92 @@ type FsStats struct {
 }
 
 type ContainerStats struct {
-	// The time of this stat point.
-	Timestamp time.Time    `json:"timestamp"`
-	Cpu       CpuStats     `json:"cpu,omitempty"`
-	DiskIo    DiskIoStats  `json:"diskio,omitempty"`
-	Memory    MemoryStats  `json:"memory,omitempty"`
-	Network   NetworkStats `json:"network,omitempty"`
+	// The time of this stat point, taken when its collection started.
+	Timestamp time.Time `json:"timestamp"`
+	// How long the collection of this stat point took.
+	CollectionDuration time.Duration `json:"collection_duration,omitempty"`
+	// Files read to collect this stat point, only recorded when enabled.
+	CollectionCost *CollectionCost `json:"collection_cost,omitempty"`
+
+	Cpu     CpuStats     `json:"cpu,omitempty"`
+	DiskIo  DiskIoStats  `json:"diskio,omitempty"`
+	Memory  MemoryStats  `json:"memory,omitempty"`
+	Network NetworkStats `json:"network,omitempty"`
+	Rdma    RdmaStats    `json:"rdma,omitempty"`
+	Misc    MiscStats    `json:"misc,omitempty"`
+
+	Processes ProcessStats `json:"processes,omitempty"`
+
+	// IO of the processes of the container at the syscall level, which
+	// includes the IO served by the page cache. Only reported with
+	// --application_io_stats.
+	ApplicationIo ApplicationIoStats `json:"application_io,omitempty"`
 
 	// Filesystem statistics
 	Filesystem []FsStats `json:"filesystem,omitempty"`
 
+	// Usage of the directories of the container listed in its hints, in the
+	// order they are listed. Directories that do not exist are left out.
+	Subpaths []SubpathStats `json:"subpaths,omitempty"`
+
+	// IO activity of the container, reported instead when it has no
+	// filesystem stats. Nil when there are filesystem stats or no blkio
+	// cgroup.
+	FilesystemActivity *IoActivityStats `json:"filesystem_activity,omitempty"`
+
 	// Task load stats
 	TaskStats LoadStats `json:"task_stats,omitempty"`
+
+	// Metrics gathered by custom collectors, keyed by metric name.
+	CustomMetrics map[string]float64 `json:"custom_metrics,omitempty"`
+
+	// Whether a cumulative counter went backwards (e.g. the container was
+	// restarted) since the previous stats. When the stats are computed as
+	// deltas, the affected counters report a zero delta.
+	CounterReset bool `json:"counter_reset,omitempty"`
+}
+
+type ProcessStats struct {
+	// Number of threads in the cgroups of the container, not including those
+	// of its subcontainers. Only reported with --thread_count_stats.
+	ThreadCount uint64 `json:"thread_count,omitempty"`
+
+	// Highest badness score for the OOM killer across the processes of the
+	// container and of its subcontainers, and the process that has it. The
+	// process with the highest score on the machine or in the memory cgroup
+	// that runs out of memory is killed first. Only reported when enabled.
+	MaxOomScore    int64 `json:"max_oom_score,omitempty"`
+	MaxOomScorePid int   `json:"max_oom_score_pid,omitempty"`
+
+	// Highest adjustment of the score across the same processes, from -1000
+	// (never killed) to 1000. Zero when there are no processes.
+	MaxOomScoreAdj int64 `json:"max_oom_score_adj,omitempty"`
+}
+
+// IO counters summed across the processes of a container and of its
+// subcontainers that are alive. They go backwards when processes exit.
+type ApplicationIoStats struct {
+	// Bytes read and written through syscalls.
+	// Units: Bytes.
+	Rchar uint64 `json:"rchar"`
+	Wchar uint64 `json:"wchar"`
+
+	// Number of read and write syscalls.
+	Syscr uint64 `json:"syscr"`
+	Syscw uint64 `json:"syscw"`
+
+	// Bytes read from and written to the block layer.
+	// Units: Bytes.
+	ReadBytes  uint64 `json:"read_bytes"`
+	WriteBytes uint64 `json:"write_bytes"`
+}
+
+type CollectionCost struct {
+	// Number of files read by the container driver. The cgroup stats files
+	// read through libcontainer are not included.
+	FilesRead uint64 `json:"files_read"`
+	// Time spent reading these files.
+	ReadDuration time.Duration `json:"read_duration"`
 }
 
 func timeEq(t1, t2 time.Time, tolerance time.Duration) bool {
@@ -395,6 +1025,27 @@ func (a *ContainerStats) StatsEq(b *ContainerStats) bool {
 	if !reflect.DeepEqual(a.Filesystem, b.Filesystem) {
 		return false
 	}
+	if !reflect.DeepEqual(a.Subpaths, b.Subpaths) {
+		return false
+	}
+	if !reflect.DeepEqual(a.FilesystemActivity, b.FilesystemActivity) {
+		return false
+	}
+	if !reflect.DeepEqual(a.Rdma, b.Rdma) {
+		return false
+	}
+	if !reflect.DeepEqual(a.Misc, b.Misc) {
+		return false
+	}
+	if a.Processes != b.Processes {
+		return false
+	}
+	if a.ApplicationIo != b.ApplicationIo {
+		return false
+	}
+	if !reflect.DeepEqual(a.CustomMetrics, b.CustomMetrics) {
+		return false
+	}
 	return true
 }
 
@@ -15,6 +15,7 @@
 package info
 
 import (
+	"reflect"
 	"testing"
 	"time"
 )
@@ -77,3 +78,26 @@ func createStats(cpuUsage, memUsage uint64, timestamp time.Time) *ContainerStats
 	stats.Timestamp = timestamp
 	return stats
 }
+
+func TestContainerReferenceAncestry(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		ancestry []string
+		parent   string
+	}{
+		{"/", nil, ""},
+		{"/docker/abc", []string{"docker", "abc"}, "/docker"},
+		{"/system.slice/a\\/b.service", []string{"system.slice", "a\\/b.service"}, "/system.slice"},
+	} {
+		ref := ContainerReference{Name: test.name}
+		if ancestry := ref.Ancestry(); !reflect.DeepEqual(ancestry, test.ancestry) {
+			t.Errorf("ancestry of %q is %q, expected %q", test.name, ancestry, test.ancestry)
+		}
+		if depth := ref.Depth(); depth != len(test.ancestry) {
+			t.Errorf("depth of %q is %d, expected %d", test.name, depth, len(test.ancestry))
+		}
+		if parent := ref.Parent(); parent != test.parent {
+			t.Errorf("parent of %q is %q, expected %q", test.name, parent, test.parent)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package info
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CPU usage of a container between two stats samples.
+type CpuUsageRate struct {
+	// CPU time used between the two samples.
+	// Units: nanoseconds.
+	Usage uint64 `json:"usage"`
+
+	// Average number of cores used between the two samples.
+	Cores float64 `json:"cores"`
+
+	// Usage relative to the cores allocated to the container, capped to [0-100].
+	Percent float64 `json:"percent"`
+}
+
+// Parses a list of cpus in the format of cpuset.cpus and
+// /sys/devices/system/cpu/online (e.g. "0-3,6") into the sorted cpu ids.
+func ParseCpuList(list string) ([]int, error) {
+	cpuSet := make(map[int]struct{})
+	for _, part := range strings.Split(strings.TrimSpace(list), ",") {
+		if part == "" {
+			continue
+		}
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpu list %q: %v", list, err)
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid cpu list %q: %v", list, err)
+			}
+		}
+		if last < first {
+			return nil, fmt.Errorf("invalid cpu list %q: malformed range %q", list, part)
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpuSet[cpu] = struct{}{}
+		}
+	}
+	cpus := make([]int, 0, len(cpuSet))
+	for cpu := range cpuSet {
+		cpus = append(cpus, cpu)
+	}
+	sort.Ints(cpus)
+	return cpus, nil
+}
+
+// Formats sorted cpu ids as a cpu list, the inverse of ParseCpuList.
+func FormatCpuList(cpus []int) string {
+	var parts []string
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(cpus[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", cpus[i], cpus[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// Returns the number of cores in a cpuset mask (e.g.: "0-3,6" has 5 cores).
+// An empty mask is invalid.
+func CpuMaskCores(mask string) (int, error) {
+	if strings.TrimSpace(mask) == "" {
+		return 0, fmt.Errorf("failed to parse cpu mask %q: empty mask", mask)
+	}
+	cpus, err := ParseCpuList(mask)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse cpu mask %q: %v", mask, err)
+	}
+	return len(cpus), nil
+}
+
+// Returns the number of cores the container may use. This is the number of
+// cores in its cpuset, further limited by its CFS quota if one is set.
+func (self *CpuSpec) EffectiveCores() (float64, error) {
+	maskCores, err := CpuMaskCores(self.Mask)
+	if err != nil {
+		return 0, err
+	}
+	cores := float64(maskCores)
+	// The quota is the CPU time the container may use every period.
+	if self.Quota > 0 && self.Quota != math.MaxUint64 && self.Period > 0 {
+		quotaCores := float64(self.Quota) / float64(self.Period)
+		if quotaCores < cores {
+			cores = quotaCores
+		}
+	}
+	return cores, nil
+}
+
+// Computes the CPU usage of a container between the prev and cur samples. The
+// percentage is relative to the effective cores of the container's spec
+// rather than to a single core, so it stays within [0-100].
+func GetCpuUsageRate(prev, cur *ContainerStats, spec *CpuSpec) (CpuUsageRate, error) {
+	interval := cur.Timestamp.Sub(prev.Timestamp)
+	if interval <= 0 {
+		return CpuUsageRate{}, fmt.Errorf("stats at %v are not after stats at %v", cur.Timestamp, prev.Timestamp)
+	}
+	cores, err := spec.EffectiveCores()
+	if err != nil {
+		return CpuUsageRate{}, err
+	}
+	if cores <= 0 {
+		return CpuUsageRate{}, fmt.Errorf("container has no cores allocated")
+	}
+
+	usage := calculateCpuUsage(prev.Cpu.Usage.Total, cur.Cpu.Usage.Total)
+	usedCores := float64(usage) / float64(interval/time.Nanosecond)
+	percent := usedCores / cores * 100
+	if percent > 100 {
+		percent = 100
+	}
+	return CpuUsageRate{
+		Usage:   usage,
+		Cores:   usedCores,
+		Percent: percent,
+	}, nil
+}
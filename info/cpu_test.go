@@ -0,0 +1,113 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package info
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCpuMaskCores(t *testing.T) {
+	testCases := map[string]int{
+		"0":       1,
+		"0-1":     2,
+		"0-3,6":   5,
+		"0,2,4-7": 6,
+	}
+	for mask, expected := range testCases {
+		cores, err := CpuMaskCores(mask)
+		if err != nil {
+			t.Errorf("failed to parse mask %q: %v", mask, err)
+		}
+		if cores != expected {
+			t.Errorf("mask %q has %d cores, expected %d", mask, cores, expected)
+		}
+	}
+
+	for _, mask := range []string{"", "a-b", "3-1", "1-2-3"} {
+		_, err := CpuMaskCores(mask)
+		if err == nil {
+			t.Errorf("malformed mask %q should fail to parse", mask)
+		}
+	}
+}
+
+func TestParseCpuList(t *testing.T) {
+	for list, expected := range map[string][]int{
+		"0-3,6\n": {0, 1, 2, 3, 6},
+		"5,1-2":   {1, 2, 5},
+		"":        {},
+	} {
+		cpus, err := ParseCpuList(list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(cpus, expected) {
+			t.Errorf("parsed %q as %v, expected %v", list, cpus, expected)
+		}
+	}
+	for _, list := range []string{"0-a", "3-1", "1-2-3"} {
+		if _, err := ParseCpuList(list); err == nil {
+			t.Errorf("expected an error parsing the invalid cpu list %q", list)
+		}
+	}
+	if list := FormatCpuList([]int{0, 1, 2, 4, 6, 7}); list != "0-2,4,6-7" {
+		t.Errorf("formatted cpus as %q, expected %q", list, "0-2,4,6-7")
+	}
+}
+
+func TestGetCpuUsageRate(t *testing.T) {
+	ct := time.Now()
+	prev := createStats(1000000000, 0, ct)
+	cur := createStats(2500000000, 0, ct.Add(time.Second))
+
+	// Limited to 2 cores using 1.5 cores.
+	for _, spec := range []CpuSpec{
+		{Mask: "0-1"},
+		{Mask: "0-7", Quota: 200000, Period: 100000},
+		// An unlimited quota does not limit the cpuset.
+		{Mask: "0-1", Quota: math.MaxUint64, Period: 100000},
+	} {
+		rate, err := GetCpuUsageRate(prev, cur, &spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rate.Usage != 1500000000 {
+			t.Errorf("usage is %d, expected %d", rate.Usage, 1500000000)
+		}
+		if rate.Cores != 1.5 {
+			t.Errorf("usage is %v cores, expected %v cores", rate.Cores, 1.5)
+		}
+		if rate.Percent != 75 {
+			t.Errorf("usage is %v%% for spec %+v, expected %v%%", rate.Percent, spec, 75)
+		}
+	}
+
+	// Usage is capped to the allocated cores.
+	rate, err := GetCpuUsageRate(prev, cur, &CpuSpec{Mask: "0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate.Percent != 100 {
+		t.Errorf("usage is %v%%, expected it to be capped to 100%%", rate.Percent)
+	}
+
+	_, err = GetCpuUsageRate(cur, prev, &CpuSpec{Mask: "0-1"})
+	if err == nil {
+		t.Errorf("stats out of order should fail")
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package info
+
+import "time"
+
+// The change of the stats of a container between two samples. The cumulative
+// counters (e.g. cpu usage, network and disk bytes, page faults) hold the
+// change since the previous sample while gauges (e.g. memory usage) hold the
+// current value.
+type StatsDelta struct {
+	ContainerStats
+
+	// Time between the two samples, zero if there was no previous sample.
+	Interval time.Duration `json:"interval"`
+}
+
+// Computes the change of the stats since prev. Counters that went backwards,
+// usually because the container was restarted, report a zero delta and set
+// CounterReset on the result. Without a previous sample the current stats are
+// returned as is.
+func (self *ContainerStats) Sub(prev *ContainerStats) *StatsDelta {
+	if prev == nil {
+		return &StatsDelta{ContainerStats: *self}
+	}
+	return &StatsDelta{
+		ContainerStats: statsDelta(prev, self),
+		Interval:       self.Timestamp.Sub(prev.Timestamp),
+	}
+}
+
+func statsDelta(prev, cur *ContainerStats) ContainerStats {
+	d := &counterDelta{}
+	ret := *cur
+
+	// Cpu.
+	ret.Cpu.Usage.Total = d.sub(prev.Cpu.Usage.Total, cur.Cpu.Usage.Total)
+	ret.Cpu.Usage.User = d.sub(prev.Cpu.Usage.User, cur.Cpu.Usage.User)
+	ret.Cpu.Usage.System = d.sub(prev.Cpu.Usage.System, cur.Cpu.Usage.System)
+	ret.Cpu.Usage.Steal = d.sub(prev.Cpu.Usage.Steal, cur.Cpu.Usage.Steal)
+	ret.Cpu.Usage.Guest = d.sub(prev.Cpu.Usage.Guest, cur.Cpu.Usage.Guest)
+	// Exiting threads take their wait time with them, which is not a reset.
+	ret.Cpu.SchedWaitTime = calculateCpuUsage(prev.Cpu.SchedWaitTime, cur.Cpu.SchedWaitTime)
+	ret.Cpu.ThrottledTime = d.sub(prev.Cpu.ThrottledTime, cur.Cpu.ThrottledTime)
+	ret.Cpu.ContentionTime = calculateCpuUsage(prev.Cpu.ContentionTime, cur.Cpu.ContentionTime)
+	ret.Cpu.Usage.PerCpu = make([]uint64, len(cur.Cpu.Usage.PerCpu))
+	for i, usage := range cur.Cpu.Usage.PerCpu {
+		var prevUsage uint64
+		if i < len(prev.Cpu.Usage.PerCpu) {
+			prevUsage = prev.Cpu.Usage.PerCpu[i]
+		}
+		ret.Cpu.Usage.PerCpu[i] = d.sub(prevUsage, usage)
+	}
+
+	// DiskIo. IoQueued is the current queue and is left as is.
+	ret.DiskIo.IoServiceBytes = d.perDiskStats(prev.DiskIo.IoServiceBytes, cur.DiskIo.IoServiceBytes)
+	ret.DiskIo.IoServiced = d.perDiskStats(prev.DiskIo.IoServiced, cur.DiskIo.IoServiced)
+	ret.DiskIo.Sectors = d.perDiskStats(prev.DiskIo.Sectors, cur.DiskIo.Sectors)
+	ret.DiskIo.IoServiceTime = d.perDiskStats(prev.DiskIo.IoServiceTime, cur.DiskIo.IoServiceTime)
+	ret.DiskIo.IoWaitTime = d.perDiskStats(prev.DiskIo.IoWaitTime, cur.DiskIo.IoWaitTime)
+	ret.DiskIo.IoMerged = d.perDiskStats(prev.DiskIo.IoMerged, cur.DiskIo.IoMerged)
+	ret.DiskIo.IoTime = d.perDiskStats(prev.DiskIo.IoTime, cur.DiskIo.IoTime)
+	ret.DiskIo.IoCost = d.perDiskStats(prev.DiskIo.IoCost, cur.DiskIo.IoCost)
+	ret.DiskIo.Pressure = d.pressureStats(prev.DiskIo.Pressure, cur.DiskIo.Pressure)
+
+	// Memory.
+	ret.Memory.ContainerData.Pgfault = d.sub(prev.Memory.ContainerData.Pgfault, cur.Memory.ContainerData.Pgfault)
+	ret.Memory.ContainerData.Pgmajfault = d.sub(prev.Memory.ContainerData.Pgmajfault, cur.Memory.ContainerData.Pgmajfault)
+	ret.Memory.HierarchicalData.Pgfault = d.sub(prev.Memory.HierarchicalData.Pgfault, cur.Memory.HierarchicalData.Pgfault)
+	ret.Memory.HierarchicalData.Pgmajfault = d.sub(prev.Memory.HierarchicalData.Pgmajfault, cur.Memory.HierarchicalData.Pgmajfault)
+	ret.Memory.Reclaim = MemoryReclaimStats{
+		Pgscan:        d.sub(prev.Memory.Reclaim.Pgscan, cur.Memory.Reclaim.Pgscan),
+		PgscanKswapd:  d.sub(prev.Memory.Reclaim.PgscanKswapd, cur.Memory.Reclaim.PgscanKswapd),
+		PgscanDirect:  d.sub(prev.Memory.Reclaim.PgscanDirect, cur.Memory.Reclaim.PgscanDirect),
+		Pgsteal:       d.sub(prev.Memory.Reclaim.Pgsteal, cur.Memory.Reclaim.Pgsteal),
+		PgstealKswapd: d.sub(prev.Memory.Reclaim.PgstealKswapd, cur.Memory.Reclaim.PgstealKswapd),
+		PgstealDirect: d.sub(prev.Memory.Reclaim.PgstealDirect, cur.Memory.Reclaim.PgstealDirect),
+	}
+	ret.Memory.Refault = MemoryRefaultStats{
+		Anon:         d.sub(prev.Memory.Refault.Anon, cur.Memory.Refault.Anon),
+		File:         d.sub(prev.Memory.Refault.File, cur.Memory.Refault.File),
+		ActivateAnon: d.sub(prev.Memory.Refault.ActivateAnon, cur.Memory.Refault.ActivateAnon),
+		ActivateFile: d.sub(prev.Memory.Refault.ActivateFile, cur.Memory.Refault.ActivateFile),
+	}
+	ret.Memory.Events = MemoryEventsStats{
+		Low:     d.sub(prev.Memory.Events.Low, cur.Memory.Events.Low),
+		High:    d.sub(prev.Memory.Events.High, cur.Memory.Events.High),
+		Max:     d.sub(prev.Memory.Events.Max, cur.Memory.Events.Max),
+		Oom:     d.sub(prev.Memory.Events.Oom, cur.Memory.Events.Oom),
+		OomKill: d.sub(prev.Memory.Events.OomKill, cur.Memory.Events.OomKill),
+	}
+
+	// Network.
+	ret.Network.RxBytes = d.sub(prev.Network.RxBytes, cur.Network.RxBytes)
+	ret.Network.RxPackets = d.sub(prev.Network.RxPackets, cur.Network.RxPackets)
+	ret.Network.RxErrors = d.sub(prev.Network.RxErrors, cur.Network.RxErrors)
+	ret.Network.RxDropped = d.sub(prev.Network.RxDropped, cur.Network.RxDropped)
+	ret.Network.TxBytes = d.sub(prev.Network.TxBytes, cur.Network.TxBytes)
+	ret.Network.TxPackets = d.sub(prev.Network.TxPackets, cur.Network.TxPackets)
+	ret.Network.TxErrors = d.sub(prev.Network.TxErrors, cur.Network.TxErrors)
+	ret.Network.TxDropped = d.sub(prev.Network.TxDropped, cur.Network.TxDropped)
+	if cur.Network.Interfaces != nil {
+		ret.Network.Interfaces = make(map[string]InterfaceStats, len(cur.Network.Interfaces))
+		for name, stats := range cur.Network.Interfaces {
+			ret.Network.Interfaces[name] = d.interfaceStats(prev.Network.Interfaces[name], stats)
+		}
+	}
+	ret.Network.Ipv6 = Ipv6Stats{
+		RxBytes:   d.sub(prev.Network.Ipv6.RxBytes, cur.Network.Ipv6.RxBytes),
+		RxPackets: d.sub(prev.Network.Ipv6.RxPackets, cur.Network.Ipv6.RxPackets),
+		TxBytes:   d.sub(prev.Network.Ipv6.TxBytes, cur.Network.Ipv6.TxBytes),
+		TxPackets: d.sub(prev.Network.Ipv6.TxPackets, cur.Network.Ipv6.TxPackets),
+	}
+	ret.Network.TcpAdvanced = TcpAdvancedStats{
+		RetransSegs:     d.sub(prev.Network.TcpAdvanced.RetransSegs, cur.Network.TcpAdvanced.RetransSegs),
+		OutRsts:         d.sub(prev.Network.TcpAdvanced.OutRsts, cur.Network.TcpAdvanced.OutRsts),
+		EstabResets:     d.sub(prev.Network.TcpAdvanced.EstabResets, cur.Network.TcpAdvanced.EstabResets),
+		ListenOverflows: d.sub(prev.Network.TcpAdvanced.ListenOverflows, cur.Network.TcpAdvanced.ListenOverflows),
+		ListenDrops:     d.sub(prev.Network.TcpAdvanced.ListenDrops, cur.Network.TcpAdvanced.ListenDrops),
+	}
+	if cur.Network.Qdiscs != nil {
+		ret.Network.Qdiscs = make(map[string]QdiscStats, len(cur.Network.Qdiscs))
+		for name, stats := range cur.Network.Qdiscs {
+			ret.Network.Qdiscs[name] = d.qdiscStats(prev.Network.Qdiscs[name], stats)
+		}
+	}
+
+	if cur.FilesystemActivity != nil {
+		prevActivity := IoActivityStats{}
+		if prev.FilesystemActivity != nil {
+			prevActivity = *prev.FilesystemActivity
+		}
+		ret.FilesystemActivity = &IoActivityStats{
+			ReadBytes:  d.sub(prevActivity.ReadBytes, cur.FilesystemActivity.ReadBytes),
+			WriteBytes: d.sub(prevActivity.WriteBytes, cur.FilesystemActivity.WriteBytes),
+		}
+	}
+
+	// The application IO goes backwards when processes exit, which is not a
+	// reset.
+	ret.ApplicationIo = ApplicationIoStats{
+		Rchar:      calculateCpuUsage(prev.ApplicationIo.Rchar, cur.ApplicationIo.Rchar),
+		Wchar:      calculateCpuUsage(prev.ApplicationIo.Wchar, cur.ApplicationIo.Wchar),
+		Syscr:      calculateCpuUsage(prev.ApplicationIo.Syscr, cur.ApplicationIo.Syscr),
+		Syscw:      calculateCpuUsage(prev.ApplicationIo.Syscw, cur.ApplicationIo.Syscw),
+		ReadBytes:  calculateCpuUsage(prev.ApplicationIo.ReadBytes, cur.ApplicationIo.ReadBytes),
+		WriteBytes: calculateCpuUsage(prev.ApplicationIo.WriteBytes, cur.ApplicationIo.WriteBytes),
+	}
+
+	// Filesystem. Usage, Limit, and IoInProgress are gauges.
+	ret.Filesystem = make([]FsStats, len(cur.Filesystem))
+	for i, fs := range cur.Filesystem {
+		var prevFs FsStats
+		for _, f := range prev.Filesystem {
+			if f.Device == fs.Device {
+				prevFs = f
+				break
+			}
+		}
+		fs.ReadsCompleted = d.sub(prevFs.ReadsCompleted, fs.ReadsCompleted)
+		fs.ReadsMerged = d.sub(prevFs.ReadsMerged, fs.ReadsMerged)
+		fs.SectorsRead = d.sub(prevFs.SectorsRead, fs.SectorsRead)
+		fs.ReadTime = d.sub(prevFs.ReadTime, fs.ReadTime)
+		fs.WritesCompleted = d.sub(prevFs.WritesCompleted, fs.WritesCompleted)
+		fs.WritesMerged = d.sub(prevFs.WritesMerged, fs.WritesMerged)
+		fs.SectorsWritten = d.sub(prevFs.SectorsWritten, fs.SectorsWritten)
+		fs.WriteTime = d.sub(prevFs.WriteTime, fs.WriteTime)
+		fs.IoTime = d.sub(prevFs.IoTime, fs.IoTime)
+		fs.WeightedIoTime = d.sub(prevFs.WeightedIoTime, fs.WeightedIoTime)
+		ret.Filesystem[i] = fs
+	}
+
+	ret.CounterReset = d.reset
+	return ret
+}
+
+// Accumulates whether any counter went backwards while computing a delta.
+type counterDelta struct {
+	reset bool
+}
+
+func (self *counterDelta) sub(prev, cur uint64) uint64 {
+	if prev > cur {
+		self.reset = true
+	}
+	return calculateCpuUsage(prev, cur)
+}
+
+// The averages of the pressure are kept as is.
+func (self *counterDelta) pressureStats(prev, cur *PressureStats) *PressureStats {
+	if cur == nil {
+		return nil
+	}
+	if prev == nil {
+		prev = &PressureStats{}
+	}
+	ret := *cur
+	ret.Some.Total = self.sub(prev.Some.Total, cur.Some.Total)
+	ret.Full.Total = self.sub(prev.Full.Total, cur.Full.Total)
+	return &ret
+}
+
+func (self *counterDelta) interfaceStats(prev, cur InterfaceStats) InterfaceStats {
+	return InterfaceStats{
+		RxBytes:   self.sub(prev.RxBytes, cur.RxBytes),
+		RxPackets: self.sub(prev.RxPackets, cur.RxPackets),
+		RxErrors:  self.sub(prev.RxErrors, cur.RxErrors),
+		RxDropped: self.sub(prev.RxDropped, cur.RxDropped),
+		TxBytes:   self.sub(prev.TxBytes, cur.TxBytes),
+		TxPackets: self.sub(prev.TxPackets, cur.TxPackets),
+		TxErrors:  self.sub(prev.TxErrors, cur.TxErrors),
+		TxDropped: self.sub(prev.TxDropped, cur.TxDropped),
+	}
+}
+
+// The kind and the queue (Backlog and Qlen) are kept as is.
+func (self *counterDelta) qdiscStats(prev, cur QdiscStats) QdiscStats {
+	ret := cur
+	ret.Bytes = self.sub(prev.Bytes, cur.Bytes)
+	ret.Packets = self.sub(prev.Packets, cur.Packets)
+	ret.Drops = self.sub(prev.Drops, cur.Drops)
+	ret.Overlimits = self.sub(prev.Overlimits, cur.Overlimits)
+	ret.Requeues = self.sub(prev.Requeues, cur.Requeues)
+	return ret
+}
+
+func (self *counterDelta) perDiskStats(prev, cur []PerDiskStats) []PerDiskStats {
+	if cur == nil {
+		return nil
+	}
+	ret := make([]PerDiskStats, len(cur))
+	for i, disk := range cur {
+		var prevStats map[string]uint64
+		for _, p := range prev {
+			if p.Major == disk.Major && p.Minor == disk.Minor {
+				prevStats = p.Stats
+				break
+			}
+		}
+		ret[i] = PerDiskStats{
+			Major: disk.Major,
+			Minor: disk.Minor,
+			Stats: make(map[string]uint64, len(disk.Stats)),
+		}
+		for op, value := range disk.Stats {
+			ret[i].Stats[op] = self.sub(prevStats[op], value)
+		}
+	}
+	return ret
+}
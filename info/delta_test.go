@@ -0,0 +1,169 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package info
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSub(t *testing.T) {
+	ct := time.Now()
+	prev := createStats(1000, 4096, ct)
+	prev.Network.RxBytes = 100
+	prev.DiskIo.IoServiceBytes = []PerDiskStats{
+		{Major: 8, Minor: 0, Stats: map[string]uint64{"Read": 512}},
+	}
+	cur := createStats(1500, 2048, ct.Add(time.Second))
+	cur.Network.RxBytes = 250
+	cur.DiskIo.IoServiceBytes = []PerDiskStats{
+		{Major: 8, Minor: 0, Stats: map[string]uint64{"Read": 1024}},
+	}
+	prev.DiskIo.Pressure = &PressureStats{Some: PressureData{Avg10: 1, Total: 1000}}
+	cur.DiskIo.Pressure = &PressureStats{Some: PressureData{Avg10: 2.5, Total: 1800}}
+
+	delta := cur.Sub(prev)
+	if delta.CounterReset {
+		t.Errorf("no counter went backwards but a reset was flagged")
+	}
+	if delta.Cpu.Usage.Total != 500 || delta.Cpu.Usage.PerCpu[0] != 500 {
+		t.Errorf("cpu usage delta is %+v, expected 500", delta.Cpu.Usage)
+	}
+	if delta.Memory.Usage != 2048 {
+		t.Errorf("memory usage is a gauge and should be %d, not %d", 2048, delta.Memory.Usage)
+	}
+	if delta.Network.RxBytes != 150 {
+		t.Errorf("rx bytes delta is %d, expected %d", delta.Network.RxBytes, 150)
+	}
+	if delta.DiskIo.IoServiceBytes[0].Stats["Read"] != 512 {
+		t.Errorf("disk read delta is %d, expected %d", delta.DiskIo.IoServiceBytes[0].Stats["Read"], 512)
+	}
+	if delta.DiskIo.Pressure.Some.Total != 800 || delta.DiskIo.Pressure.Some.Avg10 != 2.5 {
+		t.Errorf("io pressure delta is %+v, expected a total of 800 and the current average", delta.DiskIo.Pressure.Some)
+	}
+	if !delta.Timestamp.Equal(cur.Timestamp) {
+		t.Errorf("delta timestamp is %v, expected %v", delta.Timestamp, cur.Timestamp)
+	}
+	if delta.Interval != time.Second {
+		t.Errorf("delta interval is %v, expected %v", delta.Interval, time.Second)
+	}
+	// The input stats must not be modified.
+	if cur.Cpu.Usage.Total != 1500 || cur.DiskIo.IoServiceBytes[0].Stats["Read"] != 1024 || cur.DiskIo.Pressure.Some.Total != 1800 {
+		t.Errorf("current stats were modified: %+v", cur)
+	}
+}
+
+func TestSubCounterReset(t *testing.T) {
+	ct := time.Now()
+	prev := createStats(5000, 4096, ct)
+	cur := createStats(100, 4096, ct.Add(time.Second))
+
+	delta := cur.Sub(prev)
+	if !delta.CounterReset {
+		t.Errorf("cpu usage went backwards but no reset was flagged")
+	}
+	if delta.Cpu.Usage.Total != 0 {
+		t.Errorf("cpu usage delta after a reset is %d, expected 0", delta.Cpu.Usage.Total)
+	}
+}
+
+func TestSubIpv6(t *testing.T) {
+	ct := time.Now()
+	prev := createStats(1000, 4096, ct)
+	prev.Network.Ipv6 = Ipv6Stats{RxBytes: 1000, RxPackets: 10, TxBytes: 2000, TxPackets: 20}
+	cur := createStats(1000, 4096, ct.Add(time.Second))
+	cur.Network.Ipv6 = Ipv6Stats{RxBytes: 1500, RxPackets: 15, TxBytes: 2600, TxPackets: 26}
+
+	delta := cur.Sub(prev)
+	expected := Ipv6Stats{RxBytes: 500, RxPackets: 5, TxBytes: 600, TxPackets: 6}
+	if delta.Network.Ipv6 != expected || delta.CounterReset {
+		t.Errorf("ipv6 delta is %+v (reset %v), expected %+v", delta.Network.Ipv6, delta.CounterReset, expected)
+	}
+
+	// The counters restart when the network namespace is recreated.
+	cur.Network.Ipv6 = Ipv6Stats{RxBytes: 100, RxPackets: 1, TxBytes: 2600, TxPackets: 26}
+	delta = cur.Sub(prev)
+	expected = Ipv6Stats{TxBytes: 600, TxPackets: 6}
+	if delta.Network.Ipv6 != expected || !delta.CounterReset {
+		t.Errorf("ipv6 delta after a reset is %+v (reset %v), expected %+v and a reset", delta.Network.Ipv6, delta.CounterReset, expected)
+	}
+}
+
+func TestSubTcpAdvanced(t *testing.T) {
+	ct := time.Now()
+	prev := createStats(1000, 4096, ct)
+	prev.Network.TcpAdvanced = TcpAdvancedStats{RetransSegs: 10, OutRsts: 4, EstabResets: 2, ListenOverflows: 1, ListenDrops: 3}
+	cur := createStats(1000, 4096, ct.Add(time.Second))
+	cur.Network.TcpAdvanced = TcpAdvancedStats{RetransSegs: 25, OutRsts: 5, EstabResets: 2, ListenOverflows: 7, ListenDrops: 9}
+
+	delta := cur.Sub(prev)
+	expected := TcpAdvancedStats{RetransSegs: 15, OutRsts: 1, ListenOverflows: 6, ListenDrops: 6}
+	if delta.Network.TcpAdvanced != expected || delta.CounterReset {
+		t.Errorf("tcp delta is %+v (reset %v), expected %+v", delta.Network.TcpAdvanced, delta.CounterReset, expected)
+	}
+
+	cur.Network.TcpAdvanced.RetransSegs = 3
+	delta = cur.Sub(prev)
+	if delta.Network.TcpAdvanced.RetransSegs != 0 || !delta.CounterReset {
+		t.Errorf("retransmitted segments went backwards, expected a zero delta and a reset, got %+v (reset %v)", delta.Network.TcpAdvanced, delta.CounterReset)
+	}
+}
+
+func TestSubQdiscs(t *testing.T) {
+	ct := time.Now()
+	prev := createStats(1000, 4096, ct)
+	prev.Network.Qdiscs = map[string]QdiscStats{
+		"eth0": {Kind: "fq_codel", Bytes: 1000, Packets: 10, Drops: 1, Overlimits: 2, Requeues: 0, Backlog: 300, Qlen: 3},
+	}
+	cur := createStats(1000, 4096, ct.Add(time.Second))
+	cur.Network.Qdiscs = map[string]QdiscStats{
+		"eth0": {Kind: "fq_codel", Bytes: 4000, Packets: 40, Drops: 5, Overlimits: 2, Requeues: 1, Backlog: 100, Qlen: 1},
+		// A qdisc without a previous sample.
+		"eth1": {Kind: "tbf", Bytes: 500, Packets: 5, Backlog: 50, Qlen: 1},
+	}
+
+	delta := cur.Sub(prev)
+	expected := map[string]QdiscStats{
+		"eth0": {Kind: "fq_codel", Bytes: 3000, Packets: 30, Drops: 4, Overlimits: 0, Requeues: 1, Backlog: 100, Qlen: 1},
+		"eth1": {Kind: "tbf", Bytes: 500, Packets: 5, Backlog: 50, Qlen: 1},
+	}
+	if !reflect.DeepEqual(delta.Network.Qdiscs, expected) || delta.CounterReset {
+		t.Errorf("qdisc delta is %+v (reset %v), expected %+v", delta.Network.Qdiscs, delta.CounterReset, expected)
+	}
+	// The input stats must not be modified.
+	if cur.Network.Qdiscs["eth0"].Bytes != 4000 {
+		t.Errorf("current qdisc stats were modified: %+v", cur.Network.Qdiscs)
+	}
+
+	// The queue shrinking is not a reset, the counters going backwards is.
+	cur.Network.Qdiscs["eth0"] = QdiscStats{Kind: "fq_codel", Bytes: 200, Packets: 2, Drops: 5, Overlimits: 2, Requeues: 1}
+	delta = cur.Sub(prev)
+	if delta.Network.Qdiscs["eth0"].Bytes != 0 || !delta.CounterReset {
+		t.Errorf("qdisc bytes went backwards, expected a zero delta and a reset, got %+v (reset %v)", delta.Network.Qdiscs["eth0"], delta.CounterReset)
+	}
+}
+
+func TestSubNoPrevious(t *testing.T) {
+	cur := createStats(1500, 2048, time.Now())
+
+	delta := cur.Sub(nil)
+	if !delta.ContainerStats.StatsEq(cur) {
+		t.Errorf("without a previous sample the delta should be %+v, got %+v", cur, delta.ContainerStats)
+	}
+	if delta.Interval != 0 || delta.CounterReset {
+		t.Errorf("without a previous sample there should be no interval or reset, got %+v", delta)
+	}
+}
@@ -134,8 +134,29 @@ type MachineInfo struct {
 	// Machine Topology
 	// Describes cpu/memory layout and hierarchy.
 	Topology []Node `json:"topology"`
+
+	// Cpus currently online, in cpu list format (e.g. "0-3,6"). Empty when
+	// unknown.
+	OnlineCpus string `json:"online_cpus,omitempty"`
+
+	// Version of the running kernel (e.g. "5.4.0-42-generic").
+	KernelVersion string `json:"kernel_version"`
+
+	// The cgroup hierarchies mounted: CgroupV1, CgroupV2 or CgroupHybrid.
+	CgroupVersion string `json:"cgroup_version"`
 }
 
+// Cgroup hierarchies mounted on a machine.
+const (
+	// Only v1 hierarchies.
+	CgroupV1 = "v1"
+	// Only the unified (v2) hierarchy.
+	CgroupV2 = "v2"
+	// Both v1 hierarchies and the unified hierarchy (e.g. systemd's hybrid
+	// mode mounting it at /sys/fs/cgroup/unified).
+	CgroupHybrid = "hybrid"
+)
+
 type VersionInfo struct {
 	// Kernel version.
 	KernelVersion string `json:"kernel_version"`
@@ -0,0 +1,88 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package info
+
+import "fmt"
+
+// Memory utilization of a container relative to its limit.
+type MemoryUtilization struct {
+	// Memory usage as a fraction of Limit.
+	Fraction float64 `json:"fraction"`
+
+	// The limit the usage is relative to.
+	// Units: bytes.
+	Limit uint64 `json:"limit"`
+
+	// Whether the container has no memory limit. Limit is then the memory
+	// capacity of the machine.
+	Unlimited bool `json:"unlimited"`
+}
+
+// Smallest memory limit the kernel reports for a cgroup without a limit, the
+// largest page-aligned int64.
+const unlimitedMemory = 0x7FFFFFFFFFFFF000
+
+// Computes the memory utilization of a container from its stats and spec. A
+// container with no limit (zero, the "unlimited" sentinel, or a limit above
+// the memory capacity of the machine) is measured against machineMemory. A
+// machineMemory of zero means the capacity is unknown, so only containers with
+// a limit can be measured.
+func GetMemoryUtilization(stats *ContainerStats, spec *ContainerSpec, machineMemory uint64) (MemoryUtilization, error) {
+	if !spec.HasMemory {
+		return MemoryUtilization{}, fmt.Errorf("container has no memory isolation")
+	}
+
+	ret := MemoryUtilization{
+		Limit: spec.Memory.Limit,
+	}
+	unlimited := ret.Limit == 0 || ret.Limit >= unlimitedMemory
+	if machineMemory > 0 && ret.Limit >= machineMemory {
+		unlimited = true
+	}
+	if unlimited {
+		if machineMemory == 0 {
+			return MemoryUtilization{}, fmt.Errorf("container has no memory limit and the machine memory capacity is unknown")
+		}
+		ret.Limit = machineMemory
+		ret.Unlimited = true
+	}
+	ret.Fraction = float64(stats.Memory.Usage) / float64(ret.Limit)
+	return ret, nil
+}
+
+// Returns whether the working set grows steadily over samples. Samples must be
+// oldest first and taken at a fixed interval (e.g. the housekeeping interval)
+// since MemoryStats carries no timestamp: the time of a sample is its index.
+// Growth is detected when the slope of the least-squares line through the
+// working set is at least minSlope, in bytes per sampling interval. Fewer than
+// two samples never show growth.
+func DetectMemoryGrowth(samples []MemoryStats, minSlope float64) bool {
+	n := float64(len(samples))
+	if n < 2 {
+		return false
+	}
+
+	var sumX, sumY, sumXY, sumXX float64
+	for i, sample := range samples {
+		x := float64(i)
+		y := float64(sample.WorkingSet)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	slope := (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+	return slope >= minSlope
+}
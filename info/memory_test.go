@@ -0,0 +1,137 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package info
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+const machineMemory = 8 * 1024 * 1024 * 1024
+
+func TestGetMemoryUtilization(t *testing.T) {
+	stats := createStats(0, 512*1024*1024, time.Now())
+	spec := &ContainerSpec{
+		HasMemory: true,
+		Memory: MemorySpec{
+			Limit: 1024 * 1024 * 1024,
+		},
+	}
+	utilization, err := GetMemoryUtilization(stats, spec, machineMemory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := MemoryUtilization{
+		Fraction: 0.5,
+		Limit:    1024 * 1024 * 1024,
+	}
+	if utilization != expected {
+		t.Errorf("memory utilization is %+v, expected %+v", utilization, expected)
+	}
+}
+
+func TestGetMemoryUtilizationUnlimited(t *testing.T) {
+	stats := createStats(0, 2*1024*1024*1024, time.Now())
+	// No limit as reported by the raw driver, Docker, and the kernel.
+	for _, limit := range []uint64{0, math.MaxUint64, 0x7FFFFFFFFFFFF000} {
+		spec := &ContainerSpec{
+			HasMemory: true,
+			Memory: MemorySpec{
+				Limit: limit,
+			},
+		}
+		utilization, err := GetMemoryUtilization(stats, spec, machineMemory)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := MemoryUtilization{
+			Fraction:  0.25,
+			Limit:     machineMemory,
+			Unlimited: true,
+		}
+		if utilization != expected {
+			t.Errorf("memory utilization with limit %d is %+v, expected %+v", limit, utilization, expected)
+		}
+	}
+}
+
+func TestGetMemoryUtilizationUnknownMachineMemory(t *testing.T) {
+	stats := createStats(0, 512*1024*1024, time.Now())
+	spec := &ContainerSpec{
+		HasMemory: true,
+		Memory: MemorySpec{
+			Limit: 1024 * 1024 * 1024,
+		},
+	}
+	// The limit of the container is kept.
+	utilization, err := GetMemoryUtilization(stats, spec, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := MemoryUtilization{
+		Fraction: 0.5,
+		Limit:    1024 * 1024 * 1024,
+	}
+	if utilization != expected {
+		t.Errorf("memory utilization is %+v, expected %+v", utilization, expected)
+	}
+
+	// Without a limit there is nothing to measure against.
+	for _, limit := range []uint64{0, math.MaxUint64, 0x7FFFFFFFFFFFF000} {
+		spec.Memory.Limit = limit
+		if _, err := GetMemoryUtilization(stats, spec, 0); err == nil {
+			t.Errorf("expected an error for limit %d when the machine memory capacity is unknown", limit)
+		}
+	}
+}
+
+func TestGetMemoryUtilizationNoMemory(t *testing.T) {
+	stats := createStats(0, 1024, time.Now())
+	_, err := GetMemoryUtilization(stats, &ContainerSpec{}, machineMemory)
+	if err == nil {
+		t.Errorf("container without memory isolation should fail")
+	}
+}
+
+// Create memory samples with the specified working sets.
+func createMemorySamples(workingSets ...uint64) []MemoryStats {
+	samples := make([]MemoryStats, len(workingSets))
+	for i, workingSet := range workingSets {
+		samples[i].WorkingSet = workingSet
+	}
+	return samples
+}
+
+func TestDetectMemoryGrowthFlat(t *testing.T) {
+	// Noise around a constant working set is not growth.
+	samples := createMemorySamples(100<<20, 102<<20, 99<<20, 101<<20, 100<<20, 98<<20, 101<<20)
+	if DetectMemoryGrowth(samples, 1<<20) {
+		t.Errorf("growth detected in flat series")
+	}
+}
+
+func TestDetectMemoryGrowthIncreasing(t *testing.T) {
+	samples := createMemorySamples(100<<20, 104<<20, 107<<20, 113<<20, 116<<20, 121<<20, 124<<20)
+	if !DetectMemoryGrowth(samples, 1<<20) {
+		t.Errorf("growth not detected in steadily increasing series")
+	}
+}
+
+func TestDetectMemoryGrowthTooFewSamples(t *testing.T) {
+	if DetectMemoryGrowth(createMemorySamples(100<<20), 0) {
+		t.Errorf("growth detected from a single sample")
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package info
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// A field that differs between two container specs.
+type SpecChange struct {
+	// Path of the field from the spec, the names of the fields separated by
+	// dots (e.g. "Memory.Limit").
+	Field string
+	Old   interface{}
+	New   interface{}
+}
+
+func (self SpecChange) String() string {
+	return fmt.Sprintf("%s: %v -> %v", self.Field, self.Old, self.New)
+}
+
+// Returns the fields that differ between two container specs, in the order
+// they are declared. The structs of this package are compared field by field,
+// other fields (e.g. maps and slices) as a whole. A pointer that is nil in one
+// of the specs only is a change of the whole field.
+func SpecDiff(oldSpec, newSpec ContainerSpec) []SpecChange {
+	var changes []SpecChange
+	diffValues("", reflect.ValueOf(oldSpec), reflect.ValueOf(newSpec), &changes)
+	return changes
+}
+
+var infoPkgPath = reflect.TypeOf(ContainerSpec{}).PkgPath()
+
+func diffValues(field string, oldValue, newValue reflect.Value, changes *[]SpecChange) {
+	switch {
+	case oldValue.Kind() == reflect.Struct && oldValue.Type().PkgPath() == infoPkgPath:
+		for i := 0; i < oldValue.NumField(); i++ {
+			name := oldValue.Type().Field(i).Name
+			if field != "" {
+				name = field + "." + name
+			}
+			diffValues(name, oldValue.Field(i), newValue.Field(i), changes)
+		}
+		return
+	case oldValue.Kind() == reflect.Ptr && !oldValue.IsNil() && !newValue.IsNil():
+		diffValues(field, oldValue.Elem(), newValue.Elem(), changes)
+		return
+	}
+	if !reflect.DeepEqual(oldValue.Interface(), newValue.Interface()) {
+		*changes = append(*changes, SpecChange{
+			Field: field,
+			Old:   oldValue.Interface(),
+			New:   newValue.Interface(),
+		})
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package info
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSpecDiff(t *testing.T) {
+	oldSpec := ContainerSpec{
+		HasCpu: true,
+		Cpu: CpuSpec{
+			Limit: 1024,
+			Mask:  "0-3",
+		},
+		HasMemory: true,
+		Memory: MemorySpec{
+			Limit: 1 << 30,
+		},
+		EnabledControllers: []string{"cpu", "memory"},
+	}
+	newSpec := oldSpec
+	newSpec.Cpu.Mask = "0-1"
+	newSpec.Cpu.Uclamp = &UclampSpec{Min: 10, Max: 100}
+	newSpec.Memory.Limit = 2 << 30
+	newSpec.EnabledControllers = []string{"cpu", "io", "memory"}
+
+	expected := []SpecChange{
+		{Field: "Cpu.Mask", Old: "0-3", New: "0-1"},
+		{Field: "Cpu.Uclamp", Old: (*UclampSpec)(nil), New: &UclampSpec{Min: 10, Max: 100}},
+		{Field: "Memory.Limit", Old: uint64(1 << 30), New: uint64(2 << 30)},
+		{Field: "EnabledControllers", Old: []string{"cpu", "memory"}, New: []string{"cpu", "io", "memory"}},
+	}
+	if changes := SpecDiff(oldSpec, newSpec); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected changes %v, got %v", expected, changes)
+	}
+
+	// Fields of pointers set in both specs are compared one by one.
+	oldSpec = newSpec
+	newSpec.Cpu.Uclamp = &UclampSpec{Min: 20, Max: 100}
+	expected = []SpecChange{
+		{Field: "Cpu.Uclamp.Min", Old: float64(10), New: float64(20)},
+	}
+	if changes := SpecDiff(oldSpec, newSpec); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected changes %v, got %v", expected, changes)
+	}
+
+	if changes := SpecDiff(newSpec, newSpec); len(changes) != 0 {
+		t.Errorf("expected no changes between identical specs, got %v", changes)
+	}
+}
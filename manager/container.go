@@ -98,6 +98,26 @@ func (c *containerData) GetInfo() (*containerInfo, error) {
 	return &c.info, nil
 }
 
+// Returns the reference, subcontainers, spec and latest stats of the container
+// together. The spec and subcontainers are those cached by GetInfo. Stats is
+// empty until the first stats of the container are collected.
+func (c *containerData) GetContainerInfo() (*info.ContainerInfo, error) {
+	cinfo, err := c.GetInfo()
+	if err != nil {
+		return nil, err
+	}
+	stats, err := c.storageDriver.RecentStats(cinfo.Name, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &info.ContainerInfo{
+		ContainerReference: cinfo.ContainerReference,
+		Subcontainers:      cinfo.Subcontainers,
+		Spec:               cinfo.Spec,
+		Stats:              stats,
+	}, nil
+}
+
 func newContainerData(containerName string, driver storage.StorageDriver, handler container.ContainerHandler, loadReader cpuload.CpuLoadReader, logUsage bool) (*containerData, error) {
 	if driver == nil {
 		return nil, fmt.Errorf("nil storage driver")
@@ -165,7 +185,10 @@ func (c *containerData) housekeeping() {
 	for {
 		select {
 		case <-c.stop:
-			// Stop housekeeping when signaled.
+			// Cleanup and stop housekeeping when signaled.
+			if cleaner, ok := c.handler.(container.Cleaner); ok {
+				cleaner.Cleanup()
+			}
 			return
 		default:
 			// Perform housekeeping.
@@ -227,6 +250,10 @@ func (c *containerData) updateSpec() error {
 	}
 	c.lock.Lock()
 	defer c.lock.Unlock()
+	// The first spec read is not a change.
+	if changes := info.SpecDiff(c.info.Spec, spec); len(changes) != 0 && !c.lastUpdatedTime.IsZero() {
+		glog.V(2).Infof("Spec of container %q changed: %v", c.info.Name, changes)
+	}
 	c.info.Spec = spec
 	return nil
 }
@@ -188,3 +188,41 @@ func TestGetInfo(t *testing.T) {
 		t.Errorf("received wrong container name: received %v; should be %v", info.Name, mockHandler.Name)
 	}
 }
+
+func TestContainerDataGetContainerInfo(t *testing.T) {
+	mockHandler := container.NewMockContainerHandler("/docker/abc")
+	mockHandler.Aliases = []string{"abc", "web"}
+	mockDriver := &stest.MockStorageDriver{}
+	cd, err := newContainerData("/docker/abc", mockDriver, mockHandler, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := itest.GenerateRandomContainerSpec(4)
+	stats := itest.GenerateRandomStats(1, 4, 1*time.Second)
+	mockHandler.On("GetSpec").Return(spec, nil)
+	mockHandler.On("ListContainers", container.ListSelf).Return([]info.ContainerReference{}, nil)
+	mockDriver.On("RecentStats", "/docker/abc", 1).Return(stats, nil)
+
+	cinfo, err := cd.GetContainerInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cinfo.Aliases, mockHandler.Aliases) {
+		t.Errorf("expected aliases %v, got %v", mockHandler.Aliases, cinfo.Aliases)
+	}
+	if ancestry := cinfo.Ancestry(); !reflect.DeepEqual(ancestry, []string{"docker", "abc"}) {
+		t.Errorf("expected ancestry [docker abc], got %v", ancestry)
+	}
+	if !reflect.DeepEqual(cinfo.Spec, spec) {
+		t.Errorf("expected spec %+v, got %+v", spec, cinfo.Spec)
+	}
+	if !reflect.DeepEqual(cinfo.Stats, stats) {
+		t.Errorf("expected stats %v, got %v", stats, cinfo.Stats)
+	}
+
+	// The cached spec is reused.
+	if _, err := cd.GetContainerInfo(); err != nil {
+		t.Fatal(err)
+	}
+	mockHandler.AssertNumberOfCalls(t, "GetSpec", 1)
+}
@@ -22,6 +22,7 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	dclient "github.com/fsouza/go-dockerclient"
 	"github.com/google/cadvisor/container/docker"
@@ -37,6 +38,7 @@ var coreRegExp = regexp.MustCompile("core id\\t*: +([0-9]+)")
 var nodeRegExp = regexp.MustCompile("physical id\\t*: +([0-9]+)")
 var CpuClockSpeedMHz = regexp.MustCompile("cpu MHz\\t*: +([0-9]+.[0-9]+)")
 var memoryCapacityRegexp = regexp.MustCompile("MemTotal: *([0-9]+) kB")
+var kernelVersionRegexp = regexp.MustCompile("^Linux version ([^ ]+)")
 
 func getClockSpeed(procInfo []byte) (uint64, error) {
 	// First look through sys to find a max supported cpu frequency.
@@ -80,6 +82,43 @@ func getMemoryCapacity(b []byte) (int64, error) {
 	return m * 1024, err
 }
 
+// Gets the kernel version from the contents of /proc/version.
+func getKernelVersionFromProc(procVersion []byte) (string, error) {
+	matches := kernelVersionRegexp.FindSubmatch(procVersion)
+	if len(matches) != 2 {
+		return "", fmt.Errorf("failed to find kernel version in %q", string(procVersion))
+	}
+	return string(matches[1]), nil
+}
+
+// Gets the cgroup hierarchies mounted from the contents of /proc/mounts, empty
+// if there are none.
+func getCgroupVersion(mounts []byte) string {
+	hasV1, hasV2 := false, false
+	for _, line := range strings.Split(string(mounts), "\n") {
+		// "$SOURCE $MOUNTPOINT $FSTYPE $OPTIONS $DUMP $PASS"
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		switch fields[2] {
+		case "cgroup":
+			hasV1 = true
+		case "cgroup2":
+			hasV2 = true
+		}
+	}
+	switch {
+	case hasV1 && hasV2:
+		return info.CgroupHybrid
+	case hasV2:
+		return info.CgroupV2
+	case hasV1:
+		return info.CgroupV1
+	}
+	return ""
+}
+
 func extractValue(s string, r *regexp.Regexp) (bool, int, error) {
 	matches := r.FindSubmatch([]byte(s))
 	if len(matches) == 2 {
@@ -255,6 +294,25 @@ func getMachineInfo(sysFs sysfs.SysFs) (*info.MachineInfo, error) {
 		Topology:       topology,
 	}
 
+	// Prefer /proc/version, uname is the fallback.
+	machineInfo.KernelVersion = getKernelVersion()
+	if procVersion, err := ioutil.ReadFile("/proc/version"); err == nil {
+		if version, err := getKernelVersionFromProc(procVersion); err == nil {
+			machineInfo.KernelVersion = version
+		}
+	}
+	mounts, err := ioutil.ReadFile("/proc/mounts")
+	if err != nil {
+		return nil, err
+	}
+	machineInfo.CgroupVersion = getCgroupVersion(mounts)
+	// Left empty when unknown.
+	if onlineCpus, err := sysFs.GetOnlineCpus(); err == nil {
+		machineInfo.OnlineCpus = onlineCpus
+	}
+
+	// The capacity of a device is the same at all its mountpoints.
+	filesystems = fs.DedupeByDevice(filesystems)
 	for _, fs := range filesystems {
 		machineInfo.Filesystems = append(machineInfo.Filesystems, info.FsInfo{Device: fs.Device, Capacity: fs.Capacity})
 	}
@@ -262,6 +320,71 @@ func getMachineInfo(sysFs sysfs.SysFs) (*info.MachineInfo, error) {
 	return machineInfo, nil
 }
 
+// Returns the stats of the whole machine in the shape of container stats,
+// independently of the root cgroup: the cpu usage from /proc/stat, the memory
+// usage from /proc/meminfo, every filesystem and every network interface. The
+// network totals only include the network devices of the machine info, which
+// leave out the docker bridges, loopback and veth devices.
+func MachineStats(sysFs sysfs.SysFs, fsInfo fs.FsInfo) (*info.ContainerStats, error) {
+	stats := &info.ContainerStats{
+		Timestamp: time.Now(),
+	}
+	var err error
+	stats.Cpu, err = sysinfo.GetCpuStats("/proc/stat")
+	if err != nil {
+		return nil, err
+	}
+	stats.Memory, err = sysinfo.GetMemoryStats("/proc/meminfo")
+	if err != nil {
+		return nil, err
+	}
+
+	filesystems, err := fsInfo.GetGlobalFsInfo()
+	if err != nil {
+		return nil, err
+	}
+	for _, fs := range fs.DedupeByDevice(filesystems) {
+		stats.Filesystem = append(stats.Filesystem, info.FsStats{
+			Device:          fs.Device,
+			Mountpoint:      fs.Mountpoint,
+			Limit:           fs.Capacity,
+			Usage:           fs.Capacity - fs.Free,
+			ReadsCompleted:  fs.DiskStats.ReadsCompleted,
+			ReadsMerged:     fs.DiskStats.ReadsMerged,
+			SectorsRead:     fs.DiskStats.SectorsRead,
+			ReadTime:        fs.DiskStats.ReadTime,
+			WritesCompleted: fs.DiskStats.WritesCompleted,
+			WritesMerged:    fs.DiskStats.WritesMerged,
+			SectorsWritten:  fs.DiskStats.SectorsWritten,
+			WriteTime:       fs.DiskStats.WriteTime,
+			IoInProgress:    fs.DiskStats.IoInProgress,
+			IoTime:          fs.DiskStats.IoTime,
+			WeightedIoTime:  fs.DiskStats.WeightedIoTime,
+		})
+	}
+
+	stats.Network.Interfaces, err = sysinfo.GetAllNetworkStats(false)
+	if err != nil {
+		return nil, err
+	}
+	netDevices, err := sysinfo.GetNetworkDevices(sysFs)
+	if err != nil {
+		return nil, err
+	}
+	for _, device := range netDevices {
+		s := stats.Network.Interfaces[device.Name]
+		stats.Network.RxBytes += s.RxBytes
+		stats.Network.RxPackets += s.RxPackets
+		stats.Network.RxErrors += s.RxErrors
+		stats.Network.RxDropped += s.RxDropped
+		stats.Network.TxBytes += s.TxBytes
+		stats.Network.TxPackets += s.TxPackets
+		stats.Network.TxErrors += s.TxErrors
+		stats.Network.TxDropped += s.TxDropped
+	}
+	return stats, nil
+}
+
 func getVersionInfo() (*info.VersionInfo, error) {
 
 	kernel_version := getKernelVersion()
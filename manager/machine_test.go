@@ -0,0 +1,60 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/cadvisor/info"
+)
+
+func TestGetKernelVersionFromProc(t *testing.T) {
+	procVersion, err := ioutil.ReadFile("./testdata/version")
+	if err != nil {
+		t.Fatalf("unable to read input test file ./testdata/version")
+	}
+	version, err := getKernelVersionFromProc(procVersion)
+	if err != nil {
+		t.Fatalf("failed to get kernel version: %v", err)
+	}
+	if version != "5.4.0-42-generic" {
+		t.Errorf("expected kernel version %q, got %q", "5.4.0-42-generic", version)
+	}
+
+	if _, err := getKernelVersionFromProc([]byte("garbage")); err == nil {
+		t.Errorf("expected an error for an invalid /proc/version")
+	}
+}
+
+func TestGetCgroupVersion(t *testing.T) {
+	mounts, err := ioutil.ReadFile("./testdata/mounts_hybrid")
+	if err != nil {
+		t.Fatalf("unable to read input test file ./testdata/mounts_hybrid")
+	}
+	if version := getCgroupVersion(mounts); version != info.CgroupHybrid {
+		t.Errorf("expected cgroup version %q, got %q", info.CgroupHybrid, version)
+	}
+
+	for mounts, expected := range map[string]string{
+		"cgroup /sys/fs/cgroup/memory cgroup rw,memory 0 0\n": info.CgroupV1,
+		"cgroup2 /sys/fs/cgroup cgroup2 rw,nsdelegate 0 0\n":  info.CgroupV2,
+		"/dev/sda1 / ext4 rw 0 0\n":                           "",
+	} {
+		if version := getCgroupVersion([]byte(mounts)); version != expected {
+			t.Errorf("expected cgroup version %q for %q, got %q", expected, mounts, version)
+		}
+	}
+}
@@ -24,10 +24,10 @@ import (
 	"sync"
 	"time"
 
-	"github.com/docker/libcontainer/cgroups"
 	"github.com/golang/glog"
 	"github.com/google/cadvisor/container"
 	"github.com/google/cadvisor/container/docker"
+	"github.com/google/cadvisor/container/libcontainer"
 	"github.com/google/cadvisor/info"
 	"github.com/google/cadvisor/storage"
 	"github.com/google/cadvisor/utils/cpuload"
@@ -72,7 +72,7 @@ func New(driver storage.StorageDriver, sysfs sysfs.SysFs) (Manager, error) {
 	}
 
 	// Detect the container we are running on.
-	selfContainer, err := cgroups.GetThisCgroupDir("cpu")
+	selfContainer, err := libcontainer.GetThisCgroupDir("cpu")
 	if err != nil {
 		return nil, err
 	}
@@ -342,6 +342,20 @@ func (self *manager) DockerContainer(containerName string, query *info.Container
 	return *inf, nil
 }
 
+// Reads again the spec of the specified container after it changed.
+func (self *manager) updateContainerSpec(containerName string) error {
+	self.containersLock.RLock()
+	cont, ok := self.containers[namespacedContainerName{
+		Name: containerName,
+	}]
+	self.containersLock.RUnlock()
+	if !ok {
+		// Not tracked (yet), its spec is read when it is.
+		return nil
+	}
+	return cont.updateSpec()
+}
+
 func (self *manager) containerDataSliceToContainerInfoSlice(containers []*containerData, query *info.ContainerInfoRequest) ([]*info.ContainerInfo, error) {
 	if len(containers) == 0 {
 		return nil, fmt.Errorf("no containers found")
@@ -559,6 +573,8 @@ func (self *manager) watchForNewContainers(quit chan error) error {
 					err = self.createContainer(event.Name)
 				case event.EventType == container.SubcontainerDelete:
 					err = self.destroyContainer(event.Name)
+				case event.EventType == container.SubcontainerSpecChanged:
+					err = self.updateContainerSpec(event.Name)
 				}
 				if err != nil {
 					glog.Warning("Failed to process watch event: %v", err)
@@ -0,0 +1,64 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Clocks that can be replaced in tests of code depending on the current time.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+type Clock interface {
+	// Returns the current time.
+	Now() time.Time
+}
+
+// Clock returning the time of the system.
+type RealClock struct{}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// Clock returning a fixed time, only changed explicitly. Safe for concurrent
+// use.
+type FakeClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (self *FakeClock) Now() time.Time {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.now
+}
+
+// Sets the time of the clock.
+func (self *FakeClock) SetTime(now time.Time) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.now = now
+}
+
+// Moves the time of the clock forward by d.
+func (self *FakeClock) Step(d time.Duration) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.now = self.now.Add(d)
+}
@@ -26,8 +26,14 @@ func (osFS) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
 
 var fs FileSystem = osFS{}
 
+// Returns the file system of the host, regardless of ChangeFileSystem.
+func OsFileSystem() FileSystem {
+	return osFS{}
+}
+
 type FileSystem interface {
 	Open(name string) (File, error)
+	Stat(name string) (os.FileInfo, error)
 }
 
 type File interface {
@@ -42,3 +48,7 @@ func ChangeFileSystem(filesystem FileSystem) {
 func Open(name string) (File, error) {
 	return fs.Open(name)
 }
+
+func Stat(name string) (os.FileInfo, error) {
+	return fs.Stat(name)
+}
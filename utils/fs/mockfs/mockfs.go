@@ -18,6 +18,8 @@
 package mockfs
 
 import (
+	os "os"
+
 	gomock "code.google.com/p/gomock/gomock"
 	fs "github.com/google/cadvisor/utils/fs"
 )
@@ -53,3 +55,14 @@ func (_m *MockFileSystem) Open(_param0 string) (fs.File, error) {
 func (_mr *_MockFileSystemRecorder) Open(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Open", arg0)
 }
+
+func (_m *MockFileSystem) Stat(_param0 string) (os.FileInfo, error) {
+	ret := _m.ctrl.Call(_m, "Stat", _param0)
+	ret0, _ := ret[0].(os.FileInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockFileSystemRecorder) Stat(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Stat", arg0)
+}
@@ -16,28 +16,124 @@ package oomparser
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/google/cadvisor/utils"
+	"github.com/google/cadvisor/utils/clock"
 )
 
 var containerRegexp *regexp.Regexp = regexp.MustCompile(
 	`Task in (.*) killed as a result of limit of `)
+
+// matches the line reporting the killed process, e.g.
+// "Jan 21 22:01:49 localhost kernel: [62279.421192] Killed process 19667 (evilprogram2) total-vm:1460016kB, ..."
+// newer kernels prefix it with "Memory cgroup out of memory: " or "Out of memory: ".
+// process names may contain any character, including spaces and parentheses.
+// lines read from the kernel log keep their trailing newline.
 var lastLineRegexp *regexp.Regexp = regexp.MustCompile(
-	`(^[A-Z]{1}[a-z]{2} .*[0-9]{1,2} [0-9]{1,2}:[0-9]{2}:[0-9]{2}) .* Killed process ([0-9]+) \(([0-9A-Za-z_]+)\)`)
+	`^([A-Z][a-z]{2} +[0-9]{1,2} [0-9]{1,2}:[0-9]{2}:[0-9]{2}) .* (?:(?:Memory cgroup out of memory|Out of memory): )?Killed process ([0-9]+) \((.+?)\)(?: total-vm:|\n?$)`)
 var firstLineRegexp *regexp.Regexp = regexp.MustCompile(
 	`invoked oom-killer:`)
+var lineTimeRegexp *regexp.Regexp = regexp.MustCompile(
+	`^([A-Z][a-z]{2} +[0-9]{1,2} [0-9]{1,2}:[0-9]{2}:[0-9]{2}) `)
+var constraintRegexp *regexp.Regexp = regexp.MustCompile(
+	`oom-kill:constraint=([A-Z_]+)`)
+var groupKillRegexp *regexp.Regexp = regexp.MustCompile(
+	`Tasks in (.*) are going to be killed due to memory.oom.group set`)
+
+// bounds of an OOM report that ends without a killed process: the lines logged
+// more than maxOomReportDuration after the oom-killer was invoked, and those
+// past the first maxOomReportLines, are not part of it. when following the log,
+// the report also ends after waiting reportTimeout for more lines.
+const maxOomReportLines = 10000
+const maxOomReportDuration = 10 * time.Second
+
+// default interval between checks for lines appended at the end of a followed
+// log.
+const logPollInterval = 100 * time.Millisecond
+
+// returned by readLine when no line was appended to the log in time.
+var errLogTimeout = errors.New("timed out waiting for the log")
+
+// Constraints reported by the kernel for an OOM kill.
+const (
+	// The kill was caused by the memory limit of a cgroup.
+	ConstraintMemcg = "CONSTRAINT_MEMCG"
+	// The kill was caused by global memory pressure.
+	ConstraintNone = "CONSTRAINT_NONE"
+)
+
+// Default regexp used to extract labels from the cgroup path of a Kubernetes
+// pod, e.g. /kubepods/burstable/pod<uid>/<container>. Every named group that
+// matches becomes a label on the OomInstance.
+var KubepodsLabelRegexp *regexp.Regexp = regexp.MustCompile(
+	`^/kubepods(?:/(?P<qos_class>besteffort|burstable))?/pod(?P<pod_uid>[0-9a-fA-F_-]+)(?:/(?P<container_name>[^/]+))?`)
 
 // struct to hold file from which we obtain OomInstances
 type OomParser struct {
 	systemFile string
+	// optional regexp whose named groups are extracted as labels from the
+	// container name of each OomInstance
+	labelRegexp *regexp.Regexp
+	// optional mapper from the name of the killed process to a workload
+	workloadMapper WorkloadMapper
+	// optional provider of the last-known memory stats of the container of
+	// each OomInstance
+	memoryStatsProvider MemoryStatsProvider
+	// optional container name prefix, the OomInstances of other containers
+	// are dropped
+	containerPrefix string
+	// clock used to complete the times of death, which have no year. the
+	// real clock if nil
+	clock clock.Clock
+	// time to wait for more lines at the end of the followed log before an
+	// OOM report without a kill ends, maxOomReportDuration if zero
+	reportTimeout time.Duration
+	// interval between checks for lines appended at the end of the followed
+	// log, logPollInterval if zero
+	pollInterval time.Duration
+}
+
+// maps the name of a killed process to the name of the workload it belongs to.
+// Returns the empty string if the process belongs to no known workload.
+type WorkloadMapper func(processName string) string
+
+// returns a WorkloadMapper that looks up process names in table.
+func NewTableWorkloadMapper(table map[string]string) WorkloadMapper {
+	return func(processName string) string {
+		return table[processName]
+	}
+}
+
+// gets the last-known memory stats of the container with the specified
+// absolute name. Returns nil if the container is unknown.
+type MemoryStatsProvider func(containerName string) *MemorySnapshot
+
+// the memory stats of a container last known before an OOM
+type MemorySnapshot struct {
+	// time at which the stats were collected
+	Timestamp time.Time
+	// memory usage, including the page cache
+	// Units: Bytes.
+	Usage uint64
+	// working set memory, the usage without the inactive memory
+	// Units: Bytes.
+	WorkingSet uint64
+	// page cache memory, zero if unknown to the provider
+	// Units: Bytes.
+	Cache uint64
+	// memory limit of the container, zero if unlimited or unknown
+	// Units: Bytes.
+	Limit uint64
 }
 
 // struct that contains information related to an OOM kill instance
@@ -46,11 +142,116 @@ type OomInstance struct {
 	Pid int
 	// the name of the killed process
 	ProcessName string
-	// the time that the process was reported to be killed,
-	// accurate to the minute
+	// the time that the process was reported to be killed, or the time the
+	// oom-killer was invoked if no process was killed,
+	// accurate to the minute. the log has no year, it is the latest year
+	// that does not put the time in the future
 	TimeOfDeath time.Time
 	// the absolute name of the container that OOMed
 	ContainerName string
+	// labels extracted from the container name, if a label regexp is set
+	Labels map[string]string
+	// the constraint that caused the kill (e.g. ConstraintMemcg or
+	// ConstraintNone), empty if the kernel did not report one
+	Constraint string
+	// the workload of the killed process, if a workload mapper is set
+	WorkloadName string
+	// whether all the processes of the cgroup were killed together because
+	// memory.oom.group is set
+	GroupKill bool
+	// the other processes killed together with the killed process in a group
+	// kill
+	GroupKilledProcesses []KilledProcess
+	// whether a process was killed. false if the oom-killer was invoked but
+	// the OOM ended without a kill, e.g. because reclaim succeeded or the
+	// oom killer is disabled for the cgroup. Pid and ProcessName are then
+	// unset
+	Killed bool
+	// the last-known memory stats of the container, if a memory stats
+	// provider is set and knows the container
+	MemorySnapshot *MemorySnapshot
+}
+
+// a process killed together with others in a group kill
+type KilledProcess struct {
+	Pid         int
+	ProcessName string
+}
+
+// sets the regexp used to extract labels from the container name of every
+// OomInstance. Only named groups are used, a nil regexp disables labels.
+func (self *OomParser) SetLabelRegexp(re *regexp.Regexp) {
+	self.labelRegexp = re
+}
+
+// sets the mapper used to attribute the killed process of every OomInstance
+// to a workload. A nil mapper disables the attribution.
+func (self *OomParser) SetWorkloadMapper(mapper WorkloadMapper) {
+	self.workloadMapper = mapper
+}
+
+// sets the provider of the memory stats attached to every OomInstance. A nil
+// provider disables the snapshots.
+func (self *OomParser) SetMemoryStatsProvider(provider MemoryStatsProvider) {
+	self.memoryStatsProvider = provider
+}
+
+// sets the container name prefix of the OomInstances streamed, e.g.
+// "/kubepods". The prefix matches whole components of the name: "/kubepods"
+// matches "/kubepods" and "/kubepods/pod1" but not "/kubepods2". An empty
+// prefix streams the OomInstances of all containers.
+func (self *OomParser) SetContainerPrefix(prefix string) {
+	self.containerPrefix = prefix
+}
+
+// returns whether the container name is prefix or a descendant of it.
+func hasContainerPrefix(containerName string, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" || containerName == prefix {
+		return true
+	}
+	return strings.HasPrefix(containerName, prefix+"/")
+}
+
+// sets the clock used to complete the times of death.
+func (self *OomParser) SetClock(c clock.Clock) {
+	self.clock = c
+}
+
+func (self *OomParser) now() time.Time {
+	if self.clock == nil {
+		return time.Now()
+	}
+	return self.clock.Now()
+}
+
+// sets the year of a time of death parsed from the log to the year of now,
+// or to the previous year if that puts it more than a day after now (e.g. a
+// kill logged on Dec 31 and read on Jan 1). the tolerance covers the skew
+// between the clock of the log and now.
+func setYear(timeOfDeath time.Time, now time.Time) time.Time {
+	withYear := timeOfDeath.AddDate(now.Year()-timeOfDeath.Year(), 0, 0)
+	if withYear.After(now.Add(24 * time.Hour)) {
+		withYear = withYear.AddDate(-1, 0, 0)
+	}
+	return withYear
+}
+
+// gets the labels from the named groups of re that matched containerName.
+// Returns nil if re does not match.
+func getContainerLabels(containerName string, re *regexp.Regexp) map[string]string {
+	match := re.FindStringSubmatch(containerName)
+	if match == nil {
+		return nil
+	}
+	labels := make(map[string]string)
+	for i, name := range re.SubexpNames() {
+		if name == "" || match[i] == "" {
+			continue
+		}
+		labels[name] = match[i]
+	}
+	return labels
 }
 
 // gets the container name from a line and adds it to the oomInstance.
@@ -63,7 +264,18 @@ func getContainerName(line string, currentOomInstance *OomInstance) error {
 	return nil
 }
 
-// gets the pid, name, and date from a line and adds it to oomInstance
+// gets the oom-kill constraint from a line and adds it to the oomInstance.
+func getConstraint(line string, currentOomInstance *OomInstance) {
+	parsedLine := constraintRegexp.FindStringSubmatch(line)
+	if parsedLine == nil {
+		return
+	}
+	currentOomInstance.Constraint = parsedLine[1]
+}
+
+// gets the pid, name, and time of death of the killed process. lines that are
+// not recognized, including malformed ones, are skipped by returning false
+// and leave currentOomInstance untouched.
 func getProcessNamePid(line string, currentOomInstance *OomInstance) (bool, error) {
 	reList := lastLineRegexp.FindStringSubmatch(line)
 	if reList == nil {
@@ -71,21 +283,97 @@ func getProcessNamePid(line string, currentOomInstance *OomInstance) (bool, erro
 	}
 	linetime, err := time.Parse(time.Stamp, reList[1])
 	if err != nil {
-		return false, err
-	}
-	currentOomInstance.TimeOfDeath = linetime
-	if err != nil {
-		return false, err
+		return false, nil
 	}
 	pid, err := strconv.Atoi(reList[2])
 	if err != nil {
-		return false, err
+		return false, nil
 	}
+	currentOomInstance.TimeOfDeath = linetime
 	currentOomInstance.Pid = pid
 	currentOomInstance.ProcessName = reList[3]
 	return true, nil
 }
 
+// gets the time of a line of the log, used as the time of an OOM until a kill
+// is found. lines without a time leave currentOomInstance untouched.
+func getLineTime(line string, currentOomInstance *OomInstance) {
+	if linetime, ok := parseLineTime(line); ok {
+		currentOomInstance.TimeOfDeath = linetime
+	}
+}
+
+// parses the time at the start of a line of the log, which has no year.
+func parseLineTime(line string) (time.Time, bool) {
+	parsedLine := lineTimeRegexp.FindStringSubmatch(line)
+	if parsedLine == nil {
+		return time.Time{}, false
+	}
+	linetime, err := time.Parse(time.Stamp, parsedLine[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return linetime, true
+}
+
+func (self *OomParser) getReportTimeout() time.Duration {
+	if self.reportTimeout == 0 {
+		return maxOomReportDuration
+	}
+	return self.reportTimeout
+}
+
+// returns whether a line of the log, the count-th after the one invoking the
+// oom-killer at invoked, still belongs to the OOM report. the report ends at
+// the next invocation, at its bounds, or after the oom-kill constraint line
+// when the next kernel line is not a kill: the constraint line is the last one
+// of the report and the kill immediately follows it.
+func inOomReport(line string, count int, invoked time.Time, afterConstraint bool) bool {
+	if firstLineRegexp.MatchString(line) || count >= maxOomReportLines {
+		return false
+	}
+	if linetime, ok := parseLineTime(line); ok && !invoked.IsZero() && linetime.Sub(invoked) > maxOomReportDuration {
+		return false
+	}
+	if afterConstraint && strings.Contains(line, " kernel: ") && !lastLineRegexp.MatchString(line) {
+		return false
+	}
+	return true
+}
+
+// reads the lines of a log, following it as it is appended to if follow is
+// set.
+type logReader struct {
+	reader       *bufio.Reader
+	follow       bool
+	pollInterval time.Duration
+	// start of the last line of the log, whose end was not logged yet
+	partial string
+}
+
+// reads the next line of the log. at the end of a followed log, waits up to
+// timeout for a line to be appended, forever if timeout is 0, and returns
+// errLogTimeout when none was. returns io.EOF at the end of a log that is not
+// followed.
+func (self *logReader) readLine(timeout time.Duration) (string, error) {
+	start := time.Now()
+	for {
+		line, err := self.reader.ReadString('\n')
+		self.partial += line
+		if err == nil {
+			line, self.partial = self.partial, ""
+			return line, nil
+		}
+		if err != io.EOF || !self.follow {
+			return "", err
+		}
+		if timeout > 0 && time.Since(start) >= timeout {
+			return "", errLogTimeout
+		}
+		time.Sleep(self.pollInterval)
+	}
+}
+
 // uses regex to see if line is the start of a kernel oom log
 func checkIfStartOfOomMessages(line string) (bool, error) {
 	potential_oom_start := firstLineRegexp.MatchString(line)
@@ -97,44 +385,101 @@ func checkIfStartOfOomMessages(line string) (bool, error) {
 
 // opens a reader to grab new messages from the Reader object called outPipe
 // opened in PopulateOomInformation.  It reads line by line splitting on
-// the "\n" character.  Checks if line might be start or end of an oom message
-// log. Then the
+// the "\n" character, following outPipe as it is appended to if follow is set.
+// Checks if line might be start or end of an oom message log. Then the
 // lines are checked against a regexp to check for the pid, process name, etc.
 // At the end of an oom message group, AnalyzeLines adds the new oomInstance to
-// oomLog
-func (self *OomParser) analyzeLines(outPipe io.ReadCloser, outStream chan *OomInstance) {
-	ioreader := bufio.NewReader(outPipe)
-	line, err := ioreader.ReadString('\n')
+// oomLog. A group that ends without a killed process, at the start of the
+// next group, at the end of the kernel report or at the bounds of a report,
+// is added with Killed unset. The end of a followed log does not end a group
+// until no line was appended for the report timeout
+func (self *OomParser) analyzeLines(outPipe io.ReadCloser, follow bool, outStream chan *OomInstance) {
+	log := &logReader{reader: bufio.NewReader(outPipe), follow: follow, pollInterval: self.pollInterval}
+	if log.pollInterval == 0 {
+		log.pollInterval = logPollInterval
+	}
+	line, err := log.readLine(0)
 	for err == nil {
-		in_oom_kernel_log, err := checkIfStartOfOomMessages(line)
-		if err != nil {
-			glog.Errorf("%v", err)
+		in_oom_kernel_log, checkErr := checkIfStartOfOomMessages(line)
+		if checkErr != nil {
+			glog.Errorf("%v", checkErr)
+		}
+		if !in_oom_kernel_log {
+			line, err = log.readLine(0)
 			continue
 		}
-		if in_oom_kernel_log {
-			oomCurrentInstance := &OomInstance{
-				ContainerName: "/",
+		oomCurrentInstance := &OomInstance{
+			ContainerName: "/",
+		}
+		getLineTime(line, oomCurrentInstance)
+		invoked := oomCurrentInstance.TimeOfDeath
+		finished := false
+		afterConstraint := false
+		for count := 0; err == nil && !finished; count++ {
+			if count > 0 && !inOomReport(line, count, invoked, afterConstraint) {
+				break
 			}
-			finished := false
-			for err == nil && !finished {
-				err = getContainerName(line, oomCurrentInstance)
-				if err != nil {
-					glog.Errorf("%v", err)
-				}
-				finished, err = getProcessNamePid(line, oomCurrentInstance)
-				if err != nil {
-					glog.Errorf("%v", err)
+			err = getContainerName(line, oomCurrentInstance)
+			if err != nil {
+				glog.Errorf("%v", err)
+			}
+			getConstraint(line, oomCurrentInstance)
+			afterConstraint = afterConstraint || constraintRegexp.MatchString(line)
+			finished, err = getProcessNamePid(line, oomCurrentInstance)
+			if err != nil {
+				glog.Errorf("%v", err)
+			}
+			oomCurrentInstance.Killed = finished
+			line, err = log.readLine(self.getReportTimeout())
+		}
+		// the kernel kills the rest of the cgroup after the killed process
+		// when memory.oom.group is set.
+		if err == nil && groupKillRegexp.MatchString(line) {
+			oomCurrentInstance.GroupKill = true
+			line, err = log.readLine(self.getReportTimeout())
+			for err == nil {
+				member := new(OomInstance)
+				if killed, _ := getProcessNamePid(line, member); !killed {
+					break
 				}
-				line, err = ioreader.ReadString('\n')
+				oomCurrentInstance.GroupKilledProcesses = append(oomCurrentInstance.GroupKilledProcesses, KilledProcess{
+					Pid:         member.Pid,
+					ProcessName: member.ProcessName,
+				})
+				line, err = log.readLine(self.getReportTimeout())
 			}
-			in_oom_kernel_log = false
-			outStream <- oomCurrentInstance
 		}
-		line, err = ioreader.ReadString('\n')
+		self.sendOomInstance(oomCurrentInstance, outStream)
+		// nothing was logged after the report for a while, wait for the
+		// next line.
+		if err == errLogTimeout {
+			line, err = log.readLine(0)
+		}
 	}
 	glog.Errorf("%v", err)
 }
 
+// completes an oomInstance and adds it to outStream, unless its container
+// does not have the container prefix of the OomParser.
+func (self *OomParser) sendOomInstance(oomCurrentInstance *OomInstance, outStream chan *OomInstance) {
+	if !hasContainerPrefix(oomCurrentInstance.ContainerName, self.containerPrefix) {
+		return
+	}
+	if !oomCurrentInstance.TimeOfDeath.IsZero() {
+		oomCurrentInstance.TimeOfDeath = setYear(oomCurrentInstance.TimeOfDeath, self.now())
+	}
+	if self.labelRegexp != nil {
+		oomCurrentInstance.Labels = getContainerLabels(oomCurrentInstance.ContainerName, self.labelRegexp)
+	}
+	if self.workloadMapper != nil {
+		oomCurrentInstance.WorkloadName = self.workloadMapper(oomCurrentInstance.ProcessName)
+	}
+	if self.memoryStatsProvider != nil {
+		oomCurrentInstance.MemorySnapshot = self.memoryStatsProvider(oomCurrentInstance.ContainerName)
+	}
+	outStream <- oomCurrentInstance
+}
+
 // looks for system files that contain kernel messages and if one is found, sets
 // the systemFile attribute of the OomParser object
 func getSystemFile() (string, error) {
@@ -160,7 +505,7 @@ func (self *OomParser) StreamOoms(outStream chan *OomInstance) error {
 	if err != nil {
 		return err
 	}
-	go self.analyzeLines(file, outStream)
+	go self.analyzeLines(file, true, outStream)
 	return nil
 }
 
@@ -172,5 +517,6 @@ func New() (*OomParser, error) {
 		return nil, err
 	}
 	return &OomParser{
-		systemFile: systemFileName}, nil
+		systemFile: systemFileName,
+		clock:      clock.RealClock{}}, nil
 }
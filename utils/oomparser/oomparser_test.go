@@ -15,16 +15,30 @@
 package oomparser
 
 import (
+	"io"
+	"io/ioutil"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/google/cadvisor/utils/clock"
 )
 
 const startLine = "Jan 21 22:01:49 localhost kernel: [62278.816267] ruby invoked oom-killer: gfp_mask=0x201da, order=0, oom_score_adj=0"
 const endLine = "Jan 21 22:01:49 localhost kernel: [62279.421192] Killed process 19667 (evilprogram2) total-vm:1460016kB, anon-rss:1414008kB, file-rss:4kB"
 const containerLine = "Jan 26 14:10:07 kateknister0.mtv.corp.google.com kernel: [1814368.465205] Task in /mem2 killed as a result of limit of /mem2"
+const kubepodsContainerName = "/kubepods/burstable/pod2f5b1a4e-6c33-11e9-8f9e-42010a800235/1c5ad29e1f3e"
+const constraintLine = "Mar 12 09:41:17 kernel: [88212.331482] oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=1c5ad29e1f3e,mems_allowed=0,task=stress,pid=31057,uid=0"
 const containerLogFile = "containerOomExampleLog.txt"
+const constraintLogFile = "constraintOomExampleLog.txt"
 const systemLogFile = "systemOomExampleLog.txt"
+const groupLogFile = "groupOomExampleLog.txt"
+const reclaimLogFile = "reclaimOomExampleLog.txt"
+
+// time at which the test logs are read, the year of their times of death.
+var testNow = time.Date(2015, time.December, 31, 12, 0, 0, 0, time.UTC)
 
 func createExpectedContainerOomInstance(t *testing.T) *OomInstance {
 	deathTime, err := time.Parse(time.Stamp, "Jan  5 15:19:27")
@@ -35,8 +49,9 @@ func createExpectedContainerOomInstance(t *testing.T) *OomInstance {
 	return &OomInstance{
 		Pid:           13536,
 		ProcessName:   "memorymonster",
-		TimeOfDeath:   deathTime,
+		TimeOfDeath:   deathTime.AddDate(testNow.Year(), 0, 0),
 		ContainerName: "/mem2",
+		Killed:        true,
 	}
 }
 
@@ -49,8 +64,25 @@ func createExpectedSystemOomInstance(t *testing.T) *OomInstance {
 	return &OomInstance{
 		Pid:           1532,
 		ProcessName:   "badsysprogram",
-		TimeOfDeath:   deathTime,
+		TimeOfDeath:   deathTime.AddDate(testNow.Year(), 0, 0),
 		ContainerName: "/",
+		Killed:        true,
+	}
+}
+
+func createExpectedConstraintOomInstance(t *testing.T) *OomInstance {
+	deathTime, err := time.Parse(time.Stamp, "Mar 12 09:41:17")
+	if err != nil {
+		t.Fatalf("could not parse expected time when creating expected constraint oom instance. Had error %v", err)
+		return nil
+	}
+	return &OomInstance{
+		Pid:           31057,
+		ProcessName:   "stress",
+		TimeOfDeath:   deathTime.AddDate(testNow.Year(), 0, 0),
+		ContainerName: "/",
+		Constraint:    ConstraintMemcg,
+		Killed:        true,
 	}
 }
 
@@ -72,6 +104,35 @@ func TestGetContainerName(t *testing.T) {
 	}
 }
 
+func TestGetContainerLabels(t *testing.T) {
+	labels := getContainerLabels(kubepodsContainerName, KubepodsLabelRegexp)
+	expectedLabels := map[string]string{
+		"qos_class":      "burstable",
+		"pod_uid":        "2f5b1a4e-6c33-11e9-8f9e-42010a800235",
+		"container_name": "1c5ad29e1f3e",
+	}
+	if !reflect.DeepEqual(labels, expectedLabels) {
+		t.Errorf("getContainerLabels should have returned %v, not %v", expectedLabels, labels)
+	}
+
+	labels = getContainerLabels("/mem2", KubepodsLabelRegexp)
+	if labels != nil {
+		t.Errorf("non-kubepods container name fed to getContainerLabels should yield no labels, but had %v", labels)
+	}
+}
+
+func TestGetConstraint(t *testing.T) {
+	currentOomInstance := new(OomInstance)
+	getConstraint(startLine, currentOomInstance)
+	if currentOomInstance.Constraint != "" {
+		t.Errorf("bad line fed to getConstraint yielded no constraint but set it to %s", currentOomInstance.Constraint)
+	}
+	getConstraint(constraintLine, currentOomInstance)
+	if currentOomInstance.Constraint != ConstraintMemcg {
+		t.Errorf("getConstraint should have set constraint to %s, not %s", ConstraintMemcg, currentOomInstance.Constraint)
+	}
+}
+
 func TestGetProcessNamePid(t *testing.T) {
 	currentOomInstance := new(OomInstance)
 	couldParseLine, err := getProcessNamePid(startLine, currentOomInstance)
@@ -101,6 +162,64 @@ func TestGetProcessNamePid(t *testing.T) {
 	}
 }
 
+const memcgEndLine = "Mar 12 09:41:17 kernel: [88212.331494] Memory cgroup out of memory: Killed process 31057 (stress) total-vm:268328kB, anon-rss:261068kB, file-rss:576kB, shmem-rss:0kB"
+const outOfMemoryEndLine = "Jun  3 11:02:54 node-1 kernel: [ 8120.410223] Out of memory: Killed process 2211 (kube-apiserver) total-vm:1208412kB, anon-rss:412204kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:1232kB oom_score_adj:-998"
+
+func TestGetProcessNamePidVariants(t *testing.T) {
+	testCases := []struct {
+		line        string
+		pid         int
+		processName string
+		time        string
+	}{
+		{endLine, 19667, "evilprogram2", "Jan 21 22:01:49"},
+		{memcgEndLine, 31057, "stress", "Mar 12 09:41:17"},
+		{outOfMemoryEndLine, 2211, "kube-apiserver", "Jun  3 11:02:54"},
+		{"Jan 21 22:01:49 localhost kernel: [62279.421192] Killed process 512 (python3.8 app) total-vm:1460016kB", 512, "python3.8 app", "Jan 21 22:01:49"},
+		// Older kernels end the line after the process name.
+		{"Jan 21 22:01:49 localhost kernel: [62279.421192] Killed process 512 (worker (2))\n", 512, "worker (2)", "Jan 21 22:01:49"},
+		{"Jan 21 22:01:49 localhost kernel: [62279.421192] Killed process 512 (worker)", 512, "worker", "Jan 21 22:01:49"},
+	}
+	for _, tc := range testCases {
+		currentOomInstance := new(OomInstance)
+		couldParseLine, err := getProcessNamePid(tc.line, currentOomInstance)
+		if err != nil || !couldParseLine {
+			t.Errorf("line %q should be parsed, got %v with error %v", tc.line, couldParseLine, err)
+			continue
+		}
+		correctTime, _ := time.Parse(time.Stamp, tc.time)
+		expected := &OomInstance{
+			Pid:         tc.pid,
+			ProcessName: tc.processName,
+			TimeOfDeath: correctTime,
+		}
+		if !reflect.DeepEqual(currentOomInstance, expected) {
+			t.Errorf("line %q parsed as %+v, expected %+v", tc.line, currentOomInstance, expected)
+		}
+	}
+}
+
+func TestGetProcessNamePidMalformed(t *testing.T) {
+	malformedLines := []string{
+		"Jan 21 22:01:49 localhost kernel: [62279.421192] Killed process (evilprogram2) total-vm:1460016kB",
+		"Jan 21 22:01:49 localhost kernel: [62279.421192] Killed process 19667 evilprogram2 total-vm:1460016kB",
+		"Jan 21 22:01:49 localhost kernel: [62279.421192] Killed process 19667 (evilprogram2",
+		"Jan 21 22:01:49 localhost kernel: [62279.421192] Killed process 99999999999999999999 (evilprogram2) total-vm:1460016kB",
+		"Foo 21 22:01:49 localhost kernel: [62279.421192] Killed process 19667 (evilprogram2) total-vm:1460016kB",
+		"Killed process 19667 (evilprogram2) total-vm:1460016kB",
+	}
+	for _, line := range malformedLines {
+		currentOomInstance := new(OomInstance)
+		couldParseLine, err := getProcessNamePid(line, currentOomInstance)
+		if err != nil || couldParseLine {
+			t.Errorf("malformed line %q should be skipped, got %v with error %v", line, couldParseLine, err)
+		}
+		if !reflect.DeepEqual(currentOomInstance, new(OomInstance)) {
+			t.Errorf("malformed line %q should not change the oom instance, got %+v", line, currentOomInstance)
+		}
+	}
+}
+
 func TestCheckIfStartOfMessages(t *testing.T) {
 	couldParseLine, err := checkIfStartOfOomMessages(endLine)
 	if err != nil {
@@ -129,10 +248,295 @@ func TestAnalyzeLinesSystemOom(t *testing.T) {
 	helpTestAnalyzeLines(expectedSystemOomInstance, systemLogFile, t)
 }
 
-func helpTestAnalyzeLines(oomCheckInstance *OomInstance, sysFile string, t *testing.T) {
+func TestAnalyzeLinesConstraintOom(t *testing.T) {
+	expectedConstraintOomInstance := createExpectedConstraintOomInstance(t)
+	helpTestAnalyzeLines(expectedConstraintOomInstance, constraintLogFile, t)
+}
+
+func TestAnalyzeLinesGroupOom(t *testing.T) {
+	deathTime, err := time.Parse(time.Stamp, "Jul  8 16:20:33")
+	if err != nil {
+		t.Fatalf("could not parse expected time when creating expected group oom instance. Had error %v", err)
+	}
+	expectedGroupOomInstance := &OomInstance{
+		Pid:           4122,
+		ProcessName:   "nginx",
+		TimeOfDeath:   deathTime.AddDate(testNow.Year(), 0, 0),
+		ContainerName: "/",
+		Constraint:    ConstraintMemcg,
+		GroupKill:     true,
+		GroupKilledProcesses: []KilledProcess{
+			{Pid: 4120, ProcessName: "nginx"},
+			{Pid: 4121, ProcessName: "nginx"},
+		},
+		Killed: true,
+	}
+	helpTestAnalyzeLines(expectedGroupOomInstance, groupLogFile, t)
+}
+
+func TestAnalyzeLinesReclaimedOom(t *testing.T) {
+	invokeTime, err := time.Parse(time.Stamp, "Apr  3 11:02:14")
+	if err != nil {
+		t.Fatalf("could not parse expected time when creating expected reclaimed oom instance. Had error %v", err)
+	}
+	deathTime, err := time.Parse(time.Stamp, "Apr  3 11:02:19")
+	if err != nil {
+		t.Fatalf("could not parse expected time when creating expected killed oom instance. Had error %v", err)
+	}
+	expectedOomInstances := []*OomInstance{
+		{
+			TimeOfDeath:   invokeTime.AddDate(testNow.Year(), 0, 0),
+			ContainerName: "/mem3",
+		},
+		{
+			Pid:           8840,
+			ProcessName:   "cachewarmer",
+			TimeOfDeath:   deathTime.AddDate(testNow.Year(), 0, 0),
+			ContainerName: "/mem3",
+			Killed:        true,
+		},
+	}
+
+	outStream := make(chan *OomInstance)
+	oomLog := new(OomParser)
+	oomLog.SetClock(clock.NewFakeClock(testNow))
+	file, err := os.Open(reclaimLogFile)
+	if err != nil {
+		t.Fatalf("couldn't open test log: %v", err)
+	}
+	go oomLog.analyzeLines(file, false, outStream)
+	for _, expected := range expectedOomInstances {
+		select {
+		case oomInstance := <-outStream:
+			if !reflect.DeepEqual(*expected, *oomInstance) {
+				t.Errorf("wrong instance returned. Expected %v and got %v", expected, oomInstance)
+			}
+		case <-time.After(1 * time.Second):
+			t.Fatal("timeout happened before oomInstance was found in test file")
+		}
+	}
+}
+
+// reads the OomInstances analyzeLines finds in log, which is not followed.
+func analyzeLog(t *testing.T, log string) []*OomInstance {
+	oomLog := new(OomParser)
+	oomLog.SetClock(clock.NewFakeClock(testNow))
+	outStream := make(chan *OomInstance)
+	done := make(chan struct{})
+	var oomInstances []*OomInstance
+	go func() {
+		for oomInstance := range outStream {
+			oomInstances = append(oomInstances, oomInstance)
+		}
+		close(done)
+	}()
+	oomLog.analyzeLines(ioutil.NopCloser(strings.NewReader(log)), false, outStream)
+	close(outStream)
+	<-done
+	return oomInstances
+}
+
+func TestAnalyzeLinesReportBounds(t *testing.T) {
+	invokeTime, err := time.Parse(time.Stamp, "Apr  3 11:02:14")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reclaimed := &OomInstance{
+		TimeOfDeath:   invokeTime.AddDate(testNow.Year(), 0, 0),
+		ContainerName: "/mem3",
+		Constraint:    ConstraintMemcg,
+	}
+	for _, test := range []struct {
+		description string
+		log         string
+	}{
+		{
+			"report ending at the constraint line",
+			"Apr  3 11:02:14 kernel: [40211.118203] cachewarmer invoked oom-killer: gfp_mask=0xd0, order=0, oom_score_adj=0\n" +
+				"Apr  3 11:02:14 kernel: [40211.118214] Task in /mem3 killed as a result of limit of /mem3\n" +
+				"Apr  3 11:02:14 kernel: [40211.118216] oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=/,mems_allowed=0\n" +
+				"Apr  3 11:02:14 kernel: [40211.118300] eth0: link up\n" +
+				"Apr  3 11:02:14 kernel: [40211.118400] Killed process 8840 (cachewarmer) total-vm:538112kB, anon-rss:523968kB, file-rss:12kB\n",
+		},
+		{
+			"kill logged long after the report",
+			"Apr  3 11:02:14 kernel: [40211.118203] cachewarmer invoked oom-killer: gfp_mask=0xd0, order=0, oom_score_adj=0\n" +
+				"Apr  3 11:02:14 kernel: [40211.118214] Task in /mem3 killed as a result of limit of /mem3\n" +
+				"Apr  3 11:02:14 kernel: [40211.118216] oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=/,mems_allowed=0\n" +
+				"Apr  3 11:07:51 kernel: [40548.402893] Killed process 8840 (cachewarmer) total-vm:538112kB, anon-rss:523968kB, file-rss:12kB\n",
+		},
+	} {
+		oomInstances := analyzeLog(t, test.log)
+		if len(oomInstances) != 1 || !reflect.DeepEqual(*oomInstances[0], *reclaimed) {
+			t.Errorf("%s: expected only %+v, got %+v", test.description, reclaimed, oomInstances)
+		}
+	}
+
+	// The report has at most maxOomReportLines lines.
+	oomInstances := analyzeLog(t, "Apr  3 11:02:14 kernel: [40211.118203] cachewarmer invoked oom-killer: gfp_mask=0xd0, order=0, oom_score_adj=0\n"+
+		"Apr  3 11:02:14 kernel: [40211.118214] Task in /mem3 killed as a result of limit of /mem3\n"+
+		"Apr  3 11:02:14 kernel: [40211.118216] oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=/,mems_allowed=0\n"+
+		strings.Repeat("Apr  3 11:02:14 CRON[8851]: (root) CMD (touch /var/run/crond.sittercheck)\n", maxOomReportLines)+
+		"Apr  3 11:02:14 kernel: [40211.118400] Killed process 8840 (cachewarmer) total-vm:538112kB, anon-rss:523968kB, file-rss:12kB\n")
+	if len(oomInstances) != 1 || !reflect.DeepEqual(*oomInstances[0], *reclaimed) {
+		t.Errorf("expected only %+v past the line bound, got %+v", reclaimed, oomInstances)
+	}
+}
+
+func TestAnalyzeLinesFollow(t *testing.T) {
+	f, err := ioutil.TempFile("", "messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	file, err := os.Open(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oomLog := &OomParser{reportTimeout: time.Second, pollInterval: time.Millisecond}
+	oomLog.SetClock(clock.NewFakeClock(testNow))
 	outStream := make(chan *OomInstance)
+	done := make(chan struct{})
+	go func() {
+		oomLog.analyzeLines(file, true, outStream)
+		close(done)
+	}()
+	// Closing the log stops following it.
+	defer func() {
+		file.Close()
+		<-done
+	}()
+
+	// The end of the log does not end the report, even in the middle of a
+	// line.
+	f.WriteString("Apr  3 11:02:19 kernel: [40216.402781] cachewarmer invoked oom-killer: gfp_mask=0xd0, order=0, oom_score_adj=0\n" +
+		"Apr  3 11:02:19 kernel: [40216.402792] Task in /mem3 killed as a result of limit of /mem3\n" +
+		"Apr  3 11:02:19 kernel: [40216.402893] Killed process 8840 ")
+	select {
+	case oomInstance := <-outStream:
+		t.Fatalf("the report ended at the end of the log: %+v", oomInstance)
+	case <-time.After(100 * time.Millisecond):
+	}
+	f.WriteString("(cachewarmer) total-vm:538112kB, anon-rss:523968kB, file-rss:12kB\n")
+	select {
+	case oomInstance := <-outStream:
+		if !oomInstance.Killed || oomInstance.Pid != 8840 || oomInstance.ContainerName != "/mem3" {
+			t.Errorf("expected the kill of 8840 in /mem3, got %+v", oomInstance)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no OomInstance once the kill was logged")
+	}
+
+	// A report without a kill ends when nothing more is logged.
+	f.WriteString("Apr  3 11:03:02 kernel: [40259.118203] cachewarmer invoked oom-killer: gfp_mask=0xd0, order=0, oom_score_adj=0\n" +
+		"Apr  3 11:03:02 kernel: [40259.118214] Task in /mem3 killed as a result of limit of /mem3\n")
+	select {
+	case oomInstance := <-outStream:
+		if oomInstance.Killed || oomInstance.ContainerName != "/mem3" {
+			t.Errorf("expected an OOM of /mem3 without a kill, got %+v", oomInstance)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no OomInstance for the report without a kill")
+	}
+}
+
+func TestAnalyzeLinesWorkloadMapper(t *testing.T) {
+	expectedContainerOomInstance := createExpectedContainerOomInstance(t)
+	expectedContainerOomInstance.WorkloadName = "monster-service"
+	oomLog := new(OomParser)
+	oomLog.SetWorkloadMapper(NewTableWorkloadMapper(map[string]string{
+		"memorymonster": "monster-service",
+		"badsysprogram": "bad-service",
+	}))
+	helpTestAnalyzeLinesWithParser(expectedContainerOomInstance, containerLogFile, oomLog, t)
+}
+
+func TestAnalyzeLinesMemoryStatsProvider(t *testing.T) {
+	snapshots := map[string]*MemorySnapshot{
+		"/mem2": {
+			Timestamp:  testNow,
+			Usage:      268435456,
+			WorkingSet: 260046848,
+			Cache:      8388608,
+			Limit:      268435456,
+		},
+	}
+	provider := func(containerName string) *MemorySnapshot {
+		return snapshots[containerName]
+	}
+
+	expectedContainerOomInstance := createExpectedContainerOomInstance(t)
+	expectedContainerOomInstance.MemorySnapshot = snapshots["/mem2"]
 	oomLog := new(OomParser)
+	oomLog.SetMemoryStatsProvider(provider)
+	helpTestAnalyzeLinesWithParser(expectedContainerOomInstance, containerLogFile, oomLog, t)
+
+	// The root container is unknown to the provider.
+	oomLog = new(OomParser)
+	oomLog.SetMemoryStatsProvider(provider)
+	helpTestAnalyzeLinesWithParser(createExpectedSystemOomInstance(t), systemLogFile, oomLog, t)
+}
+
+func TestHasContainerPrefix(t *testing.T) {
+	for _, test := range []struct {
+		containerName string
+		prefix        string
+		expected      bool
+	}{
+		{"/kubepods/pod1/abc", "/kubepods", true},
+		{"/kubepods", "/kubepods", true},
+		{"/kubepods/pod1", "/kubepods/", true},
+		{"/kubepods2/pod1", "/kubepods", false},
+		{"/system.slice", "/kubepods", false},
+		{"/", "/kubepods", false},
+		{"/", "", true},
+		{"/mem2", "/", true},
+	} {
+		if matched := hasContainerPrefix(test.containerName, test.prefix); matched != test.expected {
+			t.Errorf("expected prefix %q to match %q: %v, got %v", test.prefix, test.containerName, test.expected, matched)
+		}
+	}
+}
+
+func TestAnalyzeLinesContainerPrefix(t *testing.T) {
+	// The system OOM logged first is dropped.
+	systemFile, err := os.Open(systemLogFile)
+	if err != nil {
+		t.Fatalf("couldn't open test log: %v", err)
+	}
+	defer systemFile.Close()
+	containerFile, err := os.Open(containerLogFile)
+	if err != nil {
+		t.Fatalf("couldn't open test log: %v", err)
+	}
+	defer containerFile.Close()
+
+	oomLog := new(OomParser)
+	oomLog.SetContainerPrefix("/mem2")
+	oomLog.SetClock(clock.NewFakeClock(testNow))
+	outStream := make(chan *OomInstance)
+	go oomLog.analyzeLines(ioutil.NopCloser(io.MultiReader(systemFile, containerFile)), false, outStream)
+	expected := createExpectedContainerOomInstance(t)
+	select {
+	case oomInstance := <-outStream:
+		if !reflect.DeepEqual(*expected, *oomInstance) {
+			t.Errorf("wrong instance returned. Expected %v and got %v", expected, oomInstance)
+		}
+	case <-time.After(1 * time.Second):
+		t.Error("timeout happened before oomInstance was found in test file")
+	}
+}
+
+func helpTestAnalyzeLines(oomCheckInstance *OomInstance, sysFile string, t *testing.T) {
+	helpTestAnalyzeLinesWithParser(oomCheckInstance, sysFile, new(OomParser), t)
+}
+
+func helpTestAnalyzeLinesWithParser(oomCheckInstance *OomInstance, sysFile string, oomLog *OomParser, t *testing.T) {
+	outStream := make(chan *OomInstance)
 	oomLog.systemFile = sysFile
+	oomLog.SetClock(clock.NewFakeClock(testNow))
 	file, err := os.Open(oomLog.systemFile)
 	if err != nil {
 		t.Errorf("couldn't open test log: %v", err)
@@ -142,10 +546,10 @@ func helpTestAnalyzeLines(oomCheckInstance *OomInstance, sysFile string, t *test
 		time.Sleep(1 * time.Second)
 		timeout <- true
 	}()
-	go oomLog.analyzeLines(file, outStream)
+	go oomLog.analyzeLines(file, false, outStream)
 	select {
 	case oomInstance := <-outStream:
-		if *oomCheckInstance != *oomInstance {
+		if !reflect.DeepEqual(*oomCheckInstance, *oomInstance) {
 			t.Errorf("wrong instance returned. Expected %v and got %v",
 				oomCheckInstance, oomInstance)
 		}
@@ -169,6 +573,7 @@ func helpTestStreamOoms(oomCheckInstance *OomInstance, sysFile string, t *testin
 	outStream := make(chan *OomInstance)
 	oomLog := new(OomParser)
 	oomLog.systemFile = sysFile
+	oomLog.SetClock(clock.NewFakeClock(testNow))
 	timeout := make(chan bool, 1)
 	go func() {
 		time.Sleep(1 * time.Second)
@@ -182,7 +587,7 @@ func helpTestStreamOoms(oomCheckInstance *OomInstance, sysFile string, t *testin
 
 	select {
 	case oomInstance := <-outStream:
-		if *oomCheckInstance != *oomInstance {
+		if !reflect.DeepEqual(*oomCheckInstance, *oomInstance) {
 			t.Errorf("wrong instance returned. Expected %v and got %v",
 				oomCheckInstance, oomInstance)
 		}
@@ -198,3 +603,26 @@ func TestNew(t *testing.T) {
 		t.Errorf("function New() had error %v", err)
 	}
 }
+
+func TestSetYear(t *testing.T) {
+	timeOfDeath, err := time.Parse(time.Stamp, "Dec 31 23:59:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		now      time.Time
+		expected time.Time
+	}{
+		// read the same day.
+		{time.Date(2015, time.December, 31, 23, 59, 59, 0, time.UTC), time.Date(2015, time.December, 31, 23, 59, 30, 0, time.UTC)},
+		// read after new year.
+		{time.Date(2016, time.January, 1, 0, 1, 0, 0, time.UTC), time.Date(2015, time.December, 31, 23, 59, 30, 0, time.UTC)},
+		// logged by a clock slightly ahead of now.
+		{time.Date(2015, time.December, 31, 23, 50, 0, 0, time.UTC), time.Date(2015, time.December, 31, 23, 59, 30, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		if withYear := setYear(timeOfDeath, c.now); !withYear.Equal(c.expected) {
+			t.Errorf("expected time of death %v when read at %v, got %v", c.expected, c.now, withYear)
+		}
+	}
+}
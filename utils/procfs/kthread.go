@@ -0,0 +1,45 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package procfs
+
+import (
+	"io/ioutil"
+	"path"
+	"strconv"
+)
+
+// Returns whether the specified process is a kernel thread. Kernel threads have
+// an empty command line. procRoot is the mount point of procfs (e.g. "/proc").
+func IsKernelThread(procRoot string, pid int) (bool, error) {
+	cmdline, err := ioutil.ReadFile(path.Join(procRoot, strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return false, err
+	}
+	return len(cmdline) == 0, nil
+}
+
+// Returns the specified pids that are not kernel threads. Processes that can't
+// be inspected (e.g. they already exited) are kept.
+func FilterKernelThreads(procRoot string, pids []int) []int {
+	ret := make([]int, 0, len(pids))
+	for _, pid := range pids {
+		isKernelThread, err := IsKernelThread(procRoot, pid)
+		if err == nil && isKernelThread {
+			continue
+		}
+		ret = append(ret, pid)
+	}
+	return ret
+}
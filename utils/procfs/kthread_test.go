@@ -0,0 +1,60 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package procfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// Create a fake procfs with the specified command line for each pid.
+func newFakeProc(t *testing.T, cmdlines map[int]string) string {
+	procRoot, err := ioutil.TempDir("", "proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pid, cmdline := range cmdlines {
+		dir := path.Join(procRoot, strconv.Itoa(pid))
+		err = os.Mkdir(dir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path.Join(dir, "cmdline"), []byte(cmdline), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return procRoot
+}
+
+func TestFilterKernelThreads(t *testing.T) {
+	procRoot := newFakeProc(t, map[int]string{
+		1:   "/sbin/init\x00",
+		2:   "",
+		100: "nginx\x00-g\x00daemon off;\x00",
+	})
+	defer os.RemoveAll(procRoot)
+
+	// Pid 200 exited and is kept as it can't be inspected.
+	pids := FilterKernelThreads(procRoot, []int{1, 2, 100, 200})
+	expected := []int{1, 100, 200}
+	if !reflect.DeepEqual(pids, expected) {
+		t.Errorf("filtered pids are %v, expected %v", pids, expected)
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package procfs
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Returns the command line of the specified process, one element per argument.
+// It is empty for kernel threads and zombies.
+func GetCmdline(procRoot string, pid int) ([]string, error) {
+	cmdline, err := ioutil.ReadFile(path.Join(procRoot, strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return nil, err
+	}
+	cmdline = bytes.TrimRight(cmdline, "\x00")
+	if len(cmdline) == 0 {
+		return []string{}, nil
+	}
+	return strings.Split(string(cmdline), "\x00"), nil
+}
+
+// Returns when the specified process started, from its start time in
+// jiffies since boot and the boot time of the machine.
+func GetStartTime(procRoot string, pid int) (time.Time, error) {
+	statFile := path.Join(procRoot, strconv.Itoa(pid), "stat")
+	out, err := ioutil.ReadFile(statFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// The command (second field) is in parentheses and may contain spaces,
+	// the start time is the 20th field after it.
+	stat := string(out)
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	if len(fields) < 20 {
+		return time.Time{}, fmt.Errorf("malformed %q: %q", statFile, stat)
+	}
+	startTime, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse the start time in %q: %v", statFile, err)
+	}
+	bootTime, err := getBootTime(procRoot)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return bootTime.Add(JiffiesToDuration(startTime)), nil
+}
+
+// Returns the boot time of the machine from the btime line of the stat file.
+func getBootTime(procRoot string) (time.Time, error) {
+	statFile := path.Join(procRoot, "stat")
+	out, err := ioutil.ReadFile(statFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "btime" {
+			continue
+		}
+		btime, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to parse the boot time in %q: %v", statFile, err)
+		}
+		return time.Unix(btime, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("no boot time in %q", statFile)
+}
+
+// Returns the time the specified task spent running on a cpu and waiting
+// for one while runnable, from its schedstat file. tid may be the id of any
+// thread, not only of a process.
+func GetSchedstat(procRoot string, tid int) (runTime time.Duration, waitTime time.Duration, err error) {
+	schedstatFile := path.Join(procRoot, strconv.Itoa(tid), "schedstat")
+	out, err := ioutil.ReadFile(schedstatFile)
+	if err != nil {
+		return 0, 0, err
+	}
+	// The fields are the run time and wait time in nanoseconds and the
+	// number of timeslices run.
+	fields := strings.Fields(string(out))
+	if len(fields) < 2 {
+		return 0, 0, fmt.Errorf("malformed %q: %q", schedstatFile, out)
+	}
+	run, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse the run time in %q: %v", schedstatFile, err)
+	}
+	wait, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse the wait time in %q: %v", schedstatFile, err)
+	}
+	return time.Duration(run), time.Duration(wait), nil
+}
+
+// Returns the soft and hard limits on the number of open files of the
+// specified process, from the "Max open files" line of its limits file.
+// Unlimited limits are math.MaxUint64.
+func GetOpenFilesLimit(procRoot string, pid int) (soft uint64, hard uint64, err error) {
+	const openFiles = "Max open files"
+	limitsFile := path.Join(procRoot, strconv.Itoa(pid), "limits")
+	out, err := ioutil.ReadFile(limitsFile)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if !strings.HasPrefix(line, openFiles) {
+			continue
+		}
+		// The soft limit, hard limit and units.
+		fields := strings.Fields(line[len(openFiles):])
+		if len(fields) < 2 {
+			return 0, 0, fmt.Errorf("malformed %q: %q", limitsFile, line)
+		}
+		soft, err = parseLimit(fields[0])
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to parse the soft limit in %q: %v", limitsFile, err)
+		}
+		hard, err = parseLimit(fields[1])
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to parse the hard limit in %q: %v", limitsFile, err)
+		}
+		return soft, hard, nil
+	}
+	return 0, 0, fmt.Errorf("no open files limit in %q", limitsFile)
+}
+
+func parseLimit(limit string) (uint64, error) {
+	if limit == "unlimited" {
+		return math.MaxUint64, nil
+	}
+	return strconv.ParseUint(limit, 10, 64)
+}
+
+// Returns the badness score of the specified process for the OOM killer, the
+// higher the more likely it is killed, and the adjustment applied to it, from
+// -1000 (never killed) to 1000.
+func GetOomScore(procRoot string, pid int) (score int64, adj int64, err error) {
+	read := func(name string) (int64, error) {
+		scoreFile := path.Join(procRoot, strconv.Itoa(pid), name)
+		out, err := ioutil.ReadFile(scoreFile)
+		if err != nil {
+			return 0, err
+		}
+		value, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse %q: %v", scoreFile, err)
+		}
+		return value, nil
+	}
+	if score, err = read("oom_score"); err != nil {
+		return 0, 0, err
+	}
+	if adj, err = read("oom_score_adj"); err != nil {
+		return 0, 0, err
+	}
+	return score, adj, nil
+}
+
+// IO counters of a process, from its io file.
+type ProcessIo struct {
+	// Bytes read and written through syscalls, including those served from
+	// and to the page cache.
+	Rchar uint64
+	Wchar uint64
+	// Number of read and write syscalls.
+	Syscr uint64
+	Syscw uint64
+	// Bytes read from and written to the block layer.
+	ReadBytes  uint64
+	WriteBytes uint64
+}
+
+// Returns the IO counters of the specified process. Reading the io file of a
+// process of another user requires the permission to ptrace it.
+func GetProcessIo(procRoot string, pid int) (ProcessIo, error) {
+	var processIo ProcessIo
+	ioFile := path.Join(procRoot, strconv.Itoa(pid), "io")
+	out, err := ioutil.ReadFile(ioFile)
+	if err != nil {
+		return processIo, err
+	}
+	counters := map[string]*uint64{
+		"rchar":       &processIo.Rchar,
+		"wchar":       &processIo.Wchar,
+		"syscr":       &processIo.Syscr,
+		"syscw":       &processIo.Syscw,
+		"read_bytes":  &processIo.ReadBytes,
+		"write_bytes": &processIo.WriteBytes,
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		dest, ok := counters[strings.TrimSuffix(fields[0], ":")]
+		if !ok {
+			continue
+		}
+		*dest, err = strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return processIo, fmt.Errorf("failed to parse %q in %q: %v", line, ioFile, err)
+		}
+	}
+	return processIo, nil
+}
@@ -0,0 +1,214 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package procfs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetCmdline(t *testing.T) {
+	procRoot := newFakeProc(t, map[int]string{
+		1:   "/sbin/init\x00",
+		2:   "",
+		100: "nginx\x00-g\x00daemon off;\x00",
+	})
+	defer os.RemoveAll(procRoot)
+
+	for pid, expected := range map[int][]string{
+		1:   {"/sbin/init"},
+		2:   {},
+		100: {"nginx", "-g", "daemon off;"},
+	} {
+		cmdline, err := GetCmdline(procRoot, pid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(cmdline, expected) {
+			t.Errorf("command line of %d is %q, expected %q", pid, cmdline, expected)
+		}
+	}
+	if _, err := GetCmdline(procRoot, 200); err == nil {
+		t.Errorf("expected an error for a process that exited")
+	}
+}
+
+func TestGetStartTime(t *testing.T) {
+	procRoot := newFakeProc(t, map[int]string{
+		100: "nginx\x00",
+	})
+	defer os.RemoveAll(procRoot)
+	files := map[string]string{
+		"stat":     "cpu  100 0 50 1000 10 0 0 0 0 0\nbtime 1420070400\nprocesses 1000\n",
+		"100/stat": "100 (nginx: master) S 1 100 100 0 -1 4202752 1 0 0 0 5 3 0 0 20 0 1 0 12345 10000000 100 18446744073709551615 0 0 0 0 0 0 0 0 0 0 0 0 17 1 0 0 0 0 0\n",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(path.Join(procRoot, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	startTime, err := GetStartTime(procRoot, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := time.Unix(1420070400, 0).Add(JiffiesToDuration(12345))
+	if !startTime.Equal(expected) {
+		t.Errorf("start time is %v, expected %v", startTime, expected)
+	}
+}
+
+func TestGetSchedstat(t *testing.T) {
+	procRoot := newFakeProc(t, map[int]string{
+		100: "nginx\x00",
+		101: "",
+	})
+	defer os.RemoveAll(procRoot)
+	for name, contents := range map[string]string{
+		"100/schedstat": "1516264 234871 12\n",
+		"101/schedstat": "1516264\n",
+	} {
+		if err := ioutil.WriteFile(path.Join(procRoot, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runTime, waitTime, err := GetSchedstat(procRoot, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runTime != 1516264 || waitTime != 234871 {
+		t.Errorf("read run time %d and wait time %d, expected 1516264 and 234871", runTime, waitTime)
+	}
+	if _, _, err := GetSchedstat(procRoot, 101); err == nil {
+		t.Errorf("expected an error reading a malformed schedstat")
+	}
+	if _, _, err := GetSchedstat(procRoot, 102); err == nil {
+		t.Errorf("expected an error reading the schedstat of a task that exited")
+	}
+}
+
+func TestGetOpenFilesLimit(t *testing.T) {
+	procRoot := newFakeProc(t, map[int]string{
+		100: "nginx\x00",
+		101: "",
+		102: "",
+	})
+	defer os.RemoveAll(procRoot)
+	limits := "Limit                     Soft Limit           Hard Limit           Units     \n" +
+		"Max cpu time              unlimited            unlimited            seconds   \n" +
+		"Max processes             63382                63382                processes \n" +
+		"Max open files            %s                 %s              files     \n" +
+		"Max locked memory         65536                65536                bytes     \n"
+	for name, contents := range map[string]string{
+		"100/limits": fmt.Sprintf(limits, "1024", "1048576"),
+		"101/limits": fmt.Sprintf(limits, "unlimited", "unlimited"),
+		"102/limits": "Limit                     Soft Limit           Hard Limit           Units     \n",
+	} {
+		if err := ioutil.WriteFile(path.Join(procRoot, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	soft, hard, err := GetOpenFilesLimit(procRoot, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if soft != 1024 || hard != 1048576 {
+		t.Errorf("read soft limit %d and hard limit %d, expected 1024 and 1048576", soft, hard)
+	}
+	soft, hard, err = GetOpenFilesLimit(procRoot, 101)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if soft != math.MaxUint64 || hard != math.MaxUint64 {
+		t.Errorf("read soft limit %d and hard limit %d, expected unlimited limits", soft, hard)
+	}
+	if _, _, err := GetOpenFilesLimit(procRoot, 102); err == nil {
+		t.Errorf("expected an error without an open files limit")
+	}
+	if _, _, err := GetOpenFilesLimit(procRoot, 103); err == nil {
+		t.Errorf("expected an error reading the limits of a process that exited")
+	}
+}
+
+func TestGetOomScore(t *testing.T) {
+	procRoot := newFakeProc(t, map[int]string{
+		100: "nginx\x00",
+		101: "sshd\x00",
+	})
+	defer os.RemoveAll(procRoot)
+	files := map[string]string{
+		"100/oom_score":     "667\n",
+		"100/oom_score_adj": "-500\n",
+		"101/oom_score":     "0\n",
+		"101/oom_score_adj": "invalid\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(path.Join(procRoot, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	score, adj, err := GetOomScore(procRoot, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score != 667 || adj != -500 {
+		t.Errorf("read oom score %d and adjustment %d, expected 667 and -500", score, adj)
+	}
+	if _, _, err := GetOomScore(procRoot, 101); err == nil {
+		t.Errorf("expected an error reading an invalid oom score adjustment")
+	}
+	if _, _, err := GetOomScore(procRoot, 102); err == nil {
+		t.Errorf("expected an error reading the oom score of a process that exited")
+	}
+}
+
+func TestGetProcessIo(t *testing.T) {
+	procRoot := newFakeProc(t, map[int]string{
+		100: "nginx\x00",
+	})
+	defer os.RemoveAll(procRoot)
+	io := "rchar: 323934931\nwchar: 323929600\nsyscr: 632687\nsyscw: 632675\nread_bytes: 4096\nwrite_bytes: 323932160\ncancelled_write_bytes: 0\n"
+	if err := ioutil.WriteFile(path.Join(procRoot, "100", "io"), []byte(io), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	processIo, err := GetProcessIo(procRoot, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ProcessIo{
+		Rchar:      323934931,
+		Wchar:      323929600,
+		Syscr:      632687,
+		Syscw:      632675,
+		ReadBytes:  4096,
+		WriteBytes: 323932160,
+	}
+	if processIo != expected {
+		t.Errorf("read io %+v, expected %+v", processIo, expected)
+	}
+	if _, err := GetProcessIo(procRoot, 101); err == nil {
+		t.Errorf("expected an error reading the io of a process that exited")
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Reads the stats of the queueing disciplines (as `tc -s qdisc` does) of the
+// network interfaces of a network namespace through rtnetlink.
+package qdisc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+
+	"github.com/google/cadvisor/info"
+)
+
+const (
+	// Kernel constants of the traffic control netlink messages.
+	tcHRoot        = 0xFFFFFFFF // TC_H_ROOT
+	tcaKind        = 1          // TCA_KIND
+	tcaStats       = 3          // TCA_STATS
+	tcaStats2      = 7          // TCA_STATS2
+	tcaStatsBasic  = 1          // TCA_STATS_BASIC
+	tcaStatsQueue  = 3          // TCA_STATS_QUEUE
+	nlaTypeMask    = 0x3FFF     // NLA_TYPE_MASK
+	sizeofTcMsg    = 20         // sizeof(struct tcmsg)
+	sizeofRtAttr   = 4          // sizeof(struct rtattr)
+	receiveBufSize = 65536
+)
+
+// TODO: Verify and fix for other architectures.
+const sysSetns = 308 // SYS_SETNS on amd64
+
+var endian = binary.LittleEndian
+
+// struct tcmsg
+type tcMsg struct {
+	Family  uint8
+	Pad1    uint8
+	Pad2    uint16
+	Ifindex int32
+	Handle  uint32
+	Parent  uint32
+	Info    uint32
+}
+
+// struct tc_stats, the stats of kernels without TCA_STATS2.
+type tcStats struct {
+	Bytes      uint64
+	Packets    uint32
+	Drops      uint32
+	Overlimits uint32
+	Bps        uint32
+	Pps        uint32
+	Qlen       uint32
+	Backlog    uint32
+}
+
+// struct gnet_stats_basic, without its padding.
+type gnetStatsBasic struct {
+	Bytes   uint64
+	Packets uint32
+}
+
+// struct gnet_stats_queue
+type gnetStatsQueue struct {
+	Qlen       uint32
+	Backlog    uint32
+	Drops      uint32
+	Requeues   uint32
+	Overlimits uint32
+}
+
+// Gets the stats of the root qdisc of every network interface in the network
+// namespace of the specified process, keyed by interface name. A pid of 0 uses
+// the namespace of cAdvisor.
+func GetQdiscStats(pid int) (map[string]info.QdiscStats, error) {
+	if pid == 0 {
+		return getQdiscStats()
+	}
+	var ret map[string]info.QdiscStats
+	err := inNetNamespace(pid, func() error {
+		var err error
+		ret, err = getQdiscStats()
+		return err
+	})
+	return ret, err
+}
+
+func getQdiscStats() (map[string]info.QdiscStats, error) {
+	msgs, err := dumpQdiscs()
+	if err != nil {
+		return nil, err
+	}
+	byIndex, err := parseQdiscMessages(msgs)
+	if err != nil {
+		return nil, err
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]info.QdiscStats, len(byIndex))
+	for _, iface := range ifaces {
+		if stats, ok := byIndex[iface.Index]; ok {
+			ret[iface.Name] = stats
+		}
+	}
+	return ret, nil
+}
+
+// Runs f on a thread moved to the network namespace of the specified process.
+// f runs in its own goroutine, so that its thread is destroyed with it when it
+// cannot be moved back to the namespace of cAdvisor.
+func inNetNamespace(pid int, f func() error) error {
+	target, err := os.Open(fmt.Sprintf("/proc/%d/ns/net", pid))
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		origin, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", syscall.Gettid()))
+		if err != nil {
+			runtime.UnlockOSThread()
+			errs <- err
+			return
+		}
+		defer origin.Close()
+		if err := setNetNamespace(target); err != nil {
+			runtime.UnlockOSThread()
+			errs <- fmt.Errorf("failed to enter the network namespace of process %d: %v", pid, err)
+			return
+		}
+		err = f()
+		if restoreErr := setNetNamespace(origin); restoreErr != nil {
+			errs <- fmt.Errorf("failed to leave the network namespace of process %d: %v", pid, restoreErr)
+			return
+		}
+		runtime.UnlockOSThread()
+		errs <- err
+	}()
+	return <-errs
+}
+
+func setNetNamespace(ns *os.File) error {
+	_, _, errno := syscall.RawSyscall(sysSetns, ns.Fd(), syscall.CLONE_NEWNET, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Dumps the qdiscs of the network namespace of the calling thread.
+func dumpQdiscs() ([]syscall.NetlinkMessage, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+	addr := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}
+	if err := syscall.Bind(fd, addr); err != nil {
+		return nil, err
+	}
+
+	req := bytes.NewBuffer(nil)
+	binary.Write(req, endian, syscall.NlMsghdr{
+		Len:   syscall.NLMSG_HDRLEN + sizeofTcMsg,
+		Type:  syscall.RTM_GETQDISC,
+		Flags: syscall.NLM_F_REQUEST | syscall.NLM_F_DUMP,
+		Seq:   1,
+	})
+	binary.Write(req, endian, tcMsg{Family: syscall.AF_UNSPEC})
+	if err := syscall.Sendto(fd, req.Bytes(), 0, addr); err != nil {
+		return nil, err
+	}
+
+	var ret []syscall.NetlinkMessage
+	buf := make([]byte, receiveBufSize)
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return nil, err
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range msgs {
+			switch msg.Header.Type {
+			case syscall.NLMSG_DONE:
+				return ret, nil
+			case syscall.NLMSG_ERROR:
+				if len(msg.Data) >= 4 {
+					if errno := int32(endian.Uint32(msg.Data)); errno != 0 {
+						return nil, syscall.Errno(-errno)
+					}
+				}
+				return nil, fmt.Errorf("netlink error while dumping the qdiscs")
+			}
+			// The messages are copied out of the reused buffer.
+			msg.Data = append([]byte(nil), msg.Data...)
+			ret = append(ret, msg)
+		}
+	}
+}
+
+// Gets the stats of the root qdiscs from the RTM_NEWQDISC messages of a dump,
+// keyed by interface index. Other messages and qdiscs are ignored.
+func parseQdiscMessages(msgs []syscall.NetlinkMessage) (map[int]info.QdiscStats, error) {
+	ret := make(map[int]info.QdiscStats)
+	for _, msg := range msgs {
+		if msg.Header.Type != syscall.RTM_NEWQDISC {
+			continue
+		}
+		if len(msg.Data) < sizeofTcMsg {
+			return nil, fmt.Errorf("qdisc message of %d bytes is too short", len(msg.Data))
+		}
+		var tcm tcMsg
+		if err := binary.Read(bytes.NewReader(msg.Data[:sizeofTcMsg]), endian, &tcm); err != nil {
+			return nil, err
+		}
+		if tcm.Parent != tcHRoot {
+			continue
+		}
+		attrs, err := parseAttributes(msg.Data[sizeofTcMsg:])
+		if err != nil {
+			return nil, err
+		}
+		stats, err := parseQdiscAttributes(attrs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stats of the qdisc of interface %d: %v", tcm.Ifindex, err)
+		}
+		ret[int(tcm.Ifindex)] = stats
+	}
+	return ret, nil
+}
+
+// Prefers the TCA_STATS2 attributes, which have the requeues, to the old
+// TCA_STATS ones.
+func parseQdiscAttributes(attrs map[uint16][]byte) (info.QdiscStats, error) {
+	stats := info.QdiscStats{}
+	if kind, ok := attrs[tcaKind]; ok {
+		stats.Kind = string(bytes.TrimRight(kind, "\x00"))
+	}
+	if stats2, ok := attrs[tcaStats2]; ok {
+		nested, err := parseAttributes(stats2)
+		if err != nil {
+			return stats, err
+		}
+		if data, ok := nested[tcaStatsBasic]; ok {
+			var basic gnetStatsBasic
+			if err := binary.Read(bytes.NewReader(data), endian, &basic); err != nil {
+				return stats, err
+			}
+			stats.Bytes = basic.Bytes
+			stats.Packets = uint64(basic.Packets)
+		}
+		if data, ok := nested[tcaStatsQueue]; ok {
+			var queue gnetStatsQueue
+			if err := binary.Read(bytes.NewReader(data), endian, &queue); err != nil {
+				return stats, err
+			}
+			stats.Qlen = uint64(queue.Qlen)
+			stats.Backlog = uint64(queue.Backlog)
+			stats.Drops = uint64(queue.Drops)
+			stats.Requeues = uint64(queue.Requeues)
+			stats.Overlimits = uint64(queue.Overlimits)
+		}
+		return stats, nil
+	}
+	if data, ok := attrs[tcaStats]; ok {
+		var old tcStats
+		if err := binary.Read(bytes.NewReader(data), endian, &old); err != nil {
+			return stats, err
+		}
+		stats.Bytes = old.Bytes
+		stats.Packets = uint64(old.Packets)
+		stats.Qlen = uint64(old.Qlen)
+		stats.Backlog = uint64(old.Backlog)
+		stats.Drops = uint64(old.Drops)
+		stats.Overlimits = uint64(old.Overlimits)
+	}
+	return stats, nil
+}
+
+// Splits a buffer of netlink attributes, keyed by type.
+func parseAttributes(data []byte) (map[uint16][]byte, error) {
+	ret := make(map[uint16][]byte)
+	for len(data) >= sizeofRtAttr {
+		length := int(endian.Uint16(data[0:2]))
+		attrType := endian.Uint16(data[2:4]) & nlaTypeMask
+		if length < sizeofRtAttr || length > len(data) {
+			return nil, fmt.Errorf("invalid attribute length %d", length)
+		}
+		ret[attrType] = data[sizeofRtAttr:length]
+		aligned := (length + syscall.NLMSG_ALIGNTO - 1) &^ (syscall.NLMSG_ALIGNTO - 1)
+		if aligned > len(data) {
+			break
+		}
+		data = data[aligned:]
+	}
+	return ret, nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qdisc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/google/cadvisor/info"
+)
+
+// Encodes a netlink attribute, padded as the kernel does.
+func attribute(attrType uint16, value interface{}) []byte {
+	data := bytes.NewBuffer(nil)
+	if b, ok := value.([]byte); ok {
+		data.Write(b)
+	} else {
+		binary.Write(data, endian, value)
+	}
+	buf := bytes.NewBuffer(nil)
+	binary.Write(buf, endian, uint16(sizeofRtAttr+data.Len()))
+	binary.Write(buf, endian, attrType)
+	buf.Write(data.Bytes())
+	for buf.Len()%syscall.NLMSG_ALIGNTO != 0 {
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+func qdiscMessage(ifindex int32, parent uint32, attrs ...[]byte) syscall.NetlinkMessage {
+	data := bytes.NewBuffer(nil)
+	binary.Write(data, endian, tcMsg{Ifindex: ifindex, Parent: parent, Handle: 0x10000})
+	for _, attr := range attrs {
+		data.Write(attr)
+	}
+	return syscall.NetlinkMessage{
+		Header: syscall.NlMsghdr{Type: syscall.RTM_NEWQDISC},
+		Data:   data.Bytes(),
+	}
+}
+
+func TestParseQdiscMessages(t *testing.T) {
+	// struct gnet_stats_basic is padded to 16 bytes.
+	basic := make([]byte, 16)
+	endian.PutUint64(basic[0:8], 123456)
+	endian.PutUint32(basic[8:12], 789)
+	msgs := []syscall.NetlinkMessage{
+		// The root qdisc of eth0, with both stats attributes.
+		qdiscMessage(2, tcHRoot,
+			attribute(tcaKind, []byte("fq_codel\x00")),
+			attribute(tcaStats, tcStats{Bytes: 1, Packets: 1}),
+			attribute(tcaStats2, append(
+				attribute(tcaStatsBasic, basic),
+				attribute(tcaStatsQueue, gnetStatsQueue{Qlen: 3, Backlog: 4500, Drops: 12, Requeues: 1, Overlimits: 40})...,
+			)),
+		),
+		// A class qdisc and the ingress qdisc of eth0 are ignored.
+		qdiscMessage(2, 0x10001, attribute(tcaKind, []byte("pfifo\x00"))),
+		qdiscMessage(2, 0xFFFFFFF1, attribute(tcaKind, []byte("ingress\x00"))),
+		// Old kernels only report TCA_STATS.
+		qdiscMessage(3, tcHRoot,
+			attribute(tcaKind, []byte("tbf\x00")),
+			attribute(tcaStats, tcStats{Bytes: 2048, Packets: 20, Drops: 5, Overlimits: 7, Qlen: 2, Backlog: 300}),
+		),
+		// Other messages are ignored.
+		{Header: syscall.NlMsghdr{Type: syscall.RTM_NEWLINK}, Data: []byte{1, 2}},
+	}
+
+	stats, err := parseQdiscMessages(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[int]info.QdiscStats{
+		2: {Kind: "fq_codel", Bytes: 123456, Packets: 789, Drops: 12, Overlimits: 40, Requeues: 1, Backlog: 4500, Qlen: 3},
+		3: {Kind: "tbf", Bytes: 2048, Packets: 20, Drops: 5, Overlimits: 7, Backlog: 300, Qlen: 2},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("expected qdisc stats %+v, got %+v", expected, stats)
+	}
+}
+
+func TestParseQdiscMessagesInvalid(t *testing.T) {
+	truncated := qdiscMessage(2, tcHRoot)
+	truncated.Data = truncated.Data[:sizeofTcMsg-1]
+	if _, err := parseQdiscMessages([]syscall.NetlinkMessage{truncated}); err == nil {
+		t.Errorf("expected an error for a truncated message")
+	}
+
+	badAttribute := qdiscMessage(2, tcHRoot, []byte{64, 0, tcaKind, 0})
+	if _, err := parseQdiscMessages([]syscall.NetlinkMessage{badAttribute}); err == nil {
+		t.Errorf("expected an error for an attribute longer than the message")
+	}
+}
@@ -51,8 +51,9 @@ func (self *FileInfo) Sys() interface{} {
 }
 
 type FakeSysFs struct {
-	info  FileInfo
-	cache sysfs.CacheInfo
+	info       FileInfo
+	cache      sysfs.CacheInfo
+	onlineCpus string
 }
 
 func (self *FakeSysFs) GetBlockDevices() ([]os.FileInfo, error) {
@@ -108,3 +109,11 @@ func (self *FakeSysFs) SetCacheInfo(cache sysfs.CacheInfo) {
 func (self *FakeSysFs) SetEntryName(name string) {
 	self.info.EntryName = name
 }
+
+func (self *FakeSysFs) GetOnlineCpus() (string, error) {
+	return self.onlineCpus, nil
+}
+
+func (self *FakeSysFs) SetOnlineCpus(cpus string) {
+	self.onlineCpus = cpus
+}
@@ -23,9 +23,10 @@ import (
 )
 
 const (
-	blockDir = "/sys/block"
-	cacheDir = "/sys/devices/system/cpu/cpu"
-	netDir   = "/sys/class/net"
+	blockDir       = "/sys/block"
+	cacheDir       = "/sys/devices/system/cpu/cpu"
+	netDir         = "/sys/class/net"
+	onlineCpusFile = "/sys/devices/system/cpu/online"
 )
 
 type CacheInfo struct {
@@ -60,6 +61,9 @@ type SysFs interface {
 	GetCaches(id int) ([]os.FileInfo, error)
 	// Get information for a cache accessible from the given cpu.
 	GetCacheInfo(cpu int, cache string) (CacheInfo, error)
+
+	// Get the cpus currently online, in cpu list format (e.g. "0-3,6").
+	GetOnlineCpus() (string, error)
 }
 
 type realSysFs struct{}
@@ -138,6 +142,14 @@ func (self *realSysFs) GetNetworkStatValue(dev string, stat string) (uint64, err
 	return s, nil
 }
 
+func (self *realSysFs) GetOnlineCpus() (string, error) {
+	out, err := ioutil.ReadFile(onlineCpusFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
 func (self *realSysFs) GetCaches(id int) ([]os.FileInfo, error) {
 	cpuPath := fmt.Sprintf("%s%d/cache", cacheDir, id)
 	return ioutil.ReadDir(cpuPath)
@@ -16,6 +16,8 @@ package sysinfo
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
 	"regexp"
 	"strconv"
 	"strings"
@@ -164,11 +166,54 @@ func GetNetworkStats(name string) (info.NetworkStats, error) {
 	if err != nil {
 		return stats, err
 	}
-	return getNetworkStats(name, sysFs)
+	ifStats, err := getNetworkStats(name, sysFs)
+	if err != nil {
+		return stats, err
+	}
+	stats.RxBytes = ifStats.RxBytes
+	stats.RxPackets = ifStats.RxPackets
+	stats.RxErrors = ifStats.RxErrors
+	stats.RxDropped = ifStats.RxDropped
+	stats.TxBytes = ifStats.TxBytes
+	stats.TxPackets = ifStats.TxPackets
+	stats.TxErrors = ifStats.TxErrors
+	stats.TxDropped = ifStats.TxDropped
+	return stats, nil
 }
 
-func getNetworkStats(name string, sysFs sysfs.SysFs) (info.NetworkStats, error) {
-	stats := info.NetworkStats{}
+// Get the stats of all the network interfaces of the host keyed by name,
+// including bridges. Veth devices are left out since they are accounted to
+// containers. The loopback device is only included if asked for.
+func GetAllNetworkStats(includeLoopback bool) (map[string]info.InterfaceStats, error) {
+	sysFs, err := sysfs.NewRealSysFs()
+	if err != nil {
+		return nil, err
+	}
+	return getAllNetworkStats(sysFs, includeLoopback)
+}
+
+func getAllNetworkStats(sysFs sysfs.SysFs, includeLoopback bool) (map[string]info.InterfaceStats, error) {
+	devs, err := sysFs.GetNetworkDevices()
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]info.InterfaceStats, len(devs))
+	for _, dev := range devs {
+		name := dev.Name()
+		if strings.HasPrefix(name, "veth") || (name == "lo" && !includeLoopback) {
+			continue
+		}
+		stats, err := getNetworkStats(name, sysFs)
+		if err != nil {
+			return nil, err
+		}
+		ret[name] = stats
+	}
+	return ret, nil
+}
+
+func getNetworkStats(name string, sysFs sysfs.SysFs) (info.InterfaceStats, error) {
+	stats := info.InterfaceStats{}
 	var err error
 	stats.RxBytes, err = sysFs.GetNetworkStatValue(name, "rx_bytes")
 	if err != nil {
@@ -204,3 +249,257 @@ func getNetworkStats(name string, sysFs sysfs.SysFs) (info.NetworkStats, error)
 	}
 	return stats, nil
 }
+
+// Get the TCP health counters from the specified snmp and netstat files of a
+// network namespace (e.g. /proc/<pid>/net/snmp and /proc/<pid>/net/netstat).
+// Counters of missing files are not reported.
+func GetTcpAdvancedStats(snmpFile string, netstatFile string) (info.TcpAdvancedStats, error) {
+	stats := info.TcpAdvancedStats{}
+	snmp, err := readNetTables(snmpFile)
+	if err != nil {
+		return stats, err
+	}
+	netstat, err := readNetTables(netstatFile)
+	if err != nil {
+		return stats, err
+	}
+	stats.RetransSegs = snmp["Tcp"]["RetransSegs"]
+	stats.OutRsts = snmp["Tcp"]["OutRsts"]
+	stats.EstabResets = snmp["Tcp"]["EstabResets"]
+	stats.ListenOverflows = netstat["TcpExt"]["ListenOverflows"]
+	stats.ListenDrops = netstat["TcpExt"]["ListenDrops"]
+	return stats, nil
+}
+
+// Reads the counters of a /proc/net/snmp or /proc/net/netstat file keyed by
+// table (e.g. "Tcp") and counter name. Each table is a line of counter names
+// followed by a line of their values, both prefixed by the table name (e.g.
+// "Tcp: RtoAlgorithm RtoMin" and "Tcp: 1 200"). Negative values are ignored.
+func readNetTables(file string) (map[string]map[string]uint64, error) {
+	tables := make(map[string]map[string]uint64)
+	out, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return tables, nil
+		}
+		return nil, err
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	for i := 0; i+1 < len(lines); i += 2 {
+		names := strings.Fields(lines[i])
+		values := strings.Fields(lines[i+1])
+		if len(names) == 0 || len(names) != len(values) || names[0] != values[0] {
+			return nil, fmt.Errorf("failed to parse %q in %q", lines[i], file)
+		}
+		table := make(map[string]uint64, len(names)-1)
+		for j := 1; j < len(names); j++ {
+			if strings.HasPrefix(values[j], "-") {
+				continue
+			}
+			table[names[j]], err = strconv.ParseUint(values[j], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %q in %q: %v", lines[i+1], file, err)
+			}
+		}
+		tables[strings.TrimSuffix(names[0], ":")] = table
+	}
+	return tables, nil
+}
+
+// Get the IPv6 traffic counters from the specified snmp6 file of a network
+// namespace (e.g. /proc/<pid>/net/snmp6). The file does not exist when IPv6 is
+// disabled, in which case no traffic is reported.
+func GetIpv6Stats(snmp6File string) (info.Ipv6Stats, error) {
+	stats := info.Ipv6Stats{}
+	out, err := ioutil.ReadFile(snmp6File)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return stats, nil
+		}
+		return stats, err
+	}
+
+	// Each line is a counter name followed by its value (e.g. "Ip6InOctets 1024").
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		var dest *uint64
+		switch fields[0] {
+		case "Ip6InOctets":
+			dest = &stats.RxBytes
+		case "Ip6InReceives":
+			dest = &stats.RxPackets
+		case "Ip6OutOctets":
+			dest = &stats.TxBytes
+		case "Ip6OutRequests":
+			dest = &stats.TxPackets
+		default:
+			continue
+		}
+		*dest, err = strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return stats, fmt.Errorf("failed to parse %q in %q: %v", line, snmp6File, err)
+		}
+	}
+	return stats, nil
+}
+
+// Clock ticks per second of the times in /proc/stat (USER_HZ), which is 100 on
+// all the architectures Linux supports.
+const userHz = 100
+
+// Get the cpu usage of the machine from the specified /proc/stat file. The
+// total excludes idle and iowait time. The guest time is only reported by
+// kernels since 2.6.24.
+func GetCpuStats(procStatFile string) (info.CpuStats, error) {
+	stats := info.CpuStats{}
+	out, err := ioutil.ReadFile(procStatFile)
+	if err != nil {
+		return stats, err
+	}
+
+	// The cpu lines are the time spent by all cpus ("cpu") and by each cpu
+	// ("cpu0") in each state: user nice system idle iowait irq softirq steal
+	// guest guest_nice.
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 9 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		var times [8]uint64
+		for i := range times {
+			times[i], err = strconv.ParseUint(fields[i+1], 10, 64)
+			if err != nil {
+				return stats, fmt.Errorf("failed to parse %q in %q: %v", line, procStatFile, err)
+			}
+			times[i] *= 1e9 / userHz
+		}
+		user := times[0] + times[1]
+		system := times[2] + times[5] + times[6]
+		total := user + system + times[7]
+		if fields[0] == "cpu" {
+			stats.Usage.User = user
+			stats.Usage.System = system
+			stats.Usage.Total = total
+			stats.Usage.Steal = times[7]
+			// Guest and guest_nice time are already counted in user and nice.
+			for i := 9; i < len(fields) && i < 11; i++ {
+				guest, err := strconv.ParseUint(fields[i], 10, 64)
+				if err != nil {
+					return stats, fmt.Errorf("failed to parse %q in %q: %v", line, procStatFile, err)
+				}
+				stats.Usage.Guest += guest * (1e9 / userHz)
+			}
+		} else {
+			stats.Usage.PerCpu = append(stats.Usage.PerCpu, total)
+		}
+	}
+	return stats, nil
+}
+
+// Get the root mount of a mount namespace from the specified mountinfo file
+// (e.g. /proc/<pid>/mountinfo). When several mounts are stacked on "/", the
+// last one is visible.
+func GetRootfsSpec(mountinfoFile string) (info.RootfsSpec, error) {
+	spec := info.RootfsSpec{HasMountNamespace: true}
+	out, err := ioutil.ReadFile(mountinfoFile)
+	if err != nil {
+		return spec, err
+	}
+
+	// Each line is a mount:
+	// "$ID $PARENT_ID $MAJOR:$MINOR $ROOT $MOUNTPOINT $OPTIONS [$OPTIONAL...] - $FSTYPE $SOURCE $SUPER_OPTIONS"
+	found := false
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 7 || fields[4] != "/" {
+			continue
+		}
+		separator := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				separator = i
+				break
+			}
+		}
+		if separator == -1 {
+			return spec, fmt.Errorf("failed to parse %q in %q", line, mountinfoFile)
+		}
+		found = true
+		spec.ReadOnly = hasMountOption(fields[5], "ro")
+		if len(fields) > separator+3 && hasMountOption(fields[separator+3], "ro") {
+			spec.ReadOnly = true
+		}
+		spec.Propagation = mountPropagation(fields[6:separator])
+	}
+	if !found {
+		return spec, fmt.Errorf("failed to find the root mount in %q", mountinfoFile)
+	}
+	return spec, nil
+}
+
+func hasMountOption(options string, option string) bool {
+	for _, o := range strings.Split(options, ",") {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the propagation of a mount from the optional fields of its mountinfo
+// line (e.g. "shared:1", "master:2"). A mount that is both shared and a slave
+// is reported as shared.
+func mountPropagation(optionalFields []string) string {
+	propagation := info.MountPropagationPrivate
+	for _, field := range optionalFields {
+		switch {
+		case strings.HasPrefix(field, "shared:"):
+			return info.MountPropagationShared
+		case strings.HasPrefix(field, "master:"):
+			propagation = info.MountPropagationSlave
+		case field == "unbindable":
+			propagation = info.MountPropagationUnbindable
+		}
+	}
+	return propagation
+}
+
+// Get the memory usage of the machine from the specified /proc/meminfo file.
+// The working set excludes the memory the kernel can reclaim (MemAvailable).
+func GetMemoryStats(meminfoFile string) (info.MemoryStats, error) {
+	stats := info.MemoryStats{}
+	out, err := ioutil.ReadFile(meminfoFile)
+	if err != nil {
+		return stats, err
+	}
+
+	// Each line is a counter in kB (e.g. "MemTotal:       16303148 kB").
+	meminfo := make(map[string]uint64)
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		val, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return stats, fmt.Errorf("failed to parse %q in %q: %v", line, meminfoFile, err)
+		}
+		meminfo[strings.TrimSuffix(fields[0], ":")] = val * 1024
+	}
+	total, ok := meminfo["MemTotal"]
+	if !ok {
+		return stats, fmt.Errorf("failed to find MemTotal in %q", meminfoFile)
+	}
+	available, ok := meminfo["MemAvailable"]
+	if !ok {
+		// Kernels older than 3.14.
+		available = meminfo["MemFree"] + meminfo["Buffers"] + meminfo["Cached"]
+	}
+	stats.Usage = total - meminfo["MemFree"]
+	stats.WorkingSet = total - available
+	return stats, nil
+}
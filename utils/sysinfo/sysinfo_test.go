@@ -15,6 +15,7 @@
 package sysinfo
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/google/cadvisor/info"
@@ -110,7 +111,7 @@ func TestGetCacheInfo(t *testing.T) {
 }
 
 func TestGetNetworkStats(t *testing.T) {
-	expected_stats := info.NetworkStats{
+	expected_stats := info.InterfaceStats{
 		RxBytes:   1024,
 		RxPackets: 1024,
 		RxErrors:  1024,
@@ -129,3 +130,162 @@ func TestGetNetworkStats(t *testing.T) {
 		t.Errorf("expected to get stats %+v, got %+v", expected_stats, netStats)
 	}
 }
+
+func TestGetIpv6Stats(t *testing.T) {
+	expected_stats := info.Ipv6Stats{
+		RxBytes:   148812,
+		RxPackets: 1183,
+		TxBytes:   160364,
+		TxPackets: 1215,
+	}
+	ipv6Stats, err := GetIpv6Stats("test_resources/snmp6")
+	if err != nil {
+		t.Errorf("call to GetIpv6Stats() failed with %s", err)
+	}
+	if expected_stats != ipv6Stats {
+		t.Errorf("expected to get stats %+v, got %+v", expected_stats, ipv6Stats)
+	}
+}
+
+func TestGetIpv6StatsDisabled(t *testing.T) {
+	ipv6Stats, err := GetIpv6Stats("test_resources/missing_snmp6")
+	if err != nil {
+		t.Errorf("expected call to GetIpv6Stats() to succeed when IPv6 is disabled. Failed with %s", err)
+	}
+	if ipv6Stats != (info.Ipv6Stats{}) {
+		t.Errorf("expected no IPv6 stats, got %+v", ipv6Stats)
+	}
+}
+
+func TestGetTcpAdvancedStats(t *testing.T) {
+	expected_stats := info.TcpAdvancedStats{
+		RetransSegs:     3207,
+		OutRsts:         5122,
+		EstabResets:     487,
+		ListenOverflows: 73,
+		ListenDrops:     79,
+	}
+	tcpStats, err := GetTcpAdvancedStats("test_resources/snmp", "test_resources/netstat")
+	if err != nil {
+		t.Errorf("call to GetTcpAdvancedStats() failed with %s", err)
+	}
+	if expected_stats != tcpStats {
+		t.Errorf("expected to get stats %+v, got %+v", expected_stats, tcpStats)
+	}
+}
+
+func TestGetTcpAdvancedStatsMissing(t *testing.T) {
+	tcpStats, err := GetTcpAdvancedStats("test_resources/missing_snmp", "test_resources/missing_netstat")
+	if err != nil {
+		t.Errorf("expected call to GetTcpAdvancedStats() to succeed without the files. Failed with %s", err)
+	}
+	if tcpStats != (info.TcpAdvancedStats{}) {
+		t.Errorf("expected no TCP stats, got %+v", tcpStats)
+	}
+}
+
+func TestGetCpuStats(t *testing.T) {
+	cpuStats, err := GetCpuStats("test_resources/stat")
+	if err != nil {
+		t.Fatalf("call to GetCpuStats() failed with %s", err)
+	}
+	// In nanoseconds, from 100 ticks per second.
+	if cpuStats.Usage.User != (10132153+290696)*1e7 || cpuStats.Usage.System != (3084719+25195)*1e7 {
+		t.Errorf("unexpected user and system usage in %+v", cpuStats.Usage)
+	}
+	if cpuStats.Usage.Total != cpuStats.Usage.User+cpuStats.Usage.System {
+		t.Errorf("total usage %d should be the sum of user and system usage without steal time", cpuStats.Usage.Total)
+	}
+	if cpuStats.Usage.Steal != 0 || cpuStats.Usage.Guest != 1200*1e7 {
+		t.Errorf("unexpected steal and guest usage in %+v", cpuStats.Usage)
+	}
+	expectedPerCpu := []uint64{
+		(1393280 + 32966 + 572056 + 17875) * 1e7,
+		(1335941 + 38456 + 503284 + 4120) * 1e7,
+		(3711505 + 100987 + 1053040 + 2000) * 1e7,
+		(3691427 + 118287 + 956339 + 1200) * 1e7,
+	}
+	if !reflect.DeepEqual(cpuStats.Usage.PerCpu, expectedPerCpu) {
+		t.Errorf("expected per cpu usage %v, got %v", expectedPerCpu, cpuStats.Usage.PerCpu)
+	}
+}
+
+func TestGetMemoryStats(t *testing.T) {
+	memoryStats, err := GetMemoryStats("test_resources/meminfo")
+	if err != nil {
+		t.Fatalf("call to GetMemoryStats() failed with %s", err)
+	}
+	if memoryStats.Usage != (16303148-2109508)*1024 {
+		t.Errorf("expected usage %d, got %d", (16303148-2109508)*1024, memoryStats.Usage)
+	}
+	if memoryStats.WorkingSet != (16303148-10402536)*1024 {
+		t.Errorf("expected working set %d, got %d", (16303148-10402536)*1024, memoryStats.WorkingSet)
+	}
+}
+
+func TestGetAllNetworkStats(t *testing.T) {
+	fakeSys := &fakesysfs.FakeSysFs{}
+	for _, name := range []string{"eth0", "docker0"} {
+		fakeSys.SetEntryName(name)
+		stats, err := getAllNetworkStats(fakeSys, false)
+		if err != nil {
+			t.Errorf("call to getAllNetworkStats() failed with %s", err)
+		}
+		if _, ok := stats[name]; !ok || len(stats) != 1 {
+			t.Errorf("expected to get stats of %s only, got %+v", name, stats)
+		}
+	}
+}
+
+func TestGetAllNetworkStatsLoopback(t *testing.T) {
+	fakeSys := &fakesysfs.FakeSysFs{}
+	fakeSys.SetEntryName("lo")
+	stats, err := getAllNetworkStats(fakeSys, false)
+	if err != nil {
+		t.Errorf("call to getAllNetworkStats() failed with %s", err)
+	}
+	if len(stats) != 0 {
+		t.Errorf("expected loopback to be excluded, got %+v", stats)
+	}
+
+	stats, err = getAllNetworkStats(fakeSys, true)
+	if err != nil {
+		t.Errorf("call to getAllNetworkStats() failed with %s", err)
+	}
+	if _, ok := stats["lo"]; !ok {
+		t.Errorf("expected loopback to be included, got %+v", stats)
+	}
+}
+
+func TestGetRootfsSpec(t *testing.T) {
+	spec, err := GetRootfsSpec("test_resources/mountinfo")
+	if err != nil {
+		t.Fatalf("call to GetRootfsSpec() failed with %s", err)
+	}
+	expected := info.RootfsSpec{
+		HasMountNamespace: true,
+		ReadOnly:          true,
+		Propagation:       info.MountPropagationPrivate,
+	}
+	if spec != expected {
+		t.Errorf("expected rootfs spec %+v, got %+v", expected, spec)
+	}
+}
+
+func TestMountPropagation(t *testing.T) {
+	cases := []struct {
+		optionalFields []string
+		expected       string
+	}{
+		{nil, info.MountPropagationPrivate},
+		{[]string{"shared:1"}, info.MountPropagationShared},
+		{[]string{"master:2"}, info.MountPropagationSlave},
+		{[]string{"shared:3", "master:2"}, info.MountPropagationShared},
+		{[]string{"unbindable"}, info.MountPropagationUnbindable},
+	}
+	for _, c := range cases {
+		if propagation := mountPropagation(c.optionalFields); propagation != c.expected {
+			t.Errorf("expected propagation %q for %v, got %q", c.expected, c.optionalFields, propagation)
+		}
+	}
+}